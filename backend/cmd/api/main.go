@@ -1,6 +1,7 @@
 package main
 
 import (
+    "fmt"
     "net/http"
     "os"
     "time"
@@ -9,17 +10,32 @@ import (
     "github.com/C14147/SmartCampus-Workbench/internal/config"
     "github.com/C14147/SmartCampus-Workbench/internal/db"
     "github.com/C14147/SmartCampus-Workbench/internal/handlers"
+    "github.com/C14147/SmartCampus-Workbench/internal/mail"
+    "github.com/C14147/SmartCampus-Workbench/internal/password"
     authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
     "github.com/C14147/SmartCampus-Workbench/internal/models"
     "github.com/C14147/SmartCampus-Workbench/internal/middleware"
     "github.com/prometheus/client_golang/prometheus/promhttp"
     "go.uber.org/zap"
+    "gorm.io/gorm"
 )
 
 func main() {
     logger, _ := zap.NewProduction()
     defer logger.Sync()
 
+    // `api check-policies` starts up as usual, reports routes, permissions
+    // and policies that do not match, and exits instead of serving;
+    // `api permissions` prints the role/permission matrix instead
+    var command string
+    if len(os.Args) > 1 {
+        command = os.Args[1]
+    }
+    checkOnly := command == "check-policies" || command == "permissions"
+    if checkOnly {
+        gin.SetMode(gin.ReleaseMode)
+    }
+
     cfg, err := config.LoadConfig()
     if err != nil {
         logger.Fatal("failed to load config", zap.Error(err))
@@ -32,15 +48,24 @@ func main() {
     // register prometheus middleware
     r.Use(middleware.PrometheusMiddleware())
 
+    var gdb *gorm.DB
+    var denylist *authpkg.Denylist
+    var loginGuard *authpkg.LoginGuard
+    var statusCache *authpkg.StatusCache
+    var sessionTracker *authpkg.SessionTracker
     if dsn != "" {
-        gdb, err := db.Connect(dsn)
+        gdb, err = db.Connect(dsn)
         if err != nil {
             logger.Fatal("db connect failed", zap.Error(err))
         }
         // auto migrate (keep minimal set)
-        if err := gdb.AutoMigrate(&models.User{}); err != nil {
+        if err := gdb.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.TokenRevocation{}, &models.SigningKey{}, &models.LoginThrottle{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}, &models.UserMFA{}, &models.MFARecoveryCode{}, &models.Session{}, &models.APIToken{}, &models.UserIdentity{}, &models.ImpersonationLog{}, &models.Class{}, &models.ClassStudent{}, &models.Invitation{}, &models.UserProfile{}, &models.Course{}, &models.AssignmentSubmission{}, &models.Grade{}, &models.Notification{}, &models.GuardianLink{}, &models.CasbinRule{}, &models.CasbinRuleRevision{}, &models.LegacyCasbinRule{}); err != nil {
             logger.Fatal("auto migrate failed", zap.Error(err))
         }
+        denylist = authpkg.NewDenylist(gdb, cfg.JWT.RevocationSyncInterval)
+        loginGuard = authpkg.NewLoginGuard(gdb, cfg.Auth.Lockout)
+        statusCache = authpkg.NewStatusCache(gdb, cfg.Auth.StatusCacheTTL)
+        sessionTracker = authpkg.NewSessionTracker(gdb, cfg.Auth.SessionTouchInterval)
         // register middleware to provide db to handlers
         r.Use(func(c *gin.Context) {
             c.Set("db", gdb)
@@ -49,6 +74,35 @@ func main() {
     // gdb is a *gorm.DB returned from db.Connect and stored in the request context above
     }
 
+    mailer, err := mail.New(cfg.Mail)
+    if err != nil {
+        logger.Fatal("failed to configure mail", zap.Error(err))
+    }
+
+    if cfg.Auth.OIDC.Enabled && (cfg.Auth.OIDC.IssuerURL == "" || cfg.Auth.OIDC.ClientID == "" || cfg.Auth.OIDC.RedirectURL == "") {
+        logger.Fatal("auth.oidc requires issuer_url, client_id and redirect_url")
+    }
+
+    // password login backends, tried in the configured order
+    authenticators, err := authpkg.NewAuthenticatorChain(gdb, cfg.Auth)
+    if err != nil {
+        logger.Fatal("failed to configure authenticators", zap.Error(err))
+    }
+
+    passwordPolicy, err := password.NewPolicy(cfg.Password)
+    if err != nil {
+        logger.Fatal("failed to load password policy", zap.Error(err))
+    }
+    if _, err := password.NewHasher(cfg.Password.Hash); err != nil {
+        logger.Fatal("invalid password hash settings", zap.Error(err))
+    }
+
+    // JWT signing keys are shared through the DB when there is one, in-memory otherwise
+    keys, err := authpkg.NewKeySet(gdb, cfg.JWT, cfg.MaxTokenTTL())
+    if err != nil {
+        logger.Fatal("failed to load signing keys", zap.Error(err))
+    }
+
     r.GET("/health", func(c *gin.Context) {
         c.JSON(http.StatusOK, gin.H{
             "status":    "healthy",
@@ -60,34 +114,189 @@ func main() {
     // Prometheus metrics endpoint
     r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+    // public JWT verification keys
+    r.GET("/.well-known/jwks.json", handlers.JWKSHandler(keys))
+
     // initialize casbin enforcer
-    enforcer := authpkg.NewEnforcer("./backend/config/rbac_model.conf", "./backend/config/rbac_policy.csv")
+    enforcer := authpkg.NewEnforcer(gdb, "./backend/config/rbac_model.conf", "./backend/config/rbac_policy.csv", cfg.Auth.PolicySyncInterval)
+    authMiddleware := handlers.AuthMiddleware(keys, denylist, statusCache, sessionTracker)
 
     api := r.Group("/api/v1")
     {
-        api.POST("/auth/register", handlers.RegisterHandler)
-        api.POST("/auth/login", handlers.LoginHandler)
-        api.GET("/auth/me", handlers.MeHandler)
+        api.POST("/auth/register", handlers.RegisterHandler(mailer, passwordPolicy))
+        api.POST("/auth/login", handlers.LoginHandler(keys, enforcer, loginGuard, authenticators))
+        api.POST("/auth/refresh", handlers.RefreshHandler(keys, enforcer, denylist))
+        api.POST("/auth/password/forgot", handlers.ForgotPasswordHandler(mailer))
+        api.POST("/auth/password/reset", handlers.ResetPasswordHandler(denylist, loginGuard, passwordPolicy))
+        api.POST("/auth/email/verify", handlers.VerifyEmailHandler)
+        api.POST("/auth/email/resend", handlers.ResendVerificationHandler(mailer))
+        api.POST("/auth/mfa/verify", handlers.MFAVerifyHandler(keys, enforcer, denylist, loginGuard))
+        // enrollment accepts an access token or an enrollment challenge token
+        api.POST("/auth/mfa/enroll", handlers.MFAEnrollHandler(keys, denylist))
+        api.POST("/auth/mfa/activate", handlers.MFAActivateHandler(keys, enforcer, denylist))
+
+        // single sign-on through the district's OpenID Connect provider
+        if cfg.Auth.OIDC.Enabled {
+            oidc := authpkg.NewOIDCProvider(cfg.Auth.OIDC)
+            api.GET("/auth/oidc/login", handlers.OIDCLoginHandler(oidc, keys))
+            api.GET("/auth/oidc/callback", handlers.OIDCCallbackHandler(oidc, keys, enforcer))
+        }
+    }
+
+    // Authenticated routes that every signed-in user may call
+    authed := r.Group("/api/v1")
+    authed.Use(authMiddleware)
+    {
+        authed.GET("/auth/me", handlers.MeHandler)
+    }
+
+    // Account management; needs a real sign-in, API tokens are refused
+    account := authed.Group("")
+    account.Use(handlers.RejectAPITokens())
+    {
+        // also ends an impersonation
+        account.POST("/auth/logout", handlers.LogoutHandler(denylist))
+        // the schools the user may act in
+        account.GET("/auth/schools", handlers.ListMySchoolsHandler(enforcer))
+    }
+
+    // Sensitive account actions, also refused to admins impersonating the user
+    sensitive := account.Group("")
+    sensitive.Use(handlers.ForbidImpersonation())
+    {
+        sensitive.GET("/auth/sessions", handlers.ListSessionsHandler)
+        sensitive.DELETE("/auth/sessions", handlers.RevokeOtherSessionsHandler(denylist))
+        sensitive.DELETE("/auth/sessions/:id", handlers.RevokeSessionHandler(denylist))
+        sensitive.POST("/auth/password/change", handlers.ChangePasswordHandler(denylist, passwordPolicy))
+        sensitive.POST("/auth/mfa/disable", handlers.MFADisableHandler(enforcer))
+        sensitive.POST("/auth/mfa/recovery-codes", handlers.MFARecoveryCodesHandler)
+        sensitive.GET("/auth/tokens", handlers.ListAPITokensHandler)
+        sensitive.POST("/auth/tokens", handlers.CreateAPITokenHandler(enforcer))
+        sensitive.DELETE("/auth/tokens/:id", handlers.RevokeAPITokenHandler)
+        sensitive.POST("/auth/school", handlers.SwitchSchoolHandler(keys, enforcer, denylist))
     }
 
-    // Protected routes: require auth and RBAC checks
-    protected := r.Group("/api/v1")
-    protected.Use(handlers.AuthMiddleware())
-    protected.Use(authpkg.RequirePermission(enforcer))
+    // Protected routes: require auth and a permission, which each route
+    // declares. Every route registered from here on must have one.
+    unprotected := r.Routes()
+    permissions := authpkg.NewRegistry(enforcer)
+    protectedGroup := r.Group("/api/v1")
+    protectedGroup.Use(authMiddleware)
+    protected := permissions.Group(protectedGroup)
     {
+        // own profile
+        protected.GET("/users/profile", authpkg.PermProfileManage, handlers.GetProfileHandler)
+        protected.PUT("/users/profile", authpkg.PermProfileManage, handlers.UpdateProfileHandler)
+
         // schools
-        protected.GET("/schools", handlers.ListSchools)
-        protected.POST("/schools", handlers.CreateSchool)
-        protected.GET("/schools/:id", handlers.GetSchool)
-        protected.PUT("/schools/:id", handlers.UpdateSchool)
-        protected.DELETE("/schools/:id", handlers.DeleteSchool)
+        protected.GET("/schools", authpkg.PermSchoolView, handlers.ListSchools)
+        protected.POST("/schools", authpkg.PermDistrictManage, handlers.CreateSchool)
+        protected.GET("/schools/:id", authpkg.PermSchoolView, handlers.GetSchool)
+        protected.PUT("/schools/:id", authpkg.PermSchoolManage, handlers.UpdateSchool)
+        protected.DELETE("/schools/:id", authpkg.PermDistrictManage, handlers.DeleteSchool)
 
         // assignments
-        protected.GET("/assignments", handlers.ListAssignments)
-        protected.POST("/assignments", handlers.CreateAssignment)
-        protected.GET("/assignments/:id", handlers.GetAssignment)
-        protected.PUT("/assignments/:id", handlers.UpdateAssignment)
-        protected.DELETE("/assignments/:id", handlers.DeleteAssignment)
+        protected.GET("/assignments", authpkg.PermAssignmentView, handlers.ListAssignments)
+        protected.POST("/assignments", authpkg.PermAssignmentManage, handlers.CreateAssignment)
+        protected.GET("/assignments/:id", authpkg.PermAssignmentView, handlers.GetAssignment)
+        protected.PUT("/assignments/:id", authpkg.PermAssignmentManage, handlers.UpdateAssignment)
+        protected.DELETE("/assignments/:id", authpkg.PermAssignmentManage, handlers.DeleteAssignment)
+
+        // user administration
+        protected.GET("/admin/users", authpkg.PermUserView, handlers.ListUsers)
+        protected.POST("/admin/users", authpkg.PermUserManage, handlers.CreateUser(mailer, passwordPolicy))
+        protected.POST("/admin/users/import", authpkg.PermUserManage, handlers.ImportUsers(passwordPolicy))
+        protected.GET("/admin/users/:id", authpkg.PermUserView, handlers.GetUser)
+        protected.GET("/admin/users/:id/profile", authpkg.PermUserView, handlers.GetUserProfile)
+        protected.PUT("/admin/users/:id/profile", authpkg.PermUserManage, handlers.UpdateUserProfile)
+        protected.PUT("/admin/users/:id", authpkg.PermUserManage, handlers.UpdateUser)
+        protected.DELETE("/admin/users/:id", authpkg.PermUserManage, handlers.DeleteUser(denylist, statusCache))
+        protected.PUT("/admin/users/:id/role", authpkg.PermUserManage, handlers.ChangeUserRole(denylist))
+        // roles in other schools than the user's own
+        protected.GET("/admin/users/:id/roles", authpkg.PermUserView, handlers.ListUserRoles(enforcer))
+        protected.POST("/admin/users/:id/roles", authpkg.PermUserManage, handlers.GrantUserRole(enforcer))
+        protected.DELETE("/admin/users/:id/roles", authpkg.PermUserManage, handlers.RevokeUserRole(enforcer, denylist))
+        protected.PUT("/admin/users/:id/status", authpkg.PermUserManage, handlers.ChangeUserStatus(denylist, statusCache))
+        protected.POST("/admin/users/:id/password-reset", authpkg.PermUserManage, handlers.ForcePasswordReset(mailer, denylist))
+        protected.POST("/admin/users/:id/revoke-sessions", authpkg.PermUserManage, handlers.RevokeUserSessions(denylist))
+        protected.POST("/admin/users/:id/unlock", authpkg.PermUserManage, handlers.UnlockUser(loginGuard))
+        protected.POST("/admin/users/:id/impersonate", authpkg.PermUserImpersonate, handlers.ImpersonateUser(keys, enforcer))
+        protected.GET("/admin/impersonation-logs", authpkg.PermUserImpersonate, handlers.ListImpersonationLogs)
+
+        // service accounts for automation
+        protected.GET("/admin/service-accounts", authpkg.PermServiceAccountManage, handlers.ListServiceAccounts)
+        protected.POST("/admin/service-accounts", authpkg.PermServiceAccountManage, handlers.CreateServiceAccount)
+        protected.GET("/admin/service-accounts/:id/tokens", authpkg.PermServiceAccountManage, handlers.ListServiceAccountTokens)
+        protected.POST("/admin/service-accounts/:id/tokens", authpkg.PermServiceAccountManage, handlers.CreateServiceAccountToken(enforcer))
+        protected.DELETE("/admin/service-accounts/:id/tokens/:tokenId", authpkg.PermServiceAccountManage, handlers.RevokeServiceAccountToken)
+
+        // authorization policies and role inheritance (district admins)
+        protected.GET("/admin/policies", authpkg.PermSystemManage, handlers.ListPolicies(enforcer))
+        protected.POST("/admin/policies", authpkg.PermSystemManage, handlers.AddPolicy(enforcer))
+        protected.DELETE("/admin/policies", authpkg.PermSystemManage, handlers.RemovePolicy(enforcer))
+        protected.POST("/admin/policies/groupings", authpkg.PermSystemManage, handlers.AddGrouping(enforcer))
+        protected.DELETE("/admin/policies/groupings", authpkg.PermSystemManage, handlers.RemoveGrouping(enforcer))
+
+        // guardian links (admin)
+        protected.GET("/admin/guardian-links", authpkg.PermGuardianLinkManage, handlers.ListGuardianLinks)
+        protected.POST("/admin/guardian-links", authpkg.PermGuardianLinkManage, handlers.CreateGuardianLink)
+        protected.POST("/admin/guardian-links/:id/verify", authpkg.PermGuardianLinkManage, handlers.VerifyGuardianLink())
+        protected.POST("/admin/guardian-links/:id/reject", authpkg.PermGuardianLinkManage, handlers.RejectGuardianLink())
+        protected.DELETE("/admin/guardian-links/:id", authpkg.PermGuardianLinkManage, handlers.DeleteGuardianLink)
+
+        // guardians: read-only views of their verified students
+        protected.GET("/guardian/students", authpkg.PermGuardianView, handlers.ListGuardianStudents)
+        protected.POST("/guardian/links", authpkg.PermGuardianLinkRequest, handlers.RequestGuardianLink)
+        guardianStudent := protected.Group("/guardian/students/:id", handlers.RequireGuardianLink())
+        {
+            guardianStudent.GET("/assignments", authpkg.PermGuardianView, handlers.ListStudentAssignments)
+            guardianStudent.GET("/grades", authpkg.PermGuardianView, handlers.ListStudentGrades)
+            guardianStudent.GET("/notifications", authpkg.PermGuardianView, handlers.ListStudentNotifications)
+        }
+
+        // invitation and class-join codes (admins and teachers)
+        protected.GET("/invitations", authpkg.PermInvitationManage, handlers.ListInvitations)
+        protected.POST("/invitations", authpkg.PermInvitationManage, handlers.CreateInvitation)
+        protected.DELETE("/invitations/:id", authpkg.PermInvitationManage, handlers.RevokeInvitation)
+    }
+
+    if command == "permissions" {
+        matrix, err := authpkg.PermissionMatrix(enforcer, permissions)
+        if err != nil {
+            logger.Fatal("permission matrix failed", zap.Error(err))
+        }
+        fmt.Print(matrix)
+        return
+    }
+    report, err := authpkg.CheckPolicies(enforcer, permissions, authpkg.ProtectedRoutes(r.Routes(), unprotected))
+    if err != nil {
+        logger.Fatal("policy check failed", zap.Error(err))
+    }
+    if gdb != nil {
+        if report.LegacyPolicies, err = authpkg.LegacyPolicies(gdb); err != nil {
+            logger.Fatal("policy check failed", zap.Error(err))
+        }
+    }
+    if checkOnly {
+        for _, line := range report.Lines() {
+            fmt.Println(line)
+        }
+        if !report.OK() {
+            os.Exit(1)
+        }
+        fmt.Println("every protected route has a permission, every permission a role and a route, and every policy a permission")
+        return
+    }
+    switch cfg.Auth.PolicyCheck {
+    case "off":
+    case "fail":
+        if !report.OK() {
+            logger.Fatal("routes and policies do not match", zap.Strings("problems", report.Lines()))
+        }
+    default:
+        for _, line := range report.Lines() {
+            logger.Warn("policy check: " + line)
+        }
     }
 
     addr := ":" + cfg.Server.Port
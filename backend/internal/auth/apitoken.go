@@ -0,0 +1,54 @@
+package auth
+
+import (
+    "sort"
+    "strings"
+
+    "github.com/casbin/casbin/v2"
+)
+
+// APITokenPrefix starts every personal access token so that AuthMiddleware can
+// tell them apart from JWTs (and secret scanners can find leaked ones).
+const APITokenPrefix = "scpat_"
+
+// scopeSubjectPrefix marks Casbin subjects that are API token scopes, e.g.
+// "p, scope:schools:read, school:view".
+const scopeSubjectPrefix = "scope:"
+
+// GenerateAPIToken returns a new personal access token and its storage hash.
+func GenerateAPIToken() (string, string, error) {
+    raw, _, err := GenerateOpaqueToken()
+    if err != nil {
+        return "", "", err
+    }
+    token := APITokenPrefix + raw
+    return token, HashToken(token), nil
+}
+
+// IsAPIToken reports whether a bearer token is a personal access token.
+func IsAPIToken(token string) bool {
+    return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// Scopes lists the API token scopes defined in the policy.
+func Scopes(e *casbin.SyncedEnforcer) []string {
+    subjects, _ := e.GetAllSubjects()
+    var scopes []string
+    for _, s := range subjects {
+        if strings.HasPrefix(s, scopeSubjectPrefix) {
+            scopes = append(scopes, strings.TrimPrefix(s, scopeSubjectPrefix))
+        }
+    }
+    sort.Strings(scopes)
+    return scopes
+}
+
+// scopesAllow reports whether any of the scopes grants perm.
+func scopesAllow(e *casbin.SyncedEnforcer, scopes []string, school string, perm Permission) bool {
+    for _, s := range scopes {
+        if ok, err := e.Enforce(scopeSubjectPrefix+s, school, string(perm)); err == nil && ok {
+            return true
+        }
+    }
+    return false
+}
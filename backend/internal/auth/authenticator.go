@@ -0,0 +1,99 @@
+package auth
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/password"
+)
+
+var (
+    // ErrUnknownUser means the backend does not know the user; the next backend is tried.
+    ErrUnknownUser = errors.New("unknown user")
+    // ErrInvalidCredentials means the backend knows the user but the password is wrong.
+    ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator checks a username and password against one identity source
+// and returns the matching local user.
+type Authenticator interface {
+    Name() string
+    Authenticate(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// AuthenticatorChain tries its backends in order. A backend that does not
+// know the user, or cannot be reached, hands over to the next one; a wrong
+// password for a known user ends the login.
+type AuthenticatorChain []Authenticator
+
+// NewAuthenticatorChain builds the backends named in cfg.Authenticators.
+func NewAuthenticatorChain(db *gorm.DB, cfg config.AuthConfig) (AuthenticatorChain, error) {
+    var chain AuthenticatorChain
+    for _, name := range cfg.Authenticators {
+        switch name {
+        case "local":
+            chain = append(chain, &LocalAuthenticator{db: db})
+        case "ldap":
+            if cfg.LDAP.URL == "" || cfg.LDAP.BaseDN == "" {
+                return nil, errors.New("ldap authenticator requires auth.ldap.url and auth.ldap.base_dn")
+            }
+            chain = append(chain, NewLDAPAuthenticator(db, cfg.LDAP))
+        default:
+            return nil, fmt.Errorf("unknown authenticator %q", name)
+        }
+    }
+    if len(chain) == 0 {
+        return nil, errors.New("no authenticator configured")
+    }
+    return chain, nil
+}
+
+// Authenticate returns the user from the first backend that knows them.
+func (ac AuthenticatorChain) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+    var lastErr error = ErrUnknownUser
+    for _, a := range ac {
+        user, err := a.Authenticate(ctx, username, password)
+        switch {
+        case err == nil:
+            return user, nil
+        case errors.Is(err, ErrInvalidCredentials):
+            return nil, err
+        case errors.Is(err, ErrUnknownUser):
+            continue
+        default:
+            log.Printf("authenticator %s: %v", a.Name(), err)
+            lastErr = err
+        }
+    }
+    return nil, lastErr
+}
+
+// LocalAuthenticator checks the password hash (argon2id or bcrypt) stored with the user.
+type LocalAuthenticator struct {
+    db *gorm.DB
+}
+
+func (a *LocalAuthenticator) Name() string { return "local" }
+
+// Authenticate treats users without a usable password (e.g. provisioned from
+// LDAP or SSO) as unknown, so that a later backend can take over.
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, username, pw string) (*models.User, error) {
+    var user models.User
+    err := a.db.WithContext(ctx).Where("username = ?", username).First(&user).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.PasswordHash == UnusablePasswordHash) {
+        return nil, ErrUnknownUser
+    }
+    if err != nil {
+        return nil, err
+    }
+    if !password.Verify(pw, user.PasswordHash) {
+        return nil, ErrInvalidCredentials
+    }
+    return &user, nil
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+    "log"
+    "sync"
+    "time"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// Denylist keeps revoked access tokens. Postgres is the source of truth so that
+// every instance sees revocations; lookups are served from an in-memory copy
+// that is refreshed every syncInterval, so AuthMiddleware never hits the DB.
+//
+// A nil *Denylist is valid and never reports a token as revoked.
+type Denylist struct {
+    db           *gorm.DB
+    syncInterval time.Duration
+
+    mu    sync.RWMutex
+    jtis     map[string]time.Time // jti -> token expiry
+    sessions map[string]time.Time // session id -> revocation expiry
+    users    map[string]time.Time // user id -> tokens issued before this are revoked
+}
+
+// NewDenylist loads current revocations and keeps them in sync in the background.
+func NewDenylist(db *gorm.DB, syncInterval time.Duration) *Denylist {
+    d := &Denylist{
+        db:           db,
+        syncInterval: syncInterval,
+        jtis:         map[string]time.Time{},
+        sessions:     map[string]time.Time{},
+        users:        map[string]time.Time{},
+    }
+    if err := d.sync(); err != nil {
+        log.Printf("denylist: initial sync failed: %v", err)
+    }
+    go d.syncLoop()
+    return d
+}
+
+func (d *Denylist) syncLoop() {
+    ticker := time.NewTicker(d.syncInterval)
+    defer ticker.Stop()
+    for range ticker.C {
+        if err := d.sync(); err != nil {
+            log.Printf("denylist: sync failed: %v", err)
+        }
+    }
+}
+
+// sync replaces the cache with the unexpired rows and purges the expired ones.
+func (d *Denylist) sync() error {
+    now := time.Now()
+    if err := d.db.Where("expires_at <= ?", now).Delete(&models.TokenRevocation{}).Error; err != nil {
+        return err
+    }
+    var rows []models.TokenRevocation
+    if err := d.db.Where("expires_at > ?", now).Find(&rows).Error; err != nil {
+        return err
+    }
+
+    jtis := make(map[string]time.Time, len(rows))
+    sessions := map[string]time.Time{}
+    users := map[string]time.Time{}
+    for _, r := range rows {
+        if r.JTI != "" {
+            jtis[r.JTI] = r.ExpiresAt
+            continue
+        }
+        if r.SessionID != "" {
+            sessions[r.SessionID] = r.ExpiresAt
+            continue
+        }
+        if r.RevokedAt.After(users[r.UserID]) {
+            users[r.UserID] = r.RevokedAt
+        }
+    }
+
+    d.mu.Lock()
+    d.jtis = jtis
+    d.sessions = sessions
+    d.users = users
+    d.mu.Unlock()
+    return nil
+}
+
+// RevokeToken denylists a single token until it expires.
+func (d *Denylist) RevokeToken(jti, userID string, expiresAt time.Time) error {
+    if d == nil || jti == "" {
+        return nil
+    }
+    row := &models.TokenRevocation{JTI: jti, UserID: userID, RevokedAt: time.Now(), ExpiresAt: expiresAt}
+    // another instance may have revoked it already
+    if err := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+        return err
+    }
+    d.mu.Lock()
+    d.jtis[jti] = expiresAt
+    d.mu.Unlock()
+    return nil
+}
+
+// ConsumeToken denylists a single-use token until it expires and reports
+// whether this call used it, i.e. it had not been used before on any
+// instance. Tokens without a jti cannot be used.
+func (d *Denylist) ConsumeToken(jti, userID string, expiresAt time.Time) (bool, error) {
+    if d == nil {
+        return true, nil
+    }
+    ok, err := d.ConsumeTokenTx(d.db, jti, userID, expiresAt)
+    if err != nil || jti == "" {
+        return false, err
+    }
+    d.mu.Lock()
+    d.jtis[jti] = expiresAt
+    d.mu.Unlock()
+    return ok, nil
+}
+
+// ConsumeTokenTx is ConsumeToken as part of the transaction tx, so that the
+// token stays unused when tx rolls back. This instance's cache learns about
+// the use at its next sync; until then the unique jti keeps a second use out.
+func (d *Denylist) ConsumeTokenTx(tx *gorm.DB, jti, userID string, expiresAt time.Time) (bool, error) {
+    if d == nil {
+        return true, nil
+    }
+    if jti == "" {
+        return false, nil
+    }
+    row := &models.TokenRevocation{JTI: jti, UserID: userID, RevokedAt: time.Now(), ExpiresAt: expiresAt}
+    res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row)
+    if res.Error != nil {
+        return false, res.Error
+    }
+    return res.RowsAffected == 1, nil
+}
+
+// RevokeSession revokes every token of a session. maxTTL is the longest
+// lifetime of any token (Config.MaxTokenTTL); after that the entry is obsolete.
+func (d *Denylist) RevokeSession(sessionID, userID string, maxTTL time.Duration) error {
+    if d == nil || sessionID == "" {
+        return nil
+    }
+    now := time.Now()
+    row := &models.TokenRevocation{SessionID: sessionID, UserID: userID, RevokedAt: now, ExpiresAt: now.Add(maxTTL)}
+    if err := d.db.Create(row).Error; err != nil {
+        return err
+    }
+    d.mu.Lock()
+    d.sessions[sessionID] = row.ExpiresAt
+    d.mu.Unlock()
+    return nil
+}
+
+// RevokeUser revokes every token issued to userID so far. maxTTL is the
+// longest lifetime of any token (Config.MaxTokenTTL); after that the entry is
+// obsolete.
+//
+// Tokens carry their issue time in whole seconds, so the revocation time is
+// truncated as well: a login in the same second, e.g. right after changing
+// the password, gets a working token.
+func (d *Denylist) RevokeUser(userID string, maxTTL time.Duration) error {
+    if d == nil {
+        return nil
+    }
+    now := time.Now().Truncate(time.Second)
+    row := &models.TokenRevocation{UserID: userID, RevokedAt: now, ExpiresAt: now.Add(maxTTL)}
+    if err := d.db.Create(row).Error; err != nil {
+        return err
+    }
+    d.mu.Lock()
+    d.users[userID] = now
+    d.mu.Unlock()
+    return nil
+}
+
+// IsRevoked reports whether the token identified by jti, issued to userID at
+// issuedAt within session sid, has been revoked. Tokens of a revoked user
+// count as revoked when issued in a second before the revocation.
+func (d *Denylist) IsRevoked(jti, sid, userID string, issuedAt time.Time) bool {
+    if d == nil {
+        return false
+    }
+    d.mu.RLock()
+    defer d.mu.RUnlock()
+    if _, ok := d.jtis[jti]; ok {
+        return true
+    }
+    if _, ok := d.sessions[sid]; ok && sid != "" {
+        return true
+    }
+    if before, ok := d.users[userID]; ok && issuedAt.Before(before) {
+        return true
+    }
+    return false
+}
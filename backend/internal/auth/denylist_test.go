@@ -0,0 +1,127 @@
+package auth
+
+import (
+    "testing"
+    "time"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestRevokedImpersonationTokenOutlivesAccessTTL(t *testing.T) {
+    cfg := &config.Config{}
+    cfg.JWT.AccessTTL = 15 * time.Minute
+    cfg.Auth.ImpersonationTTL = 30 * time.Minute
+    cfg.Auth.MFA.ChallengeTTL = 5 * time.Minute
+    if got := cfg.MaxTokenTTL(); got != 30*time.Minute {
+        t.Fatalf("MaxTokenTTL = %v, want 30m", got)
+    }
+
+    db := testutil.NewDB(t, &models.TokenRevocation{})
+    dl := NewDenylist(db, time.Hour)
+    const user = "7b0c3e9a-0d6f-4c43-9a53-3f1c1a2b4c5d"
+    const session = "session-1"
+    if err := dl.RevokeUser(user, cfg.MaxTokenTTL()); err != nil {
+        t.Fatal(err)
+    }
+    if err := dl.RevokeSession(session, user, cfg.MaxTokenTTL()); err != nil {
+        t.Fatal(err)
+    }
+
+    // pretend the revocations happened 20 minutes ago, past the access TTL
+    // but within the impersonation TTL, and let the purge run
+    age := 20 * time.Minute
+    err := db.Model(&models.TokenRevocation{}).Where("1 = 1").Updates(map[string]interface{}{
+        "revoked_at": time.Now().Add(-age),
+    }).Error
+    if err != nil {
+        t.Fatal(err)
+    }
+    var rows []models.TokenRevocation
+    db.Find(&rows)
+    for _, r := range rows {
+        db.Model(&r).Update("expires_at", r.ExpiresAt.Add(-age))
+    }
+    if err := dl.sync(); err != nil {
+        t.Fatal(err)
+    }
+
+    // an impersonation token issued just before the revocation is still unexpired
+    issuedAt := time.Now().Add(-age - time.Minute)
+    if !dl.IsRevoked("jti-1", "", user, issuedAt) {
+        t.Error("token of a revoked user works again after the access TTL")
+    }
+    if !dl.IsRevoked("jti-2", session, "other-user", issuedAt) {
+        t.Error("token of a revoked session works again after the access TTL")
+    }
+}
+
+func TestConsumeTokenAcrossInstances(t *testing.T) {
+    db := testutil.NewDB(t, &models.TokenRevocation{})
+    // two instances with their own caches share the database
+    a, b := NewDenylist(db, time.Hour), NewDenylist(db, time.Hour)
+    const user = "7b0c3e9a-0d6f-4c43-9a53-3f1c1a2b4c5d"
+    exp := time.Now().Add(5 * time.Minute)
+
+    for i, tc := range []struct {
+        dl   *Denylist
+        jti  string
+        want bool
+    }{
+        {a, "challenge-1", true},
+        {b, "challenge-1", false},
+        {a, "challenge-1", false},
+        {b, "challenge-2", true},
+        {a, "", false},
+    } {
+        got, err := tc.dl.ConsumeToken(tc.jti, user, exp)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got != tc.want {
+            t.Errorf("%d: ConsumeToken(%q) = %v, want %v", i, tc.jti, got, tc.want)
+        }
+    }
+    if !a.IsRevoked("challenge-1", "", user, time.Now()) {
+        t.Error("consumed token not revoked")
+    }
+    // revoking a consumed token again is not an error
+    if err := b.RevokeToken("challenge-1", user, exp); err != nil {
+        t.Errorf("RevokeToken: %v", err)
+    }
+}
+
+func TestRevokeUserSparesLoginInSameSecond(t *testing.T) {
+    db := testutil.NewDB(t, &models.TokenRevocation{})
+    dl := NewDenylist(db, time.Hour)
+    const user = "7b0c3e9a-0d6f-4c43-9a53-3f1c1a2b4c5d"
+    if err := dl.RevokeUser(user, time.Hour); err != nil {
+        t.Fatal(err)
+    }
+    // iat of a token issued right after the revocation, e.g. the login
+    // following a password change
+    now := time.Unix(time.Now().Unix(), 0)
+
+    tests := []struct {
+        name     string
+        issuedAt time.Time
+        want     bool
+    }{
+        {"issued in an earlier second", now.Add(-time.Second), true},
+        {"issued in the same second", now, false},
+        {"issued later", now.Add(time.Second), false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := dl.IsRevoked("", "", user, tt.issuedAt); got != tt.want {
+                t.Errorf("IsRevoked = %v, want %v", got, tt.want)
+            }
+            // other instances load the revocation from the database
+            other := NewDenylist(db, time.Hour)
+            if got := other.IsRevoked("", "", user, tt.issuedAt); got != tt.want {
+                t.Errorf("IsRevoked after sync = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
@@ -2,24 +2,94 @@ package auth
 
 import (
     "log"
+    "time"
 
     casbin "github.com/casbin/casbin/v2"
     "github.com/casbin/casbin/v2/model"
+    "github.com/casbin/casbin/v2/persist"
     fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+    "github.com/casbin/casbin/v2/util"
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
 )
 
-func NewEnforcer(modelPath, policyPath string) *casbin.Enforcer {
+// AllSchools is the domain of role grants that apply in every school, such
+// as "g, <user id>, district_admin, *".
+const AllSchools = "*"
+
+// NewEnforcer builds the Casbin enforcer. Requests are checked in the domain
+// of the school they act in; grouping rules are "g, member, role, school"
+// and apply in every school when the school is AllSchools.
+// With a database the policies live in the casbin_rule table, seeded from
+// policyPath when it is empty, and are reloaded every syncInterval when
+// another instance has changed them; without one they are read from policyPath.
+func NewEnforcer(db *gorm.DB, modelPath, policyPath string, syncInterval time.Duration) *casbin.SyncedEnforcer {
     m, err := model.NewModelFromFile(modelPath)
     if err != nil {
         log.Fatalf("failed to load model: %v", err)
     }
-    a := fileadapter.NewAdapter(policyPath)
-    e, err := casbin.NewEnforcer(m, a)
+    if db == nil {
+        return newSyncedEnforcer(m, fileadapter.NewAdapter(policyPath))
+    }
+
+    a := NewPolicyAdapter(db)
+    var n int64
+    if err := db.Model(&models.CasbinRule{}).Count(&n).Error; err != nil {
+        log.Fatalf("failed to count policies: %v", err)
+    }
+    if n == 0 {
+        if err := seedPolicy(a, modelPath, policyPath); err != nil {
+            log.Fatalf("failed to seed policies: %v", err)
+        }
+        log.Printf("casbin: seeded policies from %s", policyPath)
+    }
+    e := newSyncedEnforcer(m, a)
+    go syncPolicy(e, a, syncInterval)
+    return e
+}
+
+func newSyncedEnforcer(m model.Model, a persist.Adapter) *casbin.SyncedEnforcer {
+    e, err := casbin.NewSyncedEnforcer(m, a)
     if err != nil {
         log.Fatalf("failed to create enforcer: %v", err)
     }
-    if err := e.LoadPolicy(); err != nil {
-        log.Fatalf("failed to load policy: %v", err)
-    }
+    // grants in the * domain apply in every school
+    e.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
     return e
 }
+
+// seedPolicy copies the rules of the policy file into the database.
+func seedPolicy(a *PolicyAdapter, modelPath, policyPath string) error {
+    m, err := model.NewModelFromFile(modelPath)
+    if err != nil {
+        return err
+    }
+    if err := fileadapter.NewAdapter(policyPath).LoadPolicy(m); err != nil {
+        return err
+    }
+    return a.SavePolicy(m)
+}
+
+// syncPolicy reloads the policy whenever the stored rules change, so that
+// changes made through another instance apply here too.
+func syncPolicy(e *casbin.SyncedEnforcer, a *PolicyAdapter, interval time.Duration) {
+    last, _ := a.revision()
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        rev, err := a.revision()
+        if err != nil {
+            log.Printf("casbin: policy sync failed: %v", err)
+            continue
+        }
+        if rev == last {
+            continue
+        }
+        if err := e.LoadPolicy(); err != nil {
+            log.Printf("casbin: policy reload failed: %v", err)
+            continue
+        }
+        last = rev
+    }
+}
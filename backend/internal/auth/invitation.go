@@ -0,0 +1,32 @@
+package auth
+
+import (
+    "crypto/rand"
+    "strings"
+)
+
+// invitationAlphabet leaves out characters that are easily confused (0/O, 1/I).
+const invitationAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateInvitationCode returns a random code like "K3F9Q-7XW2M" that is
+// easy to read out in class.
+func GenerateInvitationCode() (string, error) {
+    buf := make([]byte, 10)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    for i, b := range buf {
+        buf[i] = invitationAlphabet[int(b)%len(invitationAlphabet)]
+    }
+    return string(buf[:5]) + "-" + string(buf[5:]), nil
+}
+
+// NormalizeInvitationCode makes user input comparable to a generated code.
+func NormalizeInvitationCode(code string) string {
+    code = strings.ToUpper(strings.TrimSpace(code))
+    code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+    if len(code) == 10 {
+        code = code[:5] + "-" + code[5:]
+    }
+    return code
+}
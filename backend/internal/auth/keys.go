@@ -0,0 +1,406 @@
+package auth
+
+import (
+    "crypto"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "sync"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+)
+
+// keyRotationLockID serialises key rotation between instances (pg advisory lock).
+const keyRotationLockID = 0x5343_4b45_5953 // "SCKEYS"
+
+// PEM block types of the private keys in signing_keys. Sealed keys hold the
+// GCM nonce followed by the encrypted PKCS #8 key, with the kid as additional
+// data so that a key cannot be moved to another row.
+const (
+    pemPrivateKey       = "PRIVATE KEY"
+    pemSealedPrivateKey = "SEALED PRIVATE KEY"
+)
+
+type signingKey struct {
+    kid       string
+    method    jwt.SigningMethod
+    private   crypto.Signer
+    createdAt time.Time
+    expiresAt time.Time
+}
+
+// KeySet holds the asymmetric keys used to sign and verify JWTs. Keys are
+// stored in Postgres so that every instance signs with, and publishes, the
+// same keys; without a database the set lives in memory only.
+type KeySet struct {
+    db       *gorm.DB
+    alg      string
+    issuer   string
+    rotation time.Duration
+    // how long a key stays verifiable after it stopped signing
+    retention time.Duration
+    // seals the stored private keys; nil stores them in plain PEM
+    aead cipher.AEAD
+
+    mu   sync.RWMutex
+    keys []*signingKey // newest first
+}
+
+// JWK is the public part of a signing key in RFC 7517 format.
+type JWK struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    Alg string `json:"alg"`
+    N   string `json:"n,omitempty"`
+    E   string `json:"e,omitempty"`
+    Crv string `json:"crv,omitempty"`
+    X   string `json:"x,omitempty"`
+}
+
+// NewKeySet loads (or creates) the signing keys and rotates them in the
+// background. Retired keys stay verifiable for retention, the lifetime of the
+// longest lived token they sign (Config.MaxTokenTTL). With
+// cfg.KeyEncryptionKey the private keys are stored encrypted.
+func NewKeySet(db *gorm.DB, cfg config.JWTConfig, retention time.Duration) (*KeySet, error) {
+    if _, err := signingMethod(cfg.Algorithm); err != nil {
+        return nil, err
+    }
+    aead, err := newKeyCipher(cfg.KeyEncryptionKey)
+    if err != nil {
+        return nil, err
+    }
+    if db != nil && aead == nil {
+        log.Printf("keyset: jwt.key_encryption_key is not set; signing keys are stored unencrypted")
+    }
+    ks := &KeySet{
+        db:        db,
+        alg:       cfg.Algorithm,
+        issuer:    cfg.Issuer,
+        rotation:  cfg.KeyRotationInterval,
+        retention: retention,
+        aead:      aead,
+    }
+    if err := ks.rotate(); err != nil {
+        return nil, err
+    }
+    go ks.rotateLoop()
+    return ks, nil
+}
+
+// Issuer is the iss claim of every token signed by this set.
+func (ks *KeySet) Issuer() string {
+    return ks.issuer
+}
+
+// Sign signs claims with the current key and sets the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+    ks.mu.RLock()
+    if len(ks.keys) == 0 {
+        ks.mu.RUnlock()
+        return "", errors.New("no signing key available")
+    }
+    k := ks.keys[0]
+    ks.mu.RUnlock()
+
+    token := jwt.NewWithClaims(k.method, claims)
+    token.Header["kid"] = k.kid
+    return token.SignedString(k.private)
+}
+
+// Keyfunc resolves the verification key of a token from its kid header.
+func (ks *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+    kid, _ := t.Header["kid"].(string)
+    ks.mu.RLock()
+    defer ks.mu.RUnlock()
+    for _, k := range ks.keys {
+        if k.kid != kid {
+            continue
+        }
+        if t.Method.Alg() != k.method.Alg() {
+            return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+        }
+        return k.private.Public(), nil
+    }
+    return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// ValidMethods lists the algorithms a token signed by this set may use.
+func (ks *KeySet) ValidMethods() []string {
+    return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// JWKS returns the public keys of the set, newest first.
+func (ks *KeySet) JWKS() []JWK {
+    ks.mu.RLock()
+    defer ks.mu.RUnlock()
+    out := make([]JWK, 0, len(ks.keys))
+    for _, k := range ks.keys {
+        jwk := JWK{Kid: k.kid, Use: "sig", Alg: k.method.Alg()}
+        switch pub := k.private.Public().(type) {
+        case *rsa.PublicKey:
+            jwk.Kty = "RSA"
+            jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+            jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+        case ed25519.PublicKey:
+            jwk.Kty = "OKP"
+            jwk.Crv = "Ed25519"
+            jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+        }
+        out = append(out, jwk)
+    }
+    return out
+}
+
+func (ks *KeySet) rotateLoop() {
+    // check often enough that a rotation is never late by more than a few percent
+    interval := ks.rotation / 20
+    if interval > time.Hour {
+        interval = time.Hour
+    }
+    if interval < time.Minute {
+        interval = time.Minute
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        if err := ks.rotate(); err != nil {
+            log.Printf("keyset: rotation failed: %v", err)
+        }
+    }
+}
+
+// rotate reloads the keys and creates a new current key when the newest one is
+// older than the rotation interval (or there is none).
+func (ks *KeySet) rotate() error {
+    if ks.db == nil {
+        ks.mu.Lock()
+        defer ks.mu.Unlock()
+        keys := pruneKeys(ks.keys)
+        if ks.needsRotation(keys) {
+            k, err := ks.generate()
+            if err != nil {
+                return err
+            }
+            keys = append([]*signingKey{k}, keys...)
+        }
+        ks.keys = keys
+        return nil
+    }
+
+    var keys []*signingKey
+    err := ks.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", keyRotationLockID).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("expires_at <= ?", time.Now()).Delete(&models.SigningKey{}).Error; err != nil {
+            return err
+        }
+        var rows []models.SigningKey
+        if err := tx.Order("created_at DESC").Find(&rows).Error; err != nil {
+            return err
+        }
+        for _, row := range rows {
+            k, err := decodeSigningKey(row, ks.aead)
+            if err != nil {
+                return err
+            }
+            if ks.aead != nil && !isSealed(row.PrivateKey) {
+                // stored before jwt.key_encryption_key was set
+                enc, err := encodeSigningKey(k, ks.aead)
+                if err != nil {
+                    return err
+                }
+                if err := tx.Model(&row).Update("private_key", enc).Error; err != nil {
+                    return err
+                }
+            }
+            keys = append(keys, k)
+        }
+        if !ks.needsRotation(keys) {
+            return nil
+        }
+
+        k, err := ks.generate()
+        if err != nil {
+            return err
+        }
+        enc, err := encodeSigningKey(k, ks.aead)
+        if err != nil {
+            return err
+        }
+        row := models.SigningKey{
+            Kid:        k.kid,
+            Algorithm:  k.method.Alg(),
+            PrivateKey: enc,
+            ExpiresAt:  k.expiresAt,
+            CreatedAt:  k.createdAt,
+        }
+        if err := tx.Create(&row).Error; err != nil {
+            return err
+        }
+        keys = append([]*signingKey{k}, keys...)
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+
+    ks.mu.Lock()
+    ks.keys = keys
+    ks.mu.Unlock()
+    return nil
+}
+
+// needsRotation reports whether a new current key is due: there is none, it
+// is older than the rotation interval, or the configured algorithm changed.
+func (ks *KeySet) needsRotation(keys []*signingKey) bool {
+    if len(keys) == 0 {
+        return true
+    }
+    return time.Since(keys[0].createdAt) >= ks.rotation || keys[0].method.Alg() != ks.alg
+}
+
+func (ks *KeySet) generate() (*signingKey, error) {
+    method, err := signingMethod(ks.alg)
+    if err != nil {
+        return nil, err
+    }
+    var priv crypto.Signer
+    switch method {
+    case jwt.SigningMethodRS256:
+        priv, err = rsa.GenerateKey(rand.Reader, 2048)
+    default:
+        _, priv, err = ed25519.GenerateKey(rand.Reader)
+    }
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    return &signingKey{
+        kid:       utils.NewUUID(),
+        method:    method,
+        private:   priv,
+        createdAt: now,
+        // signs for one rotation interval, then verifies until its last token expired
+        expiresAt: now.Add(ks.rotation + ks.retention),
+    }, nil
+}
+
+func pruneKeys(keys []*signingKey) []*signingKey {
+    out := keys[:0]
+    for _, k := range keys {
+        if time.Now().Before(k.expiresAt) {
+            out = append(out, k)
+        }
+    }
+    return out
+}
+
+// newKeyCipher returns the AES-256-GCM cipher for a base64 encoded 32-byte
+// key, or nil when none is configured.
+func newKeyCipher(encoded string) (cipher.AEAD, error) {
+    if encoded == "" {
+        return nil, nil
+    }
+    key, err := base64.StdEncoding.DecodeString(encoded)
+    if err != nil || len(key) != 32 {
+        return nil, errors.New("jwt.key_encryption_key must be 32 bytes, base64 encoded")
+    }
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+func isSealed(stored string) bool {
+    block, _ := pem.Decode([]byte(stored))
+    return block != nil && block.Type == pemSealedPrivateKey
+}
+
+// encodeSigningKey returns the PEM stored for k, sealed with aead unless it is nil.
+func encodeSigningKey(k *signingKey, aead cipher.AEAD) (string, error) {
+    der, err := x509.MarshalPKCS8PrivateKey(k.private)
+    if err != nil {
+        return "", err
+    }
+    if aead == nil {
+        return string(pem.EncodeToMemory(&pem.Block{Type: pemPrivateKey, Bytes: der})), nil
+    }
+    nonce := make([]byte, aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+    sealed := aead.Seal(nonce, nonce, der, []byte(k.kid))
+    return string(pem.EncodeToMemory(&pem.Block{Type: pemSealedPrivateKey, Bytes: sealed})), nil
+}
+
+// decodeSigningKey reads a stored key, plain or sealed with aead.
+func decodeSigningKey(row models.SigningKey, aead cipher.AEAD) (*signingKey, error) {
+    method, err := signingMethod(row.Algorithm)
+    if err != nil {
+        return nil, err
+    }
+    block, _ := pem.Decode([]byte(row.PrivateKey))
+    if block == nil {
+        return nil, fmt.Errorf("signing key %s: invalid PEM", row.Kid)
+    }
+    der := block.Bytes
+    switch block.Type {
+    case pemPrivateKey:
+    case pemSealedPrivateKey:
+        if aead == nil {
+            return nil, fmt.Errorf("signing key %s: encrypted, but jwt.key_encryption_key is not set", row.Kid)
+        }
+        if len(der) < aead.NonceSize() {
+            return nil, fmt.Errorf("signing key %s: truncated", row.Kid)
+        }
+        nonce, sealed := der[:aead.NonceSize()], der[aead.NonceSize():]
+        if der, err = aead.Open(nil, nonce, sealed, []byte(row.Kid)); err != nil {
+            return nil, fmt.Errorf("signing key %s: cannot decrypt with jwt.key_encryption_key", row.Kid)
+        }
+    default:
+        return nil, fmt.Errorf("signing key %s: unexpected PEM block %q", row.Kid, block.Type)
+    }
+    parsed, err := x509.ParsePKCS8PrivateKey(der)
+    if err != nil {
+        return nil, fmt.Errorf("signing key %s: %w", row.Kid, err)
+    }
+    priv, ok := parsed.(crypto.Signer)
+    if !ok {
+        return nil, fmt.Errorf("signing key %s: unsupported key type", row.Kid)
+    }
+    return &signingKey{
+        kid:       row.Kid,
+        method:    method,
+        private:   priv,
+        createdAt: row.CreatedAt,
+        expiresAt: row.ExpiresAt,
+    }, nil
+}
+
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+    switch alg {
+    case jwt.SigningMethodRS256.Alg():
+        return jwt.SigningMethodRS256, nil
+    case jwt.SigningMethodEdDSA.Alg():
+        return jwt.SigningMethodEdDSA, nil
+    }
+    return nil, fmt.Errorf("unsupported JWT algorithm %q (use RS256 or EdDSA)", alg)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "encoding/base64"
+    "strings"
+    "testing"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+func newTestKeyCipherKey(t *testing.T) string {
+    t.Helper()
+    key := make([]byte, 32)
+    if _, err := rand.Read(key); err != nil {
+        t.Fatal(err)
+    }
+    return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestNewKeyCipher(t *testing.T) {
+    for _, tc := range []struct {
+        name    string
+        key     string
+        wantNil bool
+        wantErr bool
+    }{
+        {"none", "", true, false},
+        {"valid", newTestKeyCipherKey(t), false, false},
+        {"too short", base64.StdEncoding.EncodeToString(make([]byte, 16)), false, true},
+        {"not base64", "not a key!", false, true},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            aead, err := newKeyCipher(tc.key)
+            if (err != nil) != tc.wantErr {
+                t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+            }
+            if !tc.wantErr && (aead == nil) != tc.wantNil {
+                t.Errorf("cipher = %v, want nil %v", aead, tc.wantNil)
+            }
+        })
+    }
+}
+
+func TestSigningKeyEncryption(t *testing.T) {
+    aead, err := newKeyCipher(newTestKeyCipherKey(t))
+    if err != nil {
+        t.Fatal(err)
+    }
+    other, err := newKeyCipher(newTestKeyCipherKey(t))
+    if err != nil {
+        t.Fatal(err)
+    }
+    ks := &KeySet{alg: "EdDSA"}
+    k, err := ks.generate()
+    if err != nil {
+        t.Fatal(err)
+    }
+    plain, err := encodeSigningKey(k, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    sealed, err := encodeSigningKey(k, aead)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !isSealed(sealed) || isSealed(plain) {
+        t.Fatalf("isSealed: sealed %v, plain %v", isSealed(sealed), isSealed(plain))
+    }
+    if strings.Contains(sealed, "BEGIN PRIVATE KEY") {
+        t.Fatal("sealed key stored as plain PEM")
+    }
+
+    for _, tc := range []struct {
+        name    string
+        kid     string
+        stored  string
+        decrypt bool
+        other   bool
+        wantErr bool
+    }{
+        {"plain without key", k.kid, plain, false, false, false},
+        // plain keys stay readable once a key is configured
+        {"plain with key", k.kid, plain, true, false, false},
+        {"sealed", k.kid, sealed, true, false, false},
+        {"sealed without key", k.kid, sealed, false, false, true},
+        {"sealed with another key", k.kid, sealed, true, true, true},
+        {"sealed moved to another kid", "other-kid", sealed, true, false, true},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            row := models.SigningKey{Kid: tc.kid, Algorithm: "EdDSA", PrivateKey: tc.stored}
+            key := aead
+            if !tc.decrypt {
+                key = nil
+            } else if tc.other {
+                key = other
+            }
+            got, err := decodeSigningKey(row, key)
+            if (err != nil) != tc.wantErr {
+                t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+            }
+            if err == nil && !k.private.(ed25519.PrivateKey).Equal(got.private) {
+                t.Error("decoded a different key")
+            }
+        })
+    }
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "net"
+    "strings"
+
+    "github.com/go-ldap/ldap/v3"
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// LDAPAuthenticator verifies passwords by binding to an LDAP directory (or
+// Active Directory) as the user. Users are created on their first login and
+// their role follows the mapped values of the role attribute (e.g. memberOf).
+type LDAPAuthenticator struct {
+    db  *gorm.DB
+    cfg config.LDAPConfig
+}
+
+func NewLDAPAuthenticator(db *gorm.DB, cfg config.LDAPConfig) *LDAPAuthenticator {
+    return &LDAPAuthenticator{db: db, cfg: cfg}
+}
+
+func (a *LDAPAuthenticator) Name() string { return "ldap" }
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+    // an empty password would be an anonymous bind, which most servers accept
+    if password == "" {
+        return nil, ErrInvalidCredentials
+    }
+
+    conn, err := a.dial()
+    if err != nil {
+        return nil, err
+    }
+    defer conn.Close()
+
+    if a.cfg.BindDN != "" {
+        err = conn.Bind(a.cfg.BindDN, a.cfg.BindPassword)
+    } else {
+        err = conn.UnauthenticatedBind("")
+    }
+    if err != nil {
+        return nil, fmt.Errorf("ldap service bind: %w", err)
+    }
+
+    attrs := []string{"dn", a.cfg.EmailAttribute}
+    for _, attr := range []string{a.cfg.RoleAttribute, a.cfg.SchoolAttribute} {
+        if attr != "" {
+            attrs = append(attrs, attr)
+        }
+    }
+    res, err := conn.Search(ldap.NewSearchRequest(
+        a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.cfg.Timeout.Seconds()), false,
+        fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+        attrs, nil,
+    ))
+    if err != nil {
+        return nil, fmt.Errorf("ldap search: %w", err)
+    }
+    switch len(res.Entries) {
+    case 0:
+        return nil, ErrUnknownUser
+    case 1:
+    default:
+        return nil, fmt.Errorf("ldap search: %q matches several entries", username)
+    }
+    entry := res.Entries[0]
+
+    if err := conn.Bind(entry.DN, password); err != nil {
+        if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+            return nil, ErrInvalidCredentials
+        }
+        return nil, fmt.Errorf("ldap user bind: %w", err)
+    }
+
+    user, err := ProvisionUser(a.db.WithContext(ctx), ExternalIdentity{
+        Issuer:        a.cfg.URL,
+        Subject:       strings.ToLower(username),
+        Username:      username,
+        Email:         entry.GetAttributeValue(a.cfg.EmailAttribute),
+        EmailVerified: true,
+        Role:          a.role(entry),
+        School:        a.school(entry),
+    }, ProvisionPolicy{
+        AllowSignup:     a.cfg.AllowSignup,
+        LinkByUsername:  a.cfg.LinkExisting,
+        SyncRole:        a.cfg.SyncRole,
+        DefaultRole:     a.cfg.DefaultRole,
+        DefaultSchool:   a.cfg.DefaultSchool,
+        AllowPrivileged: a.cfg.LinkPrivileged,
+    })
+    if errors.Is(err, ErrLinkPrivileged) {
+        // the local admin signs in with their local password
+        return nil, ErrUnknownUser
+    }
+    if errors.Is(err, ErrNoAccount) || errors.Is(err, ErrNoRole) || errors.Is(err, ErrNoSchool) {
+        // valid directory credentials, but no way in; do not try other backends
+        return nil, ErrInvalidCredentials
+    }
+    return user, err
+}
+
+// role maps the role attribute of a directory entry. Values that are DNs
+// (memberOf) also match a mapping on their first RDN value, so both
+// "cn=teachers,ou=groups,dc=example,dc=org" and "teachers" work.
+func (a *LDAPAuthenticator) role(entry *ldap.Entry) string {
+    if a.cfg.RoleAttribute == "" {
+        return ""
+    }
+    var values []string
+    for _, v := range entry.GetAttributeValues(a.cfg.RoleAttribute) {
+        values = append(values, v)
+        if dn, err := ldap.ParseDN(v); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+            values = append(values, dn.RDNs[0].Attributes[0].Value)
+        }
+    }
+    return MapRole(a.cfg.RoleMappings, values)
+}
+
+// school returns the school code of a directory entry, or "".
+func (a *LDAPAuthenticator) school(entry *ldap.Entry) string {
+    if a.cfg.SchoolAttribute == "" {
+        return ""
+    }
+    return entry.GetAttributeValue(a.cfg.SchoolAttribute)
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+    tlsConfig := &tls.Config{InsecureSkipVerify: a.cfg.InsecureSkipVerify}
+    conn, err := ldap.DialURL(a.cfg.URL,
+        ldap.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}),
+        ldap.DialWithTLSConfig(tlsConfig),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("ldap dial: %w", err)
+    }
+    conn.SetTimeout(a.cfg.Timeout)
+    if a.cfg.StartTLS {
+        if err := conn.StartTLS(tlsConfig); err != nil {
+            conn.Close()
+            return nil, fmt.Errorf("ldap starttls: %w", err)
+        }
+    }
+    return conn, nil
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// Error codes returned to clients when a login is refused before the
+// credentials are checked.
+const (
+    CodeAccountLocked  = "ACCOUNT_LOCKED"
+    CodeIPLocked       = "IP_LOCKED"
+    CodeLoginThrottled = "LOGIN_THROTTLED"
+)
+
+// LockoutError explains why a login attempt was refused and when to retry.
+type LockoutError struct {
+    Code       string
+    RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+    return fmt.Sprintf("%s: retry after %s", strings.ToLower(e.Code), e.RetryAfter.Round(time.Second))
+}
+
+// LoginGuard tracks failed logins per account and per client IP in Postgres so
+// that delays and lockouts survive restarts and apply across instances.
+// A nil *LoginGuard allows every attempt.
+type LoginGuard struct {
+    db  *gorm.DB
+    cfg config.LockoutConfig
+}
+
+// NewLoginGuard returns a guard that purges stale rows in the background
+// every cfg.Window, since attempts on unknown usernames leave rows no
+// successful login ever clears.
+func NewLoginGuard(db *gorm.DB, cfg config.LockoutConfig) *LoginGuard {
+    g := &LoginGuard{db: db, cfg: cfg}
+    if cfg.Window > 0 {
+        go g.purgeLoop()
+    }
+    return g
+}
+
+func (g *LoginGuard) purgeLoop() {
+    ticker := time.NewTicker(g.cfg.Window)
+    defer ticker.Stop()
+    for range ticker.C {
+        if err := g.purge(time.Now()); err != nil {
+            log.Printf("login guard: purge failed: %v", err)
+        }
+    }
+}
+
+// purge deletes the rows that no longer affect a login at now: their lockout
+// is over and their last failure is too old to count or to start a lockout.
+func (g *LoginGuard) purge(now time.Time) error {
+    keep := g.cfg.Window
+    if g.cfg.Duration > keep {
+        keep = g.cfg.Duration
+    }
+    return g.db.
+        Where("last_failure_at <= ?", now.Add(-keep)).
+        Where("locked_until IS NULL OR locked_until <= ?", now).
+        Delete(&models.LoginThrottle{}).Error
+}
+
+func accountKey(username string) string {
+    return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipKey(ip string) string {
+    return "ip:" + ip
+}
+
+// Reserve counts a login attempt for username from ip before its credentials
+// are checked, or returns a *LockoutError if it must be refused right now.
+// The attempt counts as a failure from the start, under a lock on the
+// throttle rows, so a burst of parallel requests cannot all get in before the
+// first failure is recorded. RecordSuccess and Release give it back.
+func (g *LoginGuard) Reserve(username, ip string) error {
+    if g == nil {
+        return nil
+    }
+    return g.reserve(username, ip, time.Now())
+}
+
+func (g *LoginGuard) reserve(username, ip string, now time.Time) error {
+    account := accountKey(username)
+    keys := []string{account, ipKey(ip)}
+    var refused *LockoutError
+    err := g.db.Transaction(func(tx *gorm.DB) error {
+        for _, key := range keys {
+            if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{Key: key}).Error; err != nil {
+                return err
+            }
+        }
+        var rows []models.LoginThrottle
+        // a fixed lock order keeps parallel attempts from deadlocking
+        err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key IN ?", keys).Order("key").Find(&rows).Error
+        if err != nil {
+            return err
+        }
+        for i := range rows {
+            if le := g.admit(&rows[i], rows[i].Key == account, now); le != nil && refused == nil {
+                refused = le
+            }
+        }
+        for i := range rows {
+            if refused == nil {
+                rows[i].Failures++
+                rows[i].LastFailureAt = now
+            }
+            // lockouts found on the way are kept even when the attempt is refused
+            if err := tx.Save(&rows[i]).Error; err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    // a nil *LockoutError must not turn into a non-nil error
+    if refused != nil {
+        return refused
+    }
+    return nil
+}
+
+// admit applies the lockout rules to the throttle row of one key at now. It
+// locks the key for Duration after the failure that reached its threshold,
+// forgets failures older than Window, and returns why an attempt has to wait.
+func (g *LoginGuard) admit(t *models.LoginThrottle, account bool, now time.Time) *LockoutError {
+    max, code := g.cfg.IPMaxAttempts, CodeIPLocked
+    if account {
+        max, code = g.cfg.MaxAttempts, CodeAccountLocked
+    }
+    if max > 0 && t.Failures >= max {
+        until := t.LastFailureAt.Add(g.cfg.Duration)
+        t.LockedUntil = &until
+        t.Failures = 0
+    }
+    if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+        return &LockoutError{Code: code, RetryAfter: t.LockedUntil.Sub(now)}
+    }
+    if now.Sub(t.LastFailureAt) > g.cfg.Window {
+        t.Failures = 0
+    }
+    // progressive delay only applies to accounts; many users share a school's IP
+    if account && t.Failures > 0 {
+        if next := t.LastFailureAt.Add(g.delay(t.Failures)); now.Before(next) {
+            return &LockoutError{Code: CodeLoginThrottled, RetryAfter: next.Sub(now)}
+        }
+    }
+    return nil
+}
+
+// Release gives back an attempt counted by Reserve that neither failed nor
+// succeeded, e.g. because a login backend was unreachable.
+func (g *LoginGuard) Release(username, ip string) error {
+    if g == nil {
+        return nil
+    }
+    return g.release(accountKey(username), ipKey(ip))
+}
+
+func (g *LoginGuard) release(keys ...string) error {
+    return g.db.Model(&models.LoginThrottle{}).
+        Where("key IN ? AND failures > 0", keys).
+        Update("failures", gorm.Expr("failures - 1")).Error
+}
+
+// RecordSuccess clears the failure count of an account and gives back the
+// attempt counted for the IP. The rest of the IP counter is left alone so
+// that one valid account cannot reset it for an attacker.
+func (g *LoginGuard) RecordSuccess(username, ip string) error {
+    if g == nil {
+        return nil
+    }
+    if err := g.db.Delete(&models.LoginThrottle{}, "key = ?", accountKey(username)).Error; err != nil {
+        return err
+    }
+    return g.release(ipKey(ip))
+}
+
+// Unlock lifts the lockout of an account and, if ip is not empty, of an IP.
+func (g *LoginGuard) Unlock(username, ip string) error {
+    if g == nil {
+        return nil
+    }
+    keys := []string{accountKey(username)}
+    if ip != "" {
+        keys = append(keys, ipKey(ip))
+    }
+    return g.db.Delete(&models.LoginThrottle{}, "key IN ?", keys).Error
+}
+
+// delay is BaseDelay doubled for every failure after the first, capped at MaxDelay.
+func (g *LoginGuard) delay(failures int) time.Duration {
+    d := g.cfg.BaseDelay
+    for i := 1; i < failures && d < g.cfg.MaxDelay; i++ {
+        d *= 2
+    }
+    if d > g.cfg.MaxDelay {
+        d = g.cfg.MaxDelay
+    }
+    return d
+}
+
+// AsLockout unwraps a *LockoutError.
+func AsLockout(err error) (*LockoutError, bool) {
+    var le *LockoutError
+    ok := errors.As(err, &le)
+    return le, ok
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestLoginGuardPurge(t *testing.T) {
+    db := testutil.NewDB(t, &models.LoginThrottle{})
+    g := &LoginGuard{db: db, cfg: config.LockoutConfig{Window: 15 * time.Minute}}
+    now := time.Now()
+    at := func(d time.Duration) *time.Time {
+        v := now.Add(d)
+        return &v
+    }
+
+    rows := []struct {
+        throttle models.LoginThrottle
+        kept     bool
+    }{
+        {models.LoginThrottle{Key: "user:recent", Failures: 2, LastFailureAt: now.Add(-time.Minute)}, true},
+        {models.LoginThrottle{Key: "user:stale", Failures: 2, LastFailureAt: now.Add(-time.Hour)}, false},
+        {models.LoginThrottle{Key: "ip:locked", LastFailureAt: now.Add(-time.Hour), LockedUntil: at(time.Minute)}, true},
+        {models.LoginThrottle{Key: "ip:unlocked", LastFailureAt: now.Add(-time.Hour), LockedUntil: at(-time.Minute)}, false},
+        // a lockout that just ended still counts recent failures
+        {models.LoginThrottle{Key: "user:unlocked", LastFailureAt: now.Add(-time.Minute), LockedUntil: at(-time.Second)}, true},
+    }
+    for _, r := range rows {
+        if err := db.Create(&r.throttle).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    if err := g.purge(now); err != nil {
+        t.Fatal(err)
+    }
+    for _, r := range rows {
+        var n int64
+        db.Model(&models.LoginThrottle{}).Where("key = ?", r.throttle.Key).Count(&n)
+        if kept := n == 1; kept != r.kept {
+            t.Errorf("%s: kept = %v, want %v", r.throttle.Key, kept, r.kept)
+        }
+    }
+}
+
+func TestLoginGuardDelay(t *testing.T) {
+    g := &LoginGuard{cfg: config.LockoutConfig{BaseDelay: time.Second, MaxDelay: 30 * time.Second}}
+    for _, tc := range []struct {
+        failures int
+        want     time.Duration
+    }{
+        {1, time.Second},
+        {2, 2 * time.Second},
+        {3, 4 * time.Second},
+        {5, 16 * time.Second},
+        {6, 30 * time.Second},
+        {50, 30 * time.Second},
+    } {
+        if got := g.delay(tc.failures); got != tc.want {
+            t.Errorf("delay(%d) = %v, want %v", tc.failures, got, tc.want)
+        }
+    }
+}
+
+func TestLoginGuardReserve(t *testing.T) {
+    cfg := config.LockoutConfig{
+        MaxAttempts: 3, IPMaxAttempts: 5, Window: 15 * time.Minute, Duration: 15 * time.Minute,
+        BaseDelay: time.Minute, MaxDelay: time.Hour,
+    }
+    db := testutil.NewDB(t, &models.LoginThrottle{})
+    g := &LoginGuard{db: db, cfg: cfg}
+    const ip = "192.0.2.1"
+    t0 := time.Now()
+
+    // every reserved attempt fails unless a success gives it back
+    steps := []struct {
+        user    string
+        at      time.Duration
+        success bool
+        want    string
+    }{
+        {user: "ana", want: ""},
+        {user: "ana", want: CodeLoginThrottled},
+        {user: "ana", at: time.Minute, want: ""},
+        {user: "ana", at: time.Minute + time.Second, want: CodeLoginThrottled},
+        {user: "ana", at: 3 * time.Minute, want: ""},
+        // the third failure locks the account for Duration
+        {user: "ana", at: 10 * time.Minute, want: CodeAccountLocked},
+        {user: " ANA ", at: 17 * time.Minute, want: CodeAccountLocked},
+        // the delay is per account, the shared IP is not throttled yet
+        {user: "ben", at: 10 * time.Minute, success: true, want: ""},
+        {user: "ana", at: 18 * time.Minute, success: true, want: ""},
+        {user: "ana", at: 18 * time.Minute, want: ""},
+        {user: "carl", at: 18 * time.Minute, want: ""},
+        // ana's last failure, carl's and the three before the lockout
+        {user: "dan", at: 18 * time.Minute, want: CodeIPLocked},
+    }
+    for i, st := range steps {
+        now := t0.Add(st.at)
+        err := g.reserve(st.user, ip, now)
+        got := ""
+        if le, ok := AsLockout(err); ok {
+            got = le.Code
+        } else if err != nil {
+            t.Fatal(err)
+        }
+        if got != st.want {
+            t.Fatalf("step %d (%s at %v): refused with %q, want %q", i, st.user, st.at, got, st.want)
+        }
+        if st.success {
+            if err := g.RecordSuccess(st.user, ip); err != nil {
+                t.Fatal(err)
+            }
+        }
+    }
+}
+
+func TestLoginGuardRelease(t *testing.T) {
+    db := testutil.NewDB(t, &models.LoginThrottle{})
+    g := &LoginGuard{db: db, cfg: config.LockoutConfig{
+        MaxAttempts: 5, Window: time.Hour, Duration: time.Hour, BaseDelay: time.Minute, MaxDelay: time.Hour,
+    }}
+    const ip = "192.0.2.1"
+    if err := g.Reserve("ana", ip); err != nil {
+        t.Fatal(err)
+    }
+    if err := g.Release("ana", ip); err != nil {
+        t.Fatal(err)
+    }
+    if err := g.Reserve("ana", ip); err != nil {
+        t.Errorf("attempt after a given back one refused: %v", err)
+    }
+}
+
+func TestLoginGuardReserveParallel(t *testing.T) {
+    db := testutil.NewDB(t, &models.LoginThrottle{})
+    g := &LoginGuard{db: db, cfg: config.LockoutConfig{
+        MaxAttempts: 3, IPMaxAttempts: 100, Window: time.Hour, Duration: time.Hour,
+        BaseDelay: time.Minute, MaxDelay: time.Hour,
+    }}
+    const attempts = 20
+    errs := make(chan error, attempts)
+    var wg sync.WaitGroup
+    for i := 0; i < attempts; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            errs <- g.Reserve("ana", "192.0.2.1")
+        }()
+    }
+    wg.Wait()
+    close(errs)
+
+    admitted := 0
+    for err := range errs {
+        if err == nil {
+            admitted++
+        } else if _, ok := AsLockout(err); !ok {
+            t.Fatal(err)
+        }
+    }
+    // the base delay holds back every attempt after the first
+    if admitted != 1 {
+        t.Errorf("%d of %d parallel attempts admitted, want 1", admitted, attempts)
+    }
+}
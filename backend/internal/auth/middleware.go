@@ -7,8 +7,11 @@ import (
     "github.com/gin-gonic/gin"
 )
 
-// RequirePermission checks Casbin policy for current user role and requested path
-func RequirePermission(e *casbin.Enforcer) gin.HandlerFunc {
+// RequirePermission checks that the current user's role has perm in the
+// domain of the school the request acts in. Requests made with an API token
+// must also be allowed by one of its scopes. Routes get it through a
+// RouteGroup, which records the permission they need.
+func RequirePermission(e *casbin.SyncedEnforcer, perm Permission) gin.HandlerFunc {
     return func(c *gin.Context) {
         roleIfc, _ := c.Get("user_role")
         role, _ := roleIfc.(string)
@@ -17,14 +20,19 @@ func RequirePermission(e *casbin.Enforcer) gin.HandlerFunc {
             return
         }
 
-        obj := c.FullPath()
-        act := c.Request.Method
-
-        ok, err := e.Enforce(role, obj, act)
+        school := c.GetString("school_id")
+        ok, err := e.Enforce(role, school, string(perm))
         if err != nil || !ok {
-            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "permission": perm})
             return
         }
+        if scopes, isToken := c.Get("token_scopes"); isToken {
+            list, _ := scopes.([]string)
+            if !scopesAllow(e, list, school, perm) {
+                c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient token scope", "permission": perm})
+                return
+            }
+        }
         c.Next()
     }
 }
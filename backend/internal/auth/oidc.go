@@ -0,0 +1,377 @@
+package auth
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/ed25519"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+)
+
+// TokenTypeOIDCState marks the signed cookie that carries an SSO login
+// (state, nonce and PKCE verifier) from the redirect to the callback.
+const TokenTypeOIDCState = "oidc_state"
+
+// oidcKeyRefreshInterval limits how often an unknown kid triggers a JWKS reload.
+const oidcKeyRefreshInterval = time.Minute
+
+var (
+    errOIDCNonce    = errors.New("id token nonce mismatch")
+    errOIDCAudience = errors.New("id token audience mismatch")
+)
+
+// OIDCProvider is a minimal OpenID Connect relying party for the
+// authorization code flow with PKCE. Discovery and the provider's signing keys
+// are fetched on first use, so the API starts even while the IdP is down.
+type OIDCProvider struct {
+    cfg    config.OIDCConfig
+    client *http.Client
+
+    mu        sync.Mutex
+    discovery *oidcDiscovery
+    keys      map[string]crypto.PublicKey
+    keysAt    time.Time
+}
+
+type oidcDiscovery struct {
+    Issuer                string `json:"issuer"`
+    AuthorizationEndpoint string `json:"authorization_endpoint"`
+    TokenEndpoint         string `json:"token_endpoint"`
+    JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCLogin is the per-login secret state kept between redirect and callback.
+type OIDCLogin struct {
+    State    string
+    Nonce    string
+    Verifier string
+    // path in the frontend to return to after signing in
+    ReturnTo string
+}
+
+func NewOIDCProvider(cfg config.OIDCConfig) *OIDCProvider {
+    return &OIDCProvider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Config returns the provider settings.
+func (p *OIDCProvider) Config() config.OIDCConfig {
+    return p.cfg
+}
+
+// NewOIDCLogin creates fresh state, nonce and PKCE verifier for one login.
+func NewOIDCLogin(returnTo string) (*OIDCLogin, error) {
+    var secrets [3]string
+    for i := range secrets {
+        s, _, err := GenerateOpaqueToken()
+        if err != nil {
+            return nil, err
+        }
+        secrets[i] = s
+    }
+    return &OIDCLogin{State: secrets[0], Nonce: secrets[1], Verifier: secrets[2], ReturnTo: returnTo}, nil
+}
+
+// GenerateOIDCStateToken signs the login state for the state cookie.
+func GenerateOIDCStateToken(ks *KeySet, l *OIDCLogin, ttl time.Duration) (string, error) {
+    now := time.Now()
+    return ks.Sign(jwt.MapClaims{
+        "iss":       ks.Issuer(),
+        "typ":       TokenTypeOIDCState,
+        "state":     l.State,
+        "nonce":     l.Nonce,
+        "verifier":  l.Verifier,
+        "return_to": l.ReturnTo,
+        "jti":       utils.NewUUID(),
+        "iat":       now.Unix(),
+        "exp":       now.Add(ttl).Unix(),
+    })
+}
+
+// ParseOIDCStateToken verifies a state cookie and returns the login state.
+func ParseOIDCStateToken(ks *KeySet, tokenString string) (*OIDCLogin, error) {
+    claims, err := parseToken(ks, tokenString)
+    if err != nil {
+        return nil, err
+    }
+    if typ, _ := claims["typ"].(string); typ != TokenTypeOIDCState {
+        return nil, errWrongTokenType
+    }
+    l := &OIDCLogin{}
+    l.State, _ = claims["state"].(string)
+    l.Nonce, _ = claims["nonce"].(string)
+    l.Verifier, _ = claims["verifier"].(string)
+    l.ReturnTo, _ = claims["return_to"].(string)
+    return l, nil
+}
+
+// AuthCodeURL returns the IdP URL that starts the login.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, l *OIDCLogin) (string, error) {
+    d, err := p.discover(ctx)
+    if err != nil {
+        return "", err
+    }
+    challenge := sha256.Sum256([]byte(l.Verifier))
+    q := url.Values{
+        "response_type":         {"code"},
+        "client_id":             {p.cfg.ClientID},
+        "redirect_uri":          {p.cfg.RedirectURL},
+        "scope":                 {strings.Join(p.cfg.Scopes, " ")},
+        "state":                 {l.State},
+        "nonce":                 {l.Nonce},
+        "code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+        "code_challenge_method": {"S256"},
+    }
+    sep := "?"
+    if strings.Contains(d.AuthorizationEndpoint, "?") {
+        sep = "&"
+    }
+    return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, l *OIDCLogin) (jwt.MapClaims, error) {
+    d, err := p.discover(ctx)
+    if err != nil {
+        return nil, err
+    }
+    form := url.Values{
+        "grant_type":    {"authorization_code"},
+        "code":          {code},
+        "redirect_uri":  {p.cfg.RedirectURL},
+        "client_id":     {p.cfg.ClientID},
+        "code_verifier": {l.Verifier},
+    }
+    if p.cfg.ClientSecret != "" {
+        form.Set("client_secret", p.cfg.ClientSecret)
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Accept", "application/json")
+
+    var tok struct {
+        IDToken string `json:"id_token"`
+    }
+    if err := p.doJSON(req, &tok); err != nil {
+        return nil, fmt.Errorf("oidc token exchange: %w", err)
+    }
+    if tok.IDToken == "" {
+        return nil, errors.New("oidc token exchange: no id_token in response")
+    }
+    return p.verifyIDToken(ctx, tok.IDToken, l.Nonce)
+}
+
+// verifyIDToken checks signature, issuer, audience, expiry and nonce of an ID token.
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw, nonce string) (jwt.MapClaims, error) {
+    d, err := p.discover(ctx)
+    if err != nil {
+        return nil, err
+    }
+    claims := jwt.MapClaims{}
+    _, err = jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+        kid, _ := t.Header["kid"].(string)
+        return p.key(ctx, kid)
+    },
+        jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+        jwt.WithIssuer(d.Issuer),
+        jwt.WithExpirationRequired(),
+        jwt.WithLeeway(time.Minute),
+    )
+    if err != nil {
+        return nil, err
+    }
+    aud, _ := claims.GetAudience()
+    found := false
+    for _, a := range aud {
+        if a == p.cfg.ClientID {
+            found = true
+        }
+    }
+    if !found {
+        return nil, errOIDCAudience
+    }
+    if n, _ := claims["nonce"].(string); n != nonce {
+        return nil, errOIDCNonce
+    }
+    return claims, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+    p.mu.Lock()
+    d := p.discovery
+    p.mu.Unlock()
+    if d != nil {
+        return d, nil
+    }
+
+    u := strings.TrimRight(p.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+    if err != nil {
+        return nil, err
+    }
+    d = &oidcDiscovery{}
+    if err := p.doJSON(req, d); err != nil {
+        return nil, fmt.Errorf("oidc discovery: %w", err)
+    }
+    if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+        return nil, errors.New("oidc discovery: incomplete provider metadata")
+    }
+    if d.Issuer == "" {
+        d.Issuer = p.cfg.IssuerURL
+    }
+
+    p.mu.Lock()
+    p.discovery = d
+    p.mu.Unlock()
+    return d, nil
+}
+
+// key returns the provider's public key for kid, reloading the JWKS when the
+// kid is unknown (the IdP rotated its keys).
+func (p *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+    p.mu.Lock()
+    k, ok := p.keys[kid]
+    stale := time.Since(p.keysAt) >= oidcKeyRefreshInterval
+    p.mu.Unlock()
+    if ok {
+        return k, nil
+    }
+    if !stale {
+        return nil, fmt.Errorf("unknown key id %q", kid)
+    }
+
+    d, err := p.discover(ctx)
+    if err != nil {
+        return nil, err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+    if err != nil {
+        return nil, err
+    }
+    var set struct {
+        Keys []oidcJWK `json:"keys"`
+    }
+    if err := p.doJSON(req, &set); err != nil {
+        return nil, fmt.Errorf("oidc jwks: %w", err)
+    }
+    keys := map[string]crypto.PublicKey{}
+    for _, j := range set.Keys {
+        if j.Use != "" && j.Use != "sig" {
+            continue
+        }
+        if pub, err := j.publicKey(); err == nil {
+            keys[j.Kid] = pub
+        }
+    }
+
+    p.mu.Lock()
+    p.keys = keys
+    p.keysAt = time.Now()
+    p.mu.Unlock()
+
+    if k, ok := keys[kid]; ok {
+        return k, nil
+    }
+    // tokens without kid are accepted when the IdP publishes a single key
+    if kid == "" && len(keys) == 1 {
+        for _, k := range keys {
+            return k, nil
+        }
+    }
+    return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, v interface{}) error {
+    resp, err := p.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+    if err != nil {
+        return err
+    }
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+    }
+    return json.Unmarshal(body, v)
+}
+
+// oidcJWK is a public key published by the IdP.
+type oidcJWK struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    N   string `json:"n"`
+    E   string `json:"e"`
+    Crv string `json:"crv"`
+    X   string `json:"x"`
+    Y   string `json:"y"`
+}
+
+func (j oidcJWK) publicKey() (crypto.PublicKey, error) {
+    b64 := base64.RawURLEncoding.DecodeString
+    switch j.Kty {
+    case "RSA":
+        n, err := b64(j.N)
+        if err != nil {
+            return nil, err
+        }
+        e, err := b64(j.E)
+        if err != nil {
+            return nil, err
+        }
+        return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+    case "EC":
+        var curve elliptic.Curve
+        switch j.Crv {
+        case "P-256":
+            curve = elliptic.P256()
+        case "P-384":
+            curve = elliptic.P384()
+        case "P-521":
+            curve = elliptic.P521()
+        default:
+            return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+        }
+        x, err := b64(j.X)
+        if err != nil {
+            return nil, err
+        }
+        y, err := b64(j.Y)
+        if err != nil {
+            return nil, err
+        }
+        return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+    case "OKP":
+        if j.Crv != "Ed25519" {
+            return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+        }
+        x, err := b64(j.X)
+        if err != nil {
+            return nil, err
+        }
+        return ed25519.PublicKey(x), nil
+    }
+    return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+    "strings"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/casbin/casbin/v2/util"
+    "github.com/gin-gonic/gin"
+)
+
+// Permission names something a route lets the caller do, as resource:action.
+// Routes declare the permission they need and the policy grants permissions
+// to roles ("p, teacher, assignment:manage"); a * in a policy matches the
+// rest of the name, e.g. "p, admin, user:*".
+type Permission string
+
+// Permissions of the API routes.
+const (
+    PermProfileManage        Permission = "profile:manage"
+    PermSchoolView           Permission = "school:view"
+    PermSchoolManage         Permission = "school:manage"
+    PermDistrictManage       Permission = "district:manage"
+    PermAssignmentView       Permission = "assignment:view"
+    PermAssignmentManage     Permission = "assignment:manage"
+    PermUserView             Permission = "user:view"
+    PermUserManage           Permission = "user:manage"
+    PermUserImpersonate      Permission = "user:impersonate"
+    PermServiceAccountManage Permission = "service_account:manage"
+    PermSystemManage         Permission = "system:manage"
+    PermGuardianLinkManage   Permission = "guardian_link:manage"
+    PermGuardianLinkRequest  Permission = "guardian_link:request"
+    PermGuardianView         Permission = "guardian:view"
+    PermInvitationManage     Permission = "invitation:manage"
+)
+
+// permissions describes every permission, in the order of the matrix.
+var permissions = []struct {
+    Permission  Permission
+    Description string
+}{
+    {PermProfileManage, "read and edit one's own profile"},
+    {PermSchoolView, "read schools"},
+    {PermSchoolManage, "edit schools"},
+    {PermDistrictManage, "create and delete schools"},
+    {PermAssignmentView, "read the assignments of one's courses"},
+    {PermAssignmentManage, "create, edit and delete the assignments of one's courses"},
+    {PermUserView, "read users, their profiles and roles"},
+    {PermUserManage, "create, import, edit and delete users, their roles, status and sessions"},
+    {PermUserImpersonate, "act as another user and read the impersonation log"},
+    {PermServiceAccountManage, "manage service accounts and their tokens"},
+    {PermSystemManage, "change the authorization policy"},
+    {PermGuardianLinkManage, "create, verify, reject and delete guardian links"},
+    {PermGuardianLinkRequest, "ask to be linked to a student as their guardian"},
+    {PermGuardianView, "read the records of linked students"},
+    {PermInvitationManage, "create and revoke invitation codes"},
+}
+
+// Permissions lists every permission, in the order of the matrix.
+func Permissions() []Permission {
+    list := make([]Permission, len(permissions))
+    for i, p := range permissions {
+        list[i] = p.Permission
+    }
+    return list
+}
+
+// Description says what the permission allows; "" for unknown ones.
+func (p Permission) Description() string {
+    for _, info := range permissions {
+        if info.Permission == p {
+            return info.Description
+        }
+    }
+    return ""
+}
+
+// MatchesPermission reports whether a policy object names a permission, or
+// with a *, at least one.
+func MatchesPermission(obj string) bool {
+    for _, p := range Permissions() {
+        if util.KeyMatch(string(p), obj) {
+            return true
+        }
+    }
+    return false
+}
+
+// Registry records the permission each protected route needs, for the
+// policy check and the permission matrix.
+type Registry struct {
+    e      *casbin.SyncedEnforcer
+    routes map[Route]Permission
+}
+
+// NewRegistry returns an empty registry whose routes are checked against e.
+func NewRegistry(e *casbin.SyncedEnforcer) *Registry {
+    return &Registry{e: e, routes: map[Route]Permission{}}
+}
+
+// Group registers routes on g through the registry.
+func (reg *Registry) Group(g *gin.RouterGroup) *RouteGroup {
+    return &RouteGroup{reg: reg, group: g}
+}
+
+// Permission returns the permission route needs and whether it has one.
+func (reg *Registry) Permission(route Route) (Permission, bool) {
+    p, ok := reg.routes[route]
+    return p, ok
+}
+
+// Routes returns the routes that need perm.
+func (reg *Registry) Routes(perm Permission) []Route {
+    var routes []Route
+    for route, p := range reg.routes {
+        if p == perm {
+            routes = append(routes, route)
+        }
+    }
+    sortRoutes(routes)
+    return routes
+}
+
+// RouteGroup is a gin router group whose routes each declare a permission.
+// RequirePermission checks it before the group's middleware and the handlers.
+type RouteGroup struct {
+    reg        *Registry
+    group      *gin.RouterGroup
+    middleware []gin.HandlerFunc
+}
+
+// Group returns a subgroup at relativePath whose routes also run middleware,
+// after the permission check.
+func (g *RouteGroup) Group(relativePath string, middleware ...gin.HandlerFunc) *RouteGroup {
+    return &RouteGroup{
+        reg:        g.reg,
+        group:      g.group.Group(relativePath),
+        middleware: append(append([]gin.HandlerFunc{}, g.middleware...), middleware...),
+    }
+}
+
+// Handle registers a route that needs perm.
+func (g *RouteGroup) Handle(method, relativePath string, perm Permission, handlers ...gin.HandlerFunc) {
+    chain := append([]gin.HandlerFunc{RequirePermission(g.reg.e, perm)}, g.middleware...)
+    g.group.Handle(method, relativePath, append(chain, handlers...)...)
+    path := strings.TrimSuffix(g.group.BasePath(), "/") + relativePath
+    g.reg.routes[Route{Method: method, Path: path}] = perm
+}
+
+func (g *RouteGroup) GET(relativePath string, perm Permission, handlers ...gin.HandlerFunc) {
+    g.Handle("GET", relativePath, perm, handlers...)
+}
+
+func (g *RouteGroup) POST(relativePath string, perm Permission, handlers ...gin.HandlerFunc) {
+    g.Handle("POST", relativePath, perm, handlers...)
+}
+
+func (g *RouteGroup) PUT(relativePath string, perm Permission, handlers ...gin.HandlerFunc) {
+    g.Handle("PUT", relativePath, perm, handlers...)
+}
+
+func (g *RouteGroup) DELETE(relativePath string, perm Permission, handlers ...gin.HandlerFunc) {
+    g.Handle("DELETE", relativePath, perm, handlers...)
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/casbin/casbin/v2/model"
+    "github.com/casbin/casbin/v2/persist"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// PolicyAdapter stores Casbin policies in the casbin_rule table.
+type PolicyAdapter struct {
+    db *gorm.DB
+}
+
+func NewPolicyAdapter(db *gorm.DB) *PolicyAdapter {
+    return &PolicyAdapter{db: db}
+}
+
+func ruleRow(ptype string, rule []string) models.CasbinRule {
+    r := models.CasbinRule{Ptype: ptype}
+    for i, v := range []*string{&r.V0, &r.V1, &r.V2, &r.V3, &r.V4, &r.V5} {
+        if i < len(rule) {
+            *v = rule[i]
+        }
+    }
+    return r
+}
+
+// LoadPolicy loads every rule into m.
+func (a *PolicyAdapter) LoadPolicy(m model.Model) error {
+    var rows []models.CasbinRule
+    if err := a.db.Order("id").Find(&rows).Error; err != nil {
+        return err
+    }
+    for _, r := range rows {
+        line := []string{r.Ptype, r.V0, r.V1, r.V2, r.V3, r.V4, r.V5}
+        // drop the unused trailing fields
+        for len(line) > 1 && line[len(line)-1] == "" {
+            line = line[:len(line)-1]
+        }
+        if err := persist.LoadPolicyArray(line, m); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// SavePolicy replaces the stored rules with those of m.
+func (a *PolicyAdapter) SavePolicy(m model.Model) error {
+    var rows []models.CasbinRule
+    for _, sec := range []string{"p", "g"} {
+        for ptype, ast := range m[sec] {
+            for _, rule := range ast.Policy {
+                rows = append(rows, ruleRow(ptype, rule))
+            }
+        }
+    }
+    return a.write(func(tx *gorm.DB) error {
+        if err := tx.Where("1 = 1").Delete(&models.CasbinRule{}).Error; err != nil {
+            return err
+        }
+        if len(rows) == 0 {
+            return nil
+        }
+        return tx.Create(&rows).Error
+    })
+}
+
+func (a *PolicyAdapter) AddPolicy(sec, ptype string, rule []string) error {
+    row := ruleRow(ptype, rule)
+    return a.write(func(tx *gorm.DB) error {
+        return tx.Create(&row).Error
+    })
+}
+
+func (a *PolicyAdapter) RemovePolicy(sec, ptype string, rule []string) error {
+    row := ruleRow(ptype, rule)
+    return a.write(func(tx *gorm.DB) error {
+        return tx.Where(&row, "ptype", "v0", "v1", "v2", "v3", "v4", "v5").Delete(&models.CasbinRule{}).Error
+    })
+}
+
+func (a *PolicyAdapter) RemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+    return a.write(func(tx *gorm.DB) error {
+        q := tx.Where("ptype = ?", ptype)
+        for i, v := range fieldValues {
+            if v != "" && fieldIndex+i < 6 {
+                q = q.Where(fmt.Sprintf("v%d = ?", fieldIndex+i), v)
+            }
+        }
+        return q.Delete(&models.CasbinRule{}).Error
+    })
+}
+
+// write runs fn and bumps the revision in one transaction.
+func (a *PolicyAdapter) write(fn func(tx *gorm.DB) error) error {
+    return a.db.Transaction(func(tx *gorm.DB) error {
+        if err := fn(tx); err != nil {
+            return err
+        }
+        return tx.Clauses(clause.OnConflict{
+            Columns: []clause.Column{{Name: "id"}},
+            DoUpdates: clause.Assignments(map[string]interface{}{
+                "revision":   gorm.Expr("casbin_rule_revision.revision + 1"),
+                "updated_at": time.Now(),
+            }),
+        }).Create(&models.CasbinRuleRevision{ID: 1, Revision: 1}).Error
+    })
+}
+
+// revision returns the change counter of the stored rules; 0 before the
+// first change. Besides the adapter's own writes, a trigger (migration 025)
+// counts rules changed by migrations or by hand.
+func (a *PolicyAdapter) revision() (int64, error) {
+    var r models.CasbinRuleRevision
+    err := a.db.First(&r, "id = ?", 1).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return 0, nil
+    }
+    return r.Revision, err
+}
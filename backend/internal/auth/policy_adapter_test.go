@@ -0,0 +1,61 @@
+package auth
+
+import (
+    "testing"
+
+    "github.com/casbin/casbin/v2/model"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestPolicyAdapterRevision(t *testing.T) {
+    db := testutil.NewDB(t, &models.CasbinRule{}, &models.CasbinRuleRevision{})
+    a := NewPolicyAdapter(db)
+    rev := func() int64 {
+        t.Helper()
+        r, err := a.revision()
+        if err != nil {
+            t.Fatal(err)
+        }
+        return r
+    }
+    if r := rev(); r != 0 {
+        t.Fatalf("revision %d before any change, want 0", r)
+    }
+
+    steps := []struct {
+        name    string
+        write   func() error
+        changed bool
+    }{
+        {"add", func() error { return a.AddPolicy("p", "p", []string{"teacher", "assignment:view"}) }, true},
+        {"add another", func() error { return a.AddPolicy("p", "p", []string{"student", "assignment:view"}) }, true},
+        {"add a duplicate", func() error { return a.AddPolicy("p", "p", []string{"student", "assignment:view"}) }, false},
+        {"remove", func() error { return a.RemovePolicy("p", "p", []string{"teacher", "assignment:view"}) }, true},
+        {"remove filtered", func() error { return a.RemoveFilteredPolicy("p", "p", 0, "student") }, true},
+    }
+    for _, st := range steps {
+        before := rev()
+        err := st.write()
+        if (err == nil) != st.changed {
+            t.Fatalf("%s: err %v", st.name, err)
+        }
+        if got := rev() != before; got != st.changed {
+            t.Errorf("%s: revision changed = %v, want %v", st.name, got, st.changed)
+        }
+    }
+
+    // reading the rules is no change
+    before := rev()
+    m, err := model.NewModelFromFile("../../config/rbac_model.conf")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := a.LoadPolicy(m); err != nil {
+        t.Fatal(err)
+    }
+    if rev() != before {
+        t.Error("loading the policy changed the revision")
+    }
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// Route is a method and full gin route path.
+type Route struct {
+    Method string
+    Path   string
+}
+
+func (r Route) String() string { return r.Method + " " + r.Path }
+
+// PolicyReport lists the mismatches between protected routes, the
+// permissions they need and the policy.
+type PolicyReport struct {
+    // protected routes registered without a permission
+    RoutesWithoutPermission []Route
+    // permissions that some route needs but no role has
+    PermissionsWithoutRole []Permission
+    // permissions that no route needs
+    PermissionsWithoutRoute []Permission
+    // policies (sub, obj) whose obj names no permission
+    PoliciesWithoutPermission [][]string
+    // path policies of the former format left unconverted (casbin_rule_legacy)
+    LegacyPolicies [][]string
+}
+
+// OK reports whether every route is covered and every policy is used.
+func (r *PolicyReport) OK() bool {
+    return len(r.RoutesWithoutPermission) == 0 && len(r.PermissionsWithoutRole) == 0 &&
+        len(r.PermissionsWithoutRoute) == 0 && len(r.PoliciesWithoutPermission) == 0 &&
+        len(r.LegacyPolicies) == 0
+}
+
+// Lines describes the mismatches, one per line.
+func (r *PolicyReport) Lines() []string {
+    var lines []string
+    for _, route := range r.RoutesWithoutPermission {
+        lines = append(lines, "route without permission: "+route.String())
+    }
+    for _, p := range r.PermissionsWithoutRole {
+        lines = append(lines, "permission without role: "+string(p))
+    }
+    for _, p := range r.PermissionsWithoutRoute {
+        lines = append(lines, "permission without route: "+string(p))
+    }
+    for _, p := range r.PoliciesWithoutPermission {
+        lines = append(lines, "policy without permission: p, "+strings.Join(p, ", "))
+    }
+    for _, p := range r.LegacyPolicies {
+        lines = append(lines, "path policy not converted to permissions (casbin_rule_legacy): p, "+strings.Join(p, ", "))
+    }
+    return lines
+}
+
+// ProtectedRoutes returns the routes of all that are not in before, i.e. the
+// ones registered after before was taken.
+func ProtectedRoutes(all, before gin.RoutesInfo) []Route {
+    seen := map[Route]bool{}
+    for _, r := range before {
+        seen[Route{r.Method, r.Path}] = true
+    }
+    var routes []Route
+    for _, r := range all {
+        if route := (Route{r.Method, r.Path}); !seen[route] {
+            routes = append(routes, route)
+        }
+    }
+    sortRoutes(routes)
+    return routes
+}
+
+func sortRoutes(routes []Route) {
+    sort.Slice(routes, func(i, j int) bool {
+        if routes[i].Path != routes[j].Path {
+            return routes[i].Path < routes[j].Path
+        }
+        return routes[i].Method < routes[j].Method
+    })
+}
+
+// policyRoles returns the roles named in the policies (any subject other
+// than an API token scope); roles that inherit from others, and users granted
+// a role, cannot have more permissions than these.
+func policyRoles(policies [][]string) map[string]bool {
+    roles := map[string]bool{}
+    for _, p := range policies {
+        if len(p) > 0 && !strings.HasPrefix(p[0], scopeSubjectPrefix) {
+            roles[p[0]] = true
+        }
+    }
+    return roles
+}
+
+// CheckPolicies compares the protected routes with the permissions registered
+// for them in reg and with the policy. Every route needs a permission, every
+// permission needed by a route some role, and every permission defined a
+// route; a policy must name a permission, or with a *, at least one.
+func CheckPolicies(e *casbin.SyncedEnforcer, reg *Registry, routes []Route) (*PolicyReport, error) {
+    policies, err := e.GetPolicy()
+    if err != nil {
+        return nil, err
+    }
+    roles := policyRoles(policies)
+
+    report := &PolicyReport{}
+    needed := map[Permission]bool{}
+    for _, route := range routes {
+        perm, ok := reg.Permission(route)
+        if !ok {
+            report.RoutesWithoutPermission = append(report.RoutesWithoutPermission, route)
+            continue
+        }
+        needed[perm] = true
+    }
+    for _, perm := range Permissions() {
+        if !needed[perm] {
+            report.PermissionsWithoutRoute = append(report.PermissionsWithoutRoute, perm)
+            continue
+        }
+        granted := false
+        for role := range roles {
+            ok, err := e.Enforce(role, AllSchools, string(perm))
+            if err != nil {
+                return nil, fmt.Errorf("enforce %s for %s: %w", role, perm, err)
+            }
+            if ok {
+                granted = true
+                break
+            }
+        }
+        if !granted {
+            report.PermissionsWithoutRole = append(report.PermissionsWithoutRole, perm)
+        }
+    }
+    for _, p := range policies {
+        if len(p) < 2 || !MatchesPermission(p[1]) {
+            report.PoliciesWithoutPermission = append(report.PoliciesWithoutPermission, p)
+        }
+    }
+    return report, nil
+}
+
+// LegacyPolicies returns the path policies that migration 023 could not
+// convert, as (sub, path, methods).
+func LegacyPolicies(db *gorm.DB) ([][]string, error) {
+    var rows []models.LegacyCasbinRule
+    if err := db.Order("id").Find(&rows).Error; err != nil {
+        return nil, err
+    }
+    list := make([][]string, 0, len(rows))
+    for _, r := range rows {
+        list = append(list, []string{r.V0, r.V1, r.V2})
+    }
+    return list, nil
+}
+
+// PermissionMatrix renders which role has which permission, with the routes
+// that need it, and the permissions of the API token scopes as Markdown.
+// Roles are taken from the policy, so it shows the policy in effect.
+func PermissionMatrix(e *casbin.SyncedEnforcer, reg *Registry) (string, error) {
+    policies, err := e.GetPolicy()
+    if err != nil {
+        return "", err
+    }
+    roles := policyRoles(policies)
+    var columns []string
+    for _, role := range []string{models.RoleDistrictAdmin, models.RoleAdmin, models.RoleTeacher, models.RoleStudent, models.RoleGuardian} {
+        if roles[role] {
+            columns = append(columns, role)
+            delete(roles, role)
+        }
+    }
+    var others []string
+    for role := range roles {
+        others = append(others, role)
+    }
+    sort.Strings(others)
+    columns = append(columns, others...)
+
+    var b strings.Builder
+    b.WriteString("# Roles and permissions\n\n")
+    b.WriteString("Generated by `go run ./cmd/api permissions` from the permission registry\n")
+    b.WriteString("(internal/auth/permission.go) and the policy; do not edit.\n\n")
+    b.WriteString("| Permission | Allows | Routes | " + strings.Join(columns, " | ") + " |\n")
+    b.WriteString("|---|---|---|" + strings.Repeat("---|", len(columns)) + "\n")
+    for _, perm := range Permissions() {
+        var routes []string
+        for _, route := range reg.Routes(perm) {
+            routes = append(routes, "`"+route.String()+"`")
+        }
+        b.WriteString("| `" + string(perm) + "` | " + perm.Description() + " | " + strings.Join(routes, "<br>") + " |")
+        for _, role := range columns {
+            ok, err := e.Enforce(role, AllSchools, string(perm))
+            if err != nil {
+                return "", err
+            }
+            if ok {
+                b.WriteString(" ✓ |")
+            } else {
+                b.WriteString("  |")
+            }
+        }
+        b.WriteString("\n")
+    }
+
+    b.WriteString("\nAPI tokens act with their owner's permissions, limited to those of their scopes.\n\n")
+    b.WriteString("| Scope | Permissions |\n|---|---|\n")
+    for _, scope := range Scopes(e) {
+        var perms []string
+        for _, perm := range Permissions() {
+            if ok, err := e.Enforce(scopeSubjectPrefix+scope, AllSchools, string(perm)); err == nil && ok {
+                perms = append(perms, "`"+string(perm)+"`")
+            }
+        }
+        b.WriteString("| `" + scope + "` | " + strings.Join(perms, ", ") + " |\n")
+    }
+    return b.String(), nil
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/casbin/casbin/v2/model"
+    "github.com/casbin/casbin/v2/util"
+    "github.com/gin-gonic/gin"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+// newTestEnforcer returns an enforcer with the shipped model and the given
+// rules, "p, sub, obj" or "g, member, role, school".
+func newTestEnforcer(t *testing.T, rules ...string) *casbin.SyncedEnforcer {
+    t.Helper()
+    m, err := model.NewModelFromFile("../../config/rbac_model.conf")
+    if err != nil {
+        t.Fatal(err)
+    }
+    e, err := casbin.NewSyncedEnforcer(m)
+    if err != nil {
+        t.Fatal(err)
+    }
+    e.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
+    for _, rule := range rules {
+        fields := strings.Split(rule, ", ")
+        if fields[0] == "g" {
+            _, err = e.AddGroupingPolicy(fields[1:])
+        } else {
+            _, err = e.AddPolicy(fields[1:])
+        }
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    return e
+}
+
+// newTestRegistry registers a GET route for every permission but skip, plus
+// unregistered routes on the same group, and returns the protected routes.
+func newTestRegistry(e *casbin.SyncedEnforcer, skip Permission, unregistered ...string) (*Registry, []Route) {
+    r := gin.New()
+    before := r.Routes()
+    reg := NewRegistry(e)
+    g := reg.Group(r.Group("/api/v1"))
+    noop := func(c *gin.Context) {}
+    for _, perm := range Permissions() {
+        if perm != skip {
+            g.GET("/"+strings.ReplaceAll(string(perm), ":", "/"), perm, noop)
+        }
+    }
+    for _, path := range unregistered {
+        r.GET("/api/v1"+path, noop)
+    }
+    return reg, ProtectedRoutes(r.Routes(), before)
+}
+
+func TestCheckPolicies(t *testing.T) {
+    // every permission but keep
+    except := func(keep ...Permission) []Permission {
+        var list []Permission
+        for _, p := range Permissions() {
+            found := false
+            for _, k := range keep {
+                found = found || k == p
+            }
+            if !found {
+                list = append(list, p)
+            }
+        }
+        return list
+    }
+
+    for _, tc := range []struct {
+        name         string
+        rules        []string
+        skip         Permission
+        unregistered []string
+        want         PolicyReport
+    }{
+        {name: "covered", rules: []string{"p, admin, *"}},
+        {name: "route without permission", rules: []string{"p, admin, *"}, unregistered: []string{"/reports"},
+            want: PolicyReport{RoutesWithoutPermission: []Route{{"GET", "/api/v1/reports"}}}},
+        {name: "permission without route", rules: []string{"p, admin, *"}, skip: PermInvitationManage,
+            want: PolicyReport{PermissionsWithoutRoute: []Permission{PermInvitationManage}}},
+        {name: "wildcard grants part", rules: []string{"p, admin, user:*"},
+            want: PolicyReport{PermissionsWithoutRole: except(PermUserView, PermUserManage, PermUserImpersonate)}},
+        // scopes only narrow what a role may do; they are no role
+        {name: "granted to a scope only", rules: []string{"p, admin, user:*", "p, scope:schools:read, school:view"},
+            want: PolicyReport{PermissionsWithoutRole: except(PermUserView, PermUserManage, PermUserImpersonate)}},
+        {name: "inherited", rules: []string{"p, admin, *", "p, district_admin, grades:view", "g, district_admin, admin, *"},
+            want: PolicyReport{PoliciesWithoutPermission: [][]string{{"district_admin", "grades:view"}}}},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            e := newTestEnforcer(t, tc.rules...)
+            reg, routes := newTestRegistry(e, tc.skip, tc.unregistered...)
+            got, err := CheckPolicies(e, reg, routes)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(*got, tc.want) {
+                t.Errorf("report\n%+v\nwant\n%+v", *got, tc.want)
+            }
+            if got.OK() != (len(tc.want.Lines()) == 0) {
+                t.Errorf("OK() = %v with %d mismatches", got.OK(), len(got.Lines()))
+            }
+        })
+    }
+}
+
+func TestLegacyPolicies(t *testing.T) {
+    db := testutil.NewDB(t, &models.LegacyCasbinRule{})
+    for _, r := range []models.LegacyCasbinRule{
+        {Ptype: "p", V0: "scope:users:write", V1: "/api/v1/users/*", V2: "(GET)|(POST)"},
+        {Ptype: "p", V0: "teacher", V1: "/api/v1/grades", V2: "GET"},
+    } {
+        if err := db.Create(&r).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+    list, err := LegacyPolicies(db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := [][]string{{"scope:users:write", "/api/v1/users/*", "(GET)|(POST)"}, {"teacher", "/api/v1/grades", "GET"}}
+    if !reflect.DeepEqual(list, want) {
+        t.Fatalf("LegacyPolicies = %q, want %q", list, want)
+    }
+
+    report := &PolicyReport{LegacyPolicies: list}
+    if report.OK() {
+        t.Error("report with legacy policies is OK")
+    }
+    lines := report.Lines()
+    if len(lines) != 2 || !strings.Contains(lines[1], "p, teacher, /api/v1/grades, GET") {
+        t.Errorf("Lines = %q", lines)
+    }
+}
+
+func TestPermissionMatrix(t *testing.T) {
+    e := newTestEnforcer(t,
+        "p, guardian, guardian:view",
+        "p, teacher, assignment:*",
+        "p, admin, user:view",
+        "p, auditor, user:view",
+        "p, scope:users:read, user:view",
+        "g, district_admin, admin, *",
+        "p, district_admin, district:manage",
+    )
+    reg, _ := newTestRegistry(e, "")
+    matrix, err := PermissionMatrix(e, reg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, want := range []string{
+        // known roles first in their usual order, then the others by name
+        "| Permission | Allows | Routes | district_admin | admin | teacher | guardian | auditor |\n",
+        "| `assignment:manage` | " + PermAssignmentManage.Description() + " | `GET /api/v1/assignment/manage` |  |  | ✓ |  |  |\n",
+        // district admins inherit the permissions of admins
+        "| `user:view` | " + PermUserView.Description() + " | `GET /api/v1/user/view` | ✓ | ✓ |  |  | ✓ |\n",
+        "| `users:read` | `user:view` |\n",
+    } {
+        if !strings.Contains(matrix, want) {
+            t.Errorf("matrix lacks %q:\n%s", want, matrix)
+        }
+    }
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+    "crypto/rand"
+    "errors"
+    "math/big"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// UnusablePasswordHash never matches any password. Accounts that sign in
+// through an external identity source, and accounts whose password an admin
+// invalidated, carry it.
+const UnusablePasswordHash = "!"
+
+var (
+    ErrNoAccount = errors.New("no matching user and sign-up is disabled")
+    ErrNoRole    = errors.New("no role mapped for user")
+    // the local account with the same email never proved it owns the address
+    ErrLinkUnverified = errors.New("matching user has not verified their email")
+    // neither the identity nor the policy names an existing school
+    ErrNoSchool = errors.New("no school for user")
+    // the matching local user is an admin and the policy keeps them local
+    ErrLinkPrivileged = errors.New("matching user is an admin")
+)
+
+// rolePrecedence decides between several mapped roles; the highest wins.
+var rolePrecedence = map[string]int{models.RoleGuardian: 1, models.RoleStudent: 2, models.RoleTeacher: 3, models.RoleAdmin: 4, models.RoleDistrictAdmin: 5}
+
+// ExternalIdentity is a user as asserted by an external identity source.
+type ExternalIdentity struct {
+    // the source (OIDC issuer, LDAP URL) and its stable id for the user
+    Issuer  string
+    Subject string
+    // preferred username for a new account
+    Username      string
+    Email         string
+    EmailVerified bool
+    // mapped role, "" when none of the user's groups is mapped
+    Role string
+    // code of the user's school, "" when the source does not name one
+    School string
+}
+
+// ProvisionPolicy decides how external identities become local users.
+type ProvisionPolicy struct {
+    AllowSignup     bool
+    LinkByEmail     bool
+    LinkByUsername  bool
+    SyncRole        bool
+    DefaultRole     string
+    DefaultSchool   string
+    // link to and change the role of admin and district_admin accounts
+    AllowPrivileged bool
+}
+
+// privileged reports whether role is kept away from external sources unless
+// the policy allows it.
+func privileged(role string) bool {
+    return role == models.RoleAdmin || role == models.RoleDistrictAdmin
+}
+
+// MapRole returns the highest role mapped from any of values, or "".
+func MapRole(mappings []config.RoleMapping, values []string) string {
+    role := ""
+    for _, v := range values {
+        for _, m := range mappings {
+            if strings.EqualFold(m.Value, v) && rolePrecedence[m.Role] > rolePrecedence[role] {
+                role = m.Role
+            }
+        }
+    }
+    return role
+}
+
+// ProvisionUser returns the local user behind an external identity. Unknown
+// identities are linked to an existing user or get a new account, as the
+// policy allows; the link is remembered in user_identities.
+func ProvisionUser(db *gorm.DB, id ExternalIdentity, p ProvisionPolicy) (*models.User, error) {
+    var user models.User
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var ident models.UserIdentity
+        err := tx.Where("issuer = ? AND subject = ?", id.Issuer, id.Subject).First(&ident).Error
+        switch {
+        case err == nil:
+            if err := tx.First(&user, "id = ?", ident.UserID).Error; err != nil {
+                return ErrNoAccount
+            }
+        case !errors.Is(err, gorm.ErrRecordNotFound):
+            return err
+        default:
+            linked, err := linkUser(tx, id, p, &user)
+            if err != nil {
+                return err
+            }
+            if !linked {
+                if !p.AllowSignup {
+                    return ErrNoAccount
+                }
+                if err := createExternalUser(tx, id, p, &user); err != nil {
+                    return err
+                }
+            }
+            ident = models.UserIdentity{UserID: user.ID, Issuer: id.Issuer, Subject: id.Subject, Email: id.Email}
+            if err := tx.Create(&ident).Error; err != nil {
+                return err
+            }
+        }
+
+        if p.SyncRole && id.Role != "" && user.Role != id.Role && (p.AllowPrivileged || !privileged(user.Role)) {
+            if err := tx.Model(&user).Update("role", id.Role).Error; err != nil {
+                return err
+            }
+            user.Role = id.Role
+        }
+        return tx.Model(&ident).Updates(map[string]interface{}{"last_login_at": time.Now(), "email": id.Email}).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+// linkUser finds an existing user for an identity seen for the first time.
+// Users found by email must have verified it; admins are only linked when
+// the policy allows it.
+func linkUser(tx *gorm.DB, id ExternalIdentity, p ProvisionPolicy, user *models.User) (bool, error) {
+    var q *gorm.DB
+    byEmail := false
+    switch {
+    case p.LinkByUsername && id.Username != "":
+        q = tx.Where("LOWER(username) = ?", strings.ToLower(id.Username))
+    case p.LinkByEmail && id.EmailVerified && id.Email != "":
+        q = tx.Where("LOWER(email) = ?", strings.ToLower(id.Email))
+        byEmail = true
+    default:
+        return false, nil
+    }
+    err := q.First(user).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    // anyone can register an address they do not own; linking such an
+    // account would let its password sign in as the IdP user
+    if byEmail && user.EmailVerifiedAt == nil {
+        return false, ErrLinkUnverified
+    }
+    if !p.AllowPrivileged && privileged(user.Role) {
+        return false, ErrLinkPrivileged
+    }
+    return true, nil
+}
+
+// createExternalUser creates the account for a first external login in the
+// school the identity names, or else the policy's default school. It has no
+// usable password; the external source is its way in.
+func createExternalUser(tx *gorm.DB, id ExternalIdentity, p ProvisionPolicy, user *models.User) error {
+    role := id.Role
+    if role == "" {
+        role = p.DefaultRole
+    }
+    if role == "" {
+        return ErrNoRole
+    }
+    if id.Email == "" {
+        return errors.New("identity has no email address")
+    }
+    // every user but a district admin belongs to a school
+    var schoolID *string
+    if code := id.School; code != "" || p.DefaultSchool != "" {
+        if code == "" {
+            code = p.DefaultSchool
+        }
+        var school models.School
+        err := tx.First(&school, "code = ?", code).Error
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return ErrNoSchool
+        }
+        if err != nil {
+            return err
+        }
+        schoolID = &school.ID
+    } else if role != models.RoleDistrictAdmin {
+        return ErrNoSchool
+    }
+
+    base := id.Username
+    if base == "" {
+        base = strings.SplitN(id.Email, "@", 2)[0]
+    }
+    if len(base) > 40 {
+        base = base[:40]
+    }
+    username := base
+    for i := 0; ; i++ {
+        var n int64
+        if err := tx.Model(&models.User{}).Unscoped().Where("username = ?", username).Count(&n).Error; err != nil {
+            return err
+        }
+        if n == 0 && len(username) >= 3 {
+            break
+        }
+        if i == 5 {
+            return errors.New("could not find a free username")
+        }
+        username = base + "-" + randomDigits(4)
+    }
+
+    *user = models.User{
+        Username:     username,
+        Email:        id.Email,
+        PasswordHash: UnusablePasswordHash,
+        Role:         role,
+        Status:       models.StatusActive,
+        Kind:         models.KindHuman,
+        SchoolID:     schoolID,
+    }
+    if id.EmailVerified {
+        now := time.Now()
+        user.EmailVerifiedAt = &now
+    }
+    return tx.Create(user).Error
+}
+
+// randomDigits returns n random decimal digits.
+func randomDigits(n int) string {
+    b := make([]byte, n)
+    for i := range b {
+        v, _ := rand.Int(rand.Reader, big.NewInt(10))
+        b[i] = byte('0' + v.Int64())
+    }
+    return string(b)
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+    "errors"
+    "testing"
+
+    "github.com/go-ldap/ldap/v3"
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+const testLDAPURL = "ldaps://ldap.example.org"
+
+// ldapIdentity is a directory user of school NORTH as the LDAP authenticator sees them.
+func ldapIdentity(username, role string) ExternalIdentity {
+    return ExternalIdentity{
+        Issuer: testLDAPURL, Subject: username, Username: username,
+        Email: username + "@example.org", EmailVerified: true, Role: role, School: "NORTH",
+    }
+}
+
+// newProvisionDB returns a database with the schools NORTH and SOUTH.
+func newProvisionDB(t *testing.T) *gorm.DB {
+    db := testutil.NewDB(t, &models.School{}, &models.User{}, &models.UserIdentity{})
+    for _, code := range []string{"NORTH", "SOUTH"} {
+        if err := db.Create(&models.School{Name: code, Code: code}).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+    return db
+}
+
+func TestProvisionUserFromLDAP(t *testing.T) {
+    tests := []struct {
+        name     string
+        local    string // role of an existing local user with the same username
+        id       string // role from the directory
+        policy   ProvisionPolicy
+        wantErr  error
+        wantRole string
+        linked   bool
+    }{
+        {name: "new user", id: models.RoleTeacher,
+            policy: ProvisionPolicy{AllowSignup: true}, wantRole: models.RoleTeacher},
+        {name: "new user without a mapped role", policy: ProvisionPolicy{AllowSignup: true}, wantErr: ErrNoRole},
+        {name: "new user falls back to the default role",
+            policy: ProvisionPolicy{AllowSignup: true, DefaultRole: models.RoleStudent}, wantRole: models.RoleStudent},
+        {name: "new user with signup disabled", id: models.RoleTeacher, wantErr: ErrNoAccount},
+        {name: "existing user is not linked by default", local: models.RoleStudent, id: models.RoleTeacher,
+            policy: ProvisionPolicy{AllowSignup: true}, wantRole: models.RoleTeacher},
+        {name: "existing user linked", local: models.RoleStudent, id: models.RoleTeacher,
+            policy: ProvisionPolicy{LinkByUsername: true, SyncRole: true}, wantRole: models.RoleTeacher, linked: true},
+        {name: "existing user keeps their role", local: models.RoleStudent, id: models.RoleTeacher,
+            policy: ProvisionPolicy{LinkByUsername: true}, wantRole: models.RoleStudent, linked: true},
+        {name: "admin is not linked", local: models.RoleAdmin, id: models.RoleTeacher,
+            policy: ProvisionPolicy{LinkByUsername: true, SyncRole: true}, wantErr: ErrLinkPrivileged},
+        {name: "district admin is not linked", local: models.RoleDistrictAdmin, id: models.RoleAdmin,
+            policy: ProvisionPolicy{LinkByUsername: true, SyncRole: true}, wantErr: ErrLinkPrivileged},
+        {name: "admin linked when allowed", local: models.RoleAdmin, id: models.RoleTeacher,
+            policy: ProvisionPolicy{LinkByUsername: true, SyncRole: true, AllowPrivileged: true}, wantRole: models.RoleTeacher, linked: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db := newProvisionDB(t)
+            var local models.User
+            if tt.local != "" {
+                local = models.User{Username: "ana", Email: "ana.local@example.org", PasswordHash: "hash", Role: tt.local, Status: models.StatusActive}
+                if err := db.Create(&local).Error; err != nil {
+                    t.Fatal(err)
+                }
+            }
+
+            user, err := ProvisionUser(db, ldapIdentity("ana", tt.id), tt.policy)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("err %v, want %v", err, tt.wantErr)
+            }
+            if err != nil {
+                var n int64
+                db.Model(&models.UserIdentity{}).Count(&n)
+                if n != 0 {
+                    t.Errorf("%d identities after a refused login", n)
+                }
+                return
+            }
+            if user.Role != tt.wantRole {
+                t.Errorf("role %q, want %q", user.Role, tt.wantRole)
+            }
+            if got := user.ID == local.ID; got != tt.linked {
+                t.Errorf("linked to the local user = %v, want %v", got, tt.linked)
+            }
+            if !tt.linked && user.PasswordHash != UnusablePasswordHash {
+                t.Errorf("new user %q has a usable password", user.Username)
+            }
+        })
+    }
+}
+
+func TestProvisionUserKeepsAdminRoleOnSync(t *testing.T) {
+    db := newProvisionDB(t)
+    policy := ProvisionPolicy{AllowSignup: true, SyncRole: true}
+    user, err := ProvisionUser(db, ldapIdentity("ana", models.RoleTeacher), policy)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // promoted locally; a directory group must not take it back
+    db.Model(user).Update("role", models.RoleAdmin)
+
+    user, err = ProvisionUser(db, ldapIdentity("ana", models.RoleStudent), policy)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if user.Role != models.RoleAdmin {
+        t.Errorf("role %q after sync, want admin", user.Role)
+    }
+
+    policy.AllowPrivileged = true
+    if user, _ = ProvisionUser(db, ldapIdentity("ana", models.RoleStudent), policy); user.Role != models.RoleStudent {
+        t.Errorf("role %q after sync with privileged accounts allowed, want student", user.Role)
+    }
+}
+
+func TestProvisionUserSchool(t *testing.T) {
+    tests := []struct {
+        name          string
+        school        string
+        defaultSchool string
+        role          string
+        want          string // school code, "" for none
+        wantErr       error
+    }{
+        {"from the directory", "SOUTH", "NORTH", models.RoleTeacher, "SOUTH", nil},
+        {"default school", "", "NORTH", models.RoleTeacher, "NORTH", nil},
+        {"unknown school", "WEST", "NORTH", models.RoleTeacher, "", ErrNoSchool},
+        {"unknown default school", "", "WEST", models.RoleStudent, "", ErrNoSchool},
+        {"no school", "", "", models.RoleStudent, "", ErrNoSchool},
+        {"school admin without a school", "", "", models.RoleAdmin, "", ErrNoSchool},
+        {"district admin without a school", "", "", models.RoleDistrictAdmin, "", nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db := newProvisionDB(t)
+            id := ldapIdentity("ana", tt.role)
+            id.School = tt.school
+            user, err := ProvisionUser(db, id, ProvisionPolicy{AllowSignup: true, DefaultSchool: tt.defaultSchool})
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("err %v, want %v", err, tt.wantErr)
+            }
+            if err != nil {
+                var n int64
+                db.Model(&models.User{}).Count(&n)
+                if n != 0 {
+                    t.Errorf("%d users created without a school", n)
+                }
+                return
+            }
+            got := ""
+            if user.SchoolID != nil {
+                var s models.School
+                db.First(&s, "id = ?", *user.SchoolID)
+                got = s.Code
+            }
+            if got != tt.want {
+                t.Errorf("school %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestLDAPRole(t *testing.T) {
+    a := NewLDAPAuthenticator(nil, config.LDAPConfig{
+        RoleAttribute: "memberOf",
+        RoleMappings: []config.RoleMapping{
+            {Value: "teachers", Role: models.RoleTeacher},
+            {Value: "cn=school-admins,ou=groups,dc=example,dc=org", Role: models.RoleAdmin},
+        },
+    })
+    tests := []struct {
+        name   string
+        groups []string
+        want   string
+    }{
+        {"group dn matched on its cn", []string{"cn=teachers,ou=groups,dc=example,dc=org"}, models.RoleTeacher},
+        {"full dn", []string{"cn=school-admins,ou=groups,dc=example,dc=org"}, models.RoleAdmin},
+        {"highest role wins", []string{"cn=teachers,ou=groups,dc=example,dc=org", "cn=school-admins,ou=groups,dc=example,dc=org"}, models.RoleAdmin},
+        {"unmapped", []string{"cn=staff,ou=groups,dc=example,dc=org"}, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            entry := ldap.NewEntry("uid=ana,ou=people,dc=example,dc=org", map[string][]string{"memberOf": tt.groups})
+            if got := a.role(entry); got != tt.want {
+                t.Errorf("role %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
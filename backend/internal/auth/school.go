@@ -0,0 +1,110 @@
+package auth
+
+import (
+    "sort"
+
+    "github.com/casbin/casbin/v2"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// Membership is the role a user acts with in a school. SchoolID "" stands for
+// no school, or for district admins, for all schools at once.
+type Membership struct {
+    SchoolID string `json:"school_id"`
+    Role     string `json:"role"`
+}
+
+// HomeMembership is the user's own role in their own school (users.role and
+// users.school_id). API tokens always act with it.
+func HomeMembership(user *models.User) Membership {
+    m := Membership{Role: user.Role}
+    if user.SchoolID != nil {
+        m.SchoolID = *user.SchoolID
+    }
+    return m
+}
+
+// RoleInSchool returns the role user acts with in schoolID, or "" when they
+// have none there: the highest of their home role, if schoolID is their
+// school or they are a district admin, and the roles granted to them in that
+// school ("g, <user id>, role, school", or school * for every school).
+func RoleInSchool(e *casbin.SyncedEnforcer, user *models.User, schoolID string) string {
+    role := ""
+    if HomeMembership(user).SchoolID == schoolID || user.Role == models.RoleDistrictAdmin {
+        role = user.Role
+    }
+    for _, r := range e.GetRolesForUserInDomain(user.ID, schoolID) {
+        if rolePrecedence[r] > rolePrecedence[role] {
+            role = r
+        }
+    }
+    return role
+}
+
+// Memberships lists the schools user may act in with their role there: the
+// home school first, then the schools of their grants by id. A home
+// membership without a school comes last.
+func Memberships(e *casbin.SyncedEnforcer, user *models.User) []Membership {
+    home := HomeMembership(user).SchoolID
+    var granted []string
+    grants, _ := e.GetFilteredGroupingPolicy(0, user.ID)
+    for _, g := range grants {
+        if len(g) >= 3 && g[2] != AllSchools && g[2] != home {
+            granted = append(granted, g[2])
+        }
+    }
+    sort.Strings(granted)
+
+    schools := granted
+    if home != "" {
+        schools = append([]string{home}, granted...)
+    } else {
+        schools = append(schools, home)
+    }
+    var list []Membership
+    for i, s := range schools {
+        if i > 0 && s == schools[i-1] {
+            continue
+        }
+        if role := RoleInSchool(e, user, s); role != "" {
+            list = append(list, Membership{SchoolID: s, Role: role})
+        }
+    }
+    return list
+}
+
+// DefaultMembership is the school and role a new session starts with.
+func DefaultMembership(e *casbin.SyncedEnforcer, user *models.User) Membership {
+    if list := Memberships(e, user); len(list) > 0 {
+        return list[0]
+    }
+    return HomeMembership(user)
+}
+
+// EffectiveRoles lists every role user acts with in any school they may act
+// in, together with the roles those inherit, e.g. admin for a district admin
+// ("g, district_admin, admin, *").
+func EffectiveRoles(e *casbin.SyncedEnforcer, user *models.User) []string {
+    seen := map[string]bool{}
+    var roles []string
+    add := func(role string) {
+        if role != "" && !seen[role] {
+            seen[role] = true
+            roles = append(roles, role)
+        }
+    }
+    for _, m := range Memberships(e, user) {
+        add(m.Role)
+        school := m.SchoolID
+        if school == "" {
+            school = AllSchools
+        }
+        inherited, _ := e.GetImplicitRolesForUser(m.Role, school)
+        for _, r := range inherited {
+            add(r)
+        }
+    }
+    add(user.Role)
+    return roles
+}
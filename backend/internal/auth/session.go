@@ -0,0 +1,56 @@
+package auth
+
+import (
+    "sync"
+    "time"
+
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// sessionTrackerMaxEntries bounds the map of recent writes; stale entries are dropped once it is reached.
+const sessionTrackerMaxEntries = 10000
+
+// SessionTracker records when a session was last used. To keep AuthMiddleware
+// cheap, last_seen_at of a session is written at most once per interval.
+//
+// A nil *SessionTracker is valid and records nothing.
+type SessionTracker struct {
+    db       *gorm.DB
+    interval time.Duration
+
+    mu      sync.Mutex
+    written map[string]time.Time // session id -> last write
+}
+
+func NewSessionTracker(db *gorm.DB, interval time.Duration) *SessionTracker {
+    return &SessionTracker{db: db, interval: interval, written: map[string]time.Time{}}
+}
+
+// Touch marks the session as seen now.
+func (t *SessionTracker) Touch(sessionID string) error {
+    if t == nil || sessionID == "" {
+        return nil
+    }
+    now := time.Now()
+    t.mu.Lock()
+    last, ok := t.written[sessionID]
+    if ok && now.Sub(last) < t.interval {
+        t.mu.Unlock()
+        return nil
+    }
+    if len(t.written) >= sessionTrackerMaxEntries {
+        for id, at := range t.written {
+            if now.Sub(at) >= t.interval {
+                delete(t.written, id)
+            }
+        }
+    }
+    t.written[sessionID] = now
+    t.mu.Unlock()
+
+    return t.db.Model(&models.Session{}).
+        Where("id = ? AND revoked_at IS NULL", sessionID).
+        Update("last_seen_at", now).Error
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+    "testing"
+    "time"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestSessionTrackerTouch(t *testing.T) {
+    db := testutil.NewDB(t, &models.Session{})
+    long := time.Now().Add(-time.Hour)
+    s := models.Session{
+        ID: "1c9f0d1e-0000-4000-8000-000000000001", UserID: "7b0c3e9a-0d6f-4c43-9a53-3f1c1a2b4c5d",
+        LastSeenAt: long, ExpiresAt: time.Now().Add(time.Hour),
+    }
+    if err := db.Create(&s).Error; err != nil {
+        t.Fatal(err)
+    }
+    lastSeen := func() time.Time {
+        var got models.Session
+        db.First(&got, "id = ?", s.ID)
+        return got.LastSeenAt
+    }
+    tr := NewSessionTracker(db, time.Minute)
+
+    if err := tr.Touch(s.ID); err != nil {
+        t.Fatal(err)
+    }
+    first := lastSeen()
+    if !first.After(long) {
+        t.Fatalf("last_seen_at %v not updated", first)
+    }
+    // within the interval nothing is written
+    db.Model(&models.Session{}).Where("id = ?", s.ID).Update("last_seen_at", long)
+    if err := tr.Touch(s.ID); err != nil {
+        t.Fatal(err)
+    }
+    if got := lastSeen(); !got.Equal(long) {
+        t.Errorf("second touch within the interval wrote last_seen_at %v", got)
+    }
+
+    // revoked sessions are left alone
+    other := NewSessionTracker(db, time.Minute)
+    db.Model(&models.Session{}).Where("id = ?", s.ID).Update("revoked_at", time.Now())
+    if err := other.Touch(s.ID); err != nil {
+        t.Fatal(err)
+    }
+    if got := lastSeen(); !got.Equal(long) {
+        t.Errorf("touch of a revoked session wrote last_seen_at %v", got)
+    }
+
+    var nilTracker *SessionTracker
+    if err := nilTracker.Touch(s.ID); err != nil {
+        t.Errorf("nil tracker: %v", err)
+    }
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+    "errors"
+    "sync"
+    "time"
+
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// statusCacheMaxEntries bounds the cache; expired entries are dropped once it is reached.
+const statusCacheMaxEntries = 10000
+
+// StatusCache answers "is this account still active?" for AuthMiddleware.
+// Each user's status is read from the DB at most once per ttl, so a user who
+// is suspended after a token was issued is locked out within ttl without a
+// query on every request.
+//
+// A nil *StatusCache is valid and reports every user as active.
+type StatusCache struct {
+    db  *gorm.DB
+    ttl time.Duration
+
+    mu      sync.Mutex
+    entries map[string]statusEntry
+}
+
+type statusEntry struct {
+    status    string
+    expiresAt time.Time
+}
+
+func NewStatusCache(db *gorm.DB, ttl time.Duration) *StatusCache {
+    return &StatusCache{db: db, ttl: ttl, entries: map[string]statusEntry{}}
+}
+
+// Status returns the account status of a user. Users that no longer exist
+// are reported as inactive.
+func (s *StatusCache) Status(userID string) (string, error) {
+    if s == nil {
+        return models.StatusActive, nil
+    }
+    now := time.Now()
+    s.mu.Lock()
+    e, ok := s.entries[userID]
+    s.mu.Unlock()
+    if ok && now.Before(e.expiresAt) {
+        return e.status, nil
+    }
+
+    var user models.User
+    status := models.StatusInactive
+    err := s.db.Select("status").First(&user, "id = ?", userID).Error
+    switch {
+    case err == nil:
+        status = user.Status
+    case !errors.Is(err, gorm.ErrRecordNotFound):
+        return "", err
+    }
+
+    s.mu.Lock()
+    if len(s.entries) >= statusCacheMaxEntries {
+        for id, e := range s.entries {
+            if !now.Before(e.expiresAt) {
+                delete(s.entries, id)
+            }
+        }
+    }
+    s.entries[userID] = statusEntry{status: status, expiresAt: now.Add(s.ttl)}
+    s.mu.Unlock()
+    return status, nil
+}
+
+// Invalidate drops the cached status of a user so that a change made by this
+// instance applies immediately; other instances pick it up within ttl.
+func (s *StatusCache) Invalidate(userID string) {
+    if s == nil {
+        return
+    }
+    s.mu.Lock()
+    delete(s.entries, userID)
+    s.mu.Unlock()
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+    "crypto/rand"
+    "errors"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+)
+
+// Values of the typ claim. Only access tokens are accepted by AuthMiddleware.
+const (
+    TokenTypeAccess = "access"
+    TokenTypeMFA    = "mfa"
+)
+
+// Purposes of an MFA challenge token.
+const (
+    MFAPurposeVerify = "verify"
+    MFAPurposeEnroll = "enroll"
+)
+
+var errWrongTokenType = errors.New("wrong token type")
+
+// GenerateAccessToken signs a short-lived access token for the given user and
+// session, acting in the school and with the role of m. Every token carries a
+// unique jti so that it can be revoked individually, and the session id (sid)
+// so that a whole device can be.
+func GenerateAccessToken(ks *KeySet, user *models.User, m Membership, sessionID string, ttl time.Duration) (string, error) {
+    now := time.Now()
+    return ks.Sign(jwt.MapClaims{
+        "iss":    ks.Issuer(),
+        "sub":    user.ID,
+        "name":   user.Username,
+        "role":   m.Role,
+        "school": m.SchoolID,
+        "typ":    TokenTypeAccess,
+        "sid":    sessionID,
+        "jti":    utils.NewUUID(),
+        "iat":    now.Unix(),
+        "exp":    now.Add(ttl).Unix(),
+    })
+}
+
+// GenerateImpersonationToken signs an access token with which actor acts as
+// user in the school and with the role of m. The act claim (RFC 8693) keeps
+// the real subject; the token belongs to no session and comes without a
+// refresh token.
+func GenerateImpersonationToken(ks *KeySet, user, actor *models.User, m Membership, ttl time.Duration) (string, error) {
+    now := time.Now()
+    return ks.Sign(jwt.MapClaims{
+        "iss":    ks.Issuer(),
+        "sub":    user.ID,
+        "name":   user.Username,
+        "role":   m.Role,
+        "school": m.SchoolID,
+        "typ":    TokenTypeAccess,
+        "act":    map[string]interface{}{"sub": actor.ID, "name": actor.Username},
+        "jti":    utils.NewUUID(),
+        "iat":    now.Unix(),
+        "exp":    now.Add(ttl).Unix(),
+    })
+}
+
+// Actor returns the real subject of an impersonation token, or "" for a normal token.
+func Actor(claims jwt.MapClaims) string {
+    act, _ := claims["act"].(map[string]interface{})
+    sub, _ := act["sub"].(string)
+    return sub
+}
+
+// ParseAccessToken verifies signature, issuer and expiry of an access token signed by ks.
+func ParseAccessToken(ks *KeySet, tokenString string) (jwt.MapClaims, error) {
+    claims, err := parseToken(ks, tokenString)
+    if err != nil {
+        return nil, err
+    }
+    if typ, _ := claims["typ"].(string); typ != TokenTypeAccess {
+        return nil, errWrongTokenType
+    }
+    return claims, nil
+}
+
+// GenerateChallengeToken signs a short-lived token proving that userID passed
+// the password step of a login that still needs a second factor.
+func GenerateChallengeToken(ks *KeySet, userID, purpose string, ttl time.Duration) (string, error) {
+    now := time.Now()
+    return ks.Sign(jwt.MapClaims{
+        "iss":     ks.Issuer(),
+        "sub":     userID,
+        "typ":     TokenTypeMFA,
+        "purpose": purpose,
+        "jti":     utils.NewUUID(),
+        "iat":     now.Unix(),
+        "exp":     now.Add(ttl).Unix(),
+    })
+}
+
+// Challenge is a valid MFA challenge token.
+type Challenge struct {
+    UserID    string
+    JTI       string
+    IssuedAt  time.Time
+    ExpiresAt time.Time
+}
+
+// ParseChallengeToken validates a challenge token issued for purpose. It does
+// not check whether the token was already used (Denylist.ConsumeToken).
+func ParseChallengeToken(ks *KeySet, tokenString, purpose string) (*Challenge, error) {
+    claims, err := parseToken(ks, tokenString)
+    if err != nil {
+        return nil, err
+    }
+    typ, _ := claims["typ"].(string)
+    p, _ := claims["purpose"].(string)
+    if typ != TokenTypeMFA || p != purpose {
+        return nil, errWrongTokenType
+    }
+    ch := &Challenge{}
+    ch.UserID, _ = claims["sub"].(string)
+    ch.JTI, _ = claims["jti"].(string)
+    if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+        ch.IssuedAt = iat.Time
+    }
+    if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+        ch.ExpiresAt = exp.Time
+    }
+    return ch, nil
+}
+
+func parseToken(ks *KeySet, tokenString string) (jwt.MapClaims, error) {
+    claims := jwt.MapClaims{}
+    _, err := jwt.ParseWithClaims(tokenString, claims, ks.Keyfunc,
+        jwt.WithValidMethods(ks.ValidMethods()),
+        jwt.WithIssuer(ks.Issuer()),
+        jwt.WithExpirationRequired(),
+    )
+    if err != nil {
+        return nil, err
+    }
+    return claims, nil
+}
+
+// GenerateOpaqueToken returns a random URL-safe token and its storage hash.
+// Only the hash should ever be persisted.
+func GenerateOpaqueToken() (string, string, error) {
+    buf := make([]byte, 32)
+    if _, err := rand.Read(buf); err != nil {
+        return "", "", err
+    }
+    token := base64.RawURLEncoding.EncodeToString(buf)
+    return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of an opaque token.
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
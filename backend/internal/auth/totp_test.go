@@ -0,0 +1,54 @@
+package auth
+
+import (
+    "testing"
+    "time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded.
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTP(t *testing.T) {
+    for _, tc := range []struct {
+        name   string
+        secret string
+        code   string
+        at     int64
+        step   int64
+        ok     bool
+    }{
+        // RFC 6238 appendix B, truncated to six digits
+        {"vector 59", rfc6238Secret, "287082", 59, 1, true},
+        {"vector 1111111109", rfc6238Secret, "081804", 1111111109, 37037036, true},
+        {"vector 1234567890", rfc6238Secret, " 005924 ", 1234567890, 41152263, true},
+        {"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", 59, 1, true},
+        // the code of step 1 within one period of clock drift
+        {"previous step", rfc6238Secret, "287082", 89, 1, true},
+        {"next step", rfc6238Secret, "287082", 29, 1, true},
+        {"two steps late", rfc6238Secret, "287082", 119, 0, false},
+        {"wrong code", rfc6238Secret, "287083", 59, 0, false},
+        {"too short", rfc6238Secret, "28708", 59, 0, false},
+        {"8 digits", rfc6238Secret, "94287082", 59, 0, false},
+        {"invalid secret", "not base32!", "287082", 59, 0, false},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            step, ok := ValidateTOTP(tc.secret, tc.code, time.Unix(tc.at, 0))
+            if ok != tc.ok || step != tc.step {
+                t.Errorf("ValidateTOTP = %d, %v; want %d, %v", step, ok, tc.step, tc.ok)
+            }
+        })
+    }
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+    for in, want := range map[string]string{
+        "k3f9q-7xw2m":   "k3f9q-7xw2m",
+        " K3F9Q-7XW2M ": "k3f9q-7xw2m",
+        "k3f9q7xw2m":    "k3f9q-7xw2m",
+        "k3f9q 7xw2m":   "k3f9q-7xw2m",
+    } {
+        if got := NormalizeRecoveryCode(in); got != want {
+            t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
@@ -1,18 +1,244 @@
 package config
 
 import (
+    "strings"
+    "time"
+
     "github.com/spf13/viper"
 )
 
 type ServerConfig struct {
     Port string `mapstructure:"port"`
+    // base URL of the web app, used to build links sent by email
+    PublicURL string `mapstructure:"public_url"`
+}
+
+type JWTConfig struct {
+    // RS256 or EdDSA
+    Algorithm           string        `mapstructure:"algorithm"`
+    Issuer              string        `mapstructure:"issuer"`
+    KeyRotationInterval time.Duration `mapstructure:"key_rotation_interval"`
+    AccessTTL           time.Duration `mapstructure:"access_ttl"`
+    RefreshTTL          time.Duration `mapstructure:"refresh_ttl"`
+    // how often each instance reloads the revoked token list from the DB
+    RevocationSyncInterval time.Duration `mapstructure:"revocation_sync_interval"`
+    // base64 AES-256 key encrypting the private keys in signing_keys
+    KeyEncryptionKey string `mapstructure:"key_encryption_key"`
+}
+
+// LockoutConfig controls brute-force protection of the login endpoint.
+type LockoutConfig struct {
+    // failed attempts per account / per client IP before a temporary lockout
+    MaxAttempts   int           `mapstructure:"max_attempts"`
+    IPMaxAttempts int           `mapstructure:"ip_max_attempts"`
+    // failures older than Window are forgotten
+    Window   time.Duration `mapstructure:"window"`
+    Duration time.Duration `mapstructure:"duration"`
+    // delay enforced between attempts on an account, doubled per failure
+    BaseDelay time.Duration `mapstructure:"base_delay"`
+    MaxDelay  time.Duration `mapstructure:"max_delay"`
+}
+
+// EmailVerificationConfig controls how unverified accounts are treated.
+type EmailVerificationConfig struct {
+    // allow: log in regardless; grace: log in until GracePeriod after
+    // registration; deny: no login before the address is verified
+    LoginPolicy    string        `mapstructure:"login_policy"`
+    GracePeriod    time.Duration `mapstructure:"grace_period"`
+    TokenTTL       time.Duration `mapstructure:"token_ttl"`
+    ResendCooldown time.Duration `mapstructure:"resend_cooldown"`
+}
+
+// MFAConfig controls TOTP two-factor authentication.
+type MFAConfig struct {
+    // issuer label shown in authenticator apps
+    Issuer string `mapstructure:"issuer"`
+    // roles that must use 2FA; users without it are sent through enrollment at login
+    RequiredRoles []string      `mapstructure:"required_roles"`
+    ChallengeTTL  time.Duration `mapstructure:"challenge_ttl"`
+    RecoveryCodes int           `mapstructure:"recovery_codes"`
+}
+
+// APITokenConfig controls personal access tokens.
+type APITokenConfig struct {
+    // lifetime of a token created without expires_in_days
+    DefaultTTL time.Duration `mapstructure:"default_ttl"`
+    MaxTTL     time.Duration `mapstructure:"max_ttl"`
+}
+
+// RoleMapping maps a group or role value asserted by an external identity
+// source (an OIDC claim, an LDAP attribute) to one of our roles.
+type RoleMapping struct {
+    Value string `mapstructure:"value"`
+    Role  string `mapstructure:"role"`
+}
+
+// OIDCConfig controls single sign-on through an OpenID Connect provider.
+type OIDCConfig struct {
+    Enabled      bool     `mapstructure:"enabled"`
+    IssuerURL    string   `mapstructure:"issuer_url"`
+    ClientID     string   `mapstructure:"client_id"`
+    ClientSecret string   `mapstructure:"client_secret"`
+    // callback of this API registered at the IdP, e.g. http://localhost:8080/api/v1/auth/oidc/callback
+    RedirectURL string   `mapstructure:"redirect_url"`
+    Scopes      []string `mapstructure:"scopes"`
+    // ID token claim holding groups or roles; string or list of strings
+    RoleClaim    string            `mapstructure:"role_claim"`
+    RoleMappings []RoleMapping `mapstructure:"role_mappings"`
+    // role for users without a mapped claim value; empty refuses them
+    DefaultRole string `mapstructure:"default_role"`
+    // ID token claim holding the code of the user's school
+    SchoolClaim string `mapstructure:"school_claim"`
+    // school code for new users without the claim; with neither only
+    // district admins are created
+    DefaultSchool string `mapstructure:"default_school"`
+    // overwrite the role of linked users on every SSO login
+    SyncRole bool `mapstructure:"sync_role"`
+    // create users on first login
+    AllowSignup bool `mapstructure:"allow_signup"`
+    // link an existing user with the same, IdP-verified email address
+    LinkByEmail bool          `mapstructure:"link_by_email"`
+    StateTTL    time.Duration `mapstructure:"state_ttl"`
+    // issue tokens without our 2FA step; only for IdPs that enforce their own
+    SkipMFA bool `mapstructure:"skip_mfa"`
+    // also link and re-role admin and district_admin accounts
+    LinkPrivileged bool `mapstructure:"link_privileged"`
+}
+
+// LDAPConfig controls password logins against an LDAP directory or Active Directory.
+type LDAPConfig struct {
+    // ldap://host:389 or ldaps://host:636
+    URL                string `mapstructure:"url"`
+    StartTLS           bool   `mapstructure:"start_tls"`
+    InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+    // account used to look up users; empty binds anonymously
+    BindDN       string `mapstructure:"bind_dn"`
+    BindPassword string `mapstructure:"bind_password"`
+    BaseDN       string `mapstructure:"base_dn"`
+    // %s is replaced by the escaped username, e.g. (&(objectClass=user)(sAMAccountName=%s)) for AD
+    UserFilter     string        `mapstructure:"user_filter"`
+    EmailAttribute string        `mapstructure:"email_attribute"`
+    RoleAttribute  string        `mapstructure:"role_attribute"`
+    RoleMappings   []RoleMapping `mapstructure:"role_mappings"`
+    // role for users without a mapped attribute value; empty refuses them
+    DefaultRole string `mapstructure:"default_role"`
+    SyncRole    bool   `mapstructure:"sync_role"`
+    // attribute holding the code of the user's school
+    SchoolAttribute string `mapstructure:"school_attribute"`
+    // school code for new users without the attribute; with neither only
+    // district admins are created
+    DefaultSchool string `mapstructure:"default_school"`
+    // create users on first login
+    AllowSignup bool `mapstructure:"allow_signup"`
+    // link an existing local user with the same username
+    LinkExisting bool `mapstructure:"link_existing"`
+    // also link and re-role admin and district_admin accounts
+    LinkPrivileged bool          `mapstructure:"link_privileged"`
+    Timeout        time.Duration `mapstructure:"timeout"`
+}
+
+// RegistrationConfig controls self-registration and invitation codes.
+type RegistrationConfig struct {
+    // open or invite_only
+    Mode string `mapstructure:"mode"`
+    // lifetime of an invitation created without expires_in_hours
+    InvitationTTL    time.Duration `mapstructure:"invitation_ttl"`
+    MaxInvitationTTL time.Duration `mapstructure:"max_invitation_ttl"`
+}
+
+type AuthConfig struct {
+    Lockout               LockoutConfig           `mapstructure:"lockout"`
+    PasswordResetTTL      time.Duration           `mapstructure:"password_reset_ttl"`
+    // minimum time between two reset emails for the same account
+    PasswordResetCooldown time.Duration           `mapstructure:"password_reset_cooldown"`
+    EmailVerification     EmailVerificationConfig `mapstructure:"email_verification"`
+    MFA                   MFAConfig               `mapstructure:"mfa"`
+    // how long AuthMiddleware trusts a cached account status
+    StatusCacheTTL        time.Duration           `mapstructure:"status_cache_ttl"`
+    // how often at most the last-seen time of a session is written
+    SessionTouchInterval  time.Duration           `mapstructure:"session_touch_interval"`
+    APITokens             APITokenConfig          `mapstructure:"api_tokens"`
+    OIDC                  OIDCConfig              `mapstructure:"oidc"`
+    // password login backends in the order they are tried: local, ldap
+    Authenticators        []string                `mapstructure:"authenticators"`
+    LDAP                  LDAPConfig              `mapstructure:"ldap"`
+    // lifetime of the token an admin gets to act as another user
+    ImpersonationTTL      time.Duration           `mapstructure:"impersonation_ttl"`
+    Registration          RegistrationConfig      `mapstructure:"registration"`
+    // how often instances check the database for policy changes made elsewhere
+    PolicySyncInterval    time.Duration           `mapstructure:"policy_sync_interval"`
+    // compare routes and policies at startup: warn, fail or off
+    PolicyCheck           string                  `mapstructure:"policy_check"`
+}
+
+type SMTPConfig struct {
+    Host     string `mapstructure:"host"`
+    Port     int    `mapstructure:"port"`
+    Username string `mapstructure:"username"`
+    Password string `mapstructure:"password"`
+}
+
+type MailConfig struct {
+    // smtp, file or memory
+    Driver string `mapstructure:"driver"`
+    From   string `mapstructure:"from"`
+    // output directory of the file driver
+    Dir  string     `mapstructure:"dir"`
+    SMTP SMTPConfig `mapstructure:"smtp"`
+}
+
+// PasswordConfig is the policy applied whenever a password is set.
+type PasswordConfig struct {
+    MinLength      int  `mapstructure:"min_length"`
+    MaxLength      int  `mapstructure:"max_length"`
+    RequireUpper   bool `mapstructure:"require_upper"`
+    RequireLower   bool `mapstructure:"require_lower"`
+    RequireDigit   bool `mapstructure:"require_digit"`
+    RequireSymbol  bool `mapstructure:"require_symbol"`
+    ForbidUsername bool `mapstructure:"forbid_username"`
+    // optional file with additional compromised passwords, one per line
+    BlocklistFile string             `mapstructure:"blocklist_file"`
+    Hash          PasswordHashConfig `mapstructure:"hash"`
+}
+
+// PasswordHashConfig selects how new password hashes are computed. Stored
+// hashes made with other settings still verify and are upgraded on login.
+type PasswordHashConfig struct {
+    // argon2id or bcrypt
+    Algorithm  string       `mapstructure:"algorithm"`
+    Argon2     Argon2Config `mapstructure:"argon2"`
+    BcryptCost int          `mapstructure:"bcrypt_cost"`
+}
+
+// Argon2Config holds the argon2id cost parameters.
+type Argon2Config struct {
+    // KiB
+    Memory      uint32 `mapstructure:"memory"`
+    Iterations  uint32 `mapstructure:"iterations"`
+    Parallelism uint8  `mapstructure:"parallelism"`
+    SaltLength  uint32 `mapstructure:"salt_length"`
+    KeyLength   uint32 `mapstructure:"key_length"`
 }
 
 type Config struct {
-    Server ServerConfig `mapstructure:"server"`
-    JWT    struct {
-        Secret string `mapstructure:"secret"`
-    } `mapstructure:"jwt"`
+    Server   ServerConfig   `mapstructure:"server"`
+    JWT      JWTConfig      `mapstructure:"jwt"`
+    Auth     AuthConfig     `mapstructure:"auth"`
+    Mail     MailConfig     `mapstructure:"mail"`
+    Password PasswordConfig `mapstructure:"password"`
+}
+
+// MaxTokenTTL is the longest lifetime of a JWT this API signs: access,
+// impersonation or MFA challenge tokens. Revocations and retired signing keys
+// must last at least this long.
+func (c *Config) MaxTokenTTL() time.Duration {
+    ttl := c.JWT.AccessTTL
+    for _, d := range []time.Duration{c.Auth.ImpersonationTTL, c.Auth.MFA.ChallengeTTL} {
+        if d > ttl {
+            ttl = d
+        }
+    }
+    return ttl
 }
 
 func LoadConfig() (*Config, error) {
@@ -21,12 +247,81 @@ func LoadConfig() (*Config, error) {
     v.AddConfigPath(".")
     v.AddConfigPath("./config")
     v.SetDefault("server.port", "8080")
-    v.SetDefault("jwt.secret", "change-me-in-production")
+    v.SetDefault("server.public_url", "http://localhost:3000")
+    v.SetDefault("jwt.algorithm", "RS256")
+    v.SetDefault("jwt.issuer", "smartcampus")
+    v.SetDefault("jwt.key_rotation_interval", "720h")
+    v.SetDefault("jwt.access_ttl", "15m")
+    v.SetDefault("jwt.refresh_ttl", "720h")
+    v.SetDefault("jwt.revocation_sync_interval", "10s")
+    // no default key; the default only lets JWT_KEY_ENCRYPTION_KEY set it
+    v.SetDefault("jwt.key_encryption_key", "")
+    v.SetDefault("auth.lockout.max_attempts", 5)
+    v.SetDefault("auth.lockout.ip_max_attempts", 100)
+    v.SetDefault("auth.lockout.window", "15m")
+    v.SetDefault("auth.lockout.duration", "15m")
+    v.SetDefault("auth.lockout.base_delay", "1s")
+    v.SetDefault("auth.lockout.max_delay", "30s")
+    v.SetDefault("auth.password_reset_ttl", "1h")
+    v.SetDefault("auth.password_reset_cooldown", "1m")
+    v.SetDefault("auth.email_verification.login_policy", "deny")
+    v.SetDefault("auth.email_verification.grace_period", "72h")
+    v.SetDefault("auth.email_verification.token_ttl", "48h")
+    v.SetDefault("auth.email_verification.resend_cooldown", "1m")
+    v.SetDefault("auth.mfa.issuer", "SmartCampus")
+    v.SetDefault("auth.mfa.required_roles", []string{"district_admin"})
+    v.SetDefault("auth.mfa.challenge_ttl", "5m")
+    v.SetDefault("auth.mfa.recovery_codes", 10)
+    v.SetDefault("auth.status_cache_ttl", "30s")
+    v.SetDefault("auth.session_touch_interval", "1m")
+    v.SetDefault("auth.api_tokens.default_ttl", "2160h")
+    v.SetDefault("auth.api_tokens.max_ttl", "8760h")
+    v.SetDefault("auth.oidc.enabled", false)
+    v.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email"})
+    v.SetDefault("auth.oidc.role_claim", "groups")
+    v.SetDefault("auth.oidc.default_role", "student")
+    v.SetDefault("auth.oidc.sync_role", true)
+    v.SetDefault("auth.oidc.allow_signup", true)
+    v.SetDefault("auth.oidc.link_by_email", true)
+    v.SetDefault("auth.oidc.state_ttl", "10m")
+    v.SetDefault("auth.oidc.skip_mfa", false)
+    v.SetDefault("auth.oidc.link_privileged", false)
+    v.SetDefault("auth.authenticators", []string{"local"})
+    v.SetDefault("auth.ldap.user_filter", "(&(objectClass=person)(uid=%s))")
+    v.SetDefault("auth.ldap.email_attribute", "mail")
+    v.SetDefault("auth.ldap.role_attribute", "memberOf")
+    v.SetDefault("auth.ldap.sync_role", true)
+    v.SetDefault("auth.ldap.allow_signup", true)
+    v.SetDefault("auth.ldap.link_existing", false)
+    v.SetDefault("auth.ldap.link_privileged", false)
+    v.SetDefault("auth.ldap.timeout", "10s")
+    v.SetDefault("auth.impersonation_ttl", "30m")
+    v.SetDefault("auth.registration.mode", "open")
+    v.SetDefault("auth.registration.invitation_ttl", "168h")
+    v.SetDefault("auth.registration.max_invitation_ttl", "2160h")
+    v.SetDefault("auth.policy_sync_interval", "5s")
+    v.SetDefault("auth.policy_check", "warn")
+    v.SetDefault("mail.driver", "file")
+    v.SetDefault("mail.from", "SmartCampus <no-reply@smartcampus.local>")
+    v.SetDefault("mail.dir", "./tmp/mail")
+    v.SetDefault("mail.smtp.port", 587)
+    v.SetDefault("password.min_length", 10)
+    v.SetDefault("password.max_length", 128)
+    v.SetDefault("password.forbid_username", true)
+    v.SetDefault("password.hash.algorithm", "argon2id")
+    v.SetDefault("password.hash.argon2.memory", 65536)
+    v.SetDefault("password.hash.argon2.iterations", 3)
+    v.SetDefault("password.hash.argon2.parallelism", 2)
+    v.SetDefault("password.hash.argon2.salt_length", 16)
+    v.SetDefault("password.hash.argon2.key_length", 32)
+    v.SetDefault("password.hash.bcrypt_cost", 12)
 
     if err := v.ReadInConfig(); err != nil {
         // it's OK if no config file; we'll use defaults and env
     }
 
+    // allow JWT_ALGORITHM style env vars for nested keys
+    v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
     v.AutomaticEnv()
 
     var cfg Config
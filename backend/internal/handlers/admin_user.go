@@ -0,0 +1,435 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/mail"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/password"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// unusablePasswordHash is set when an admin forces a reset so that the old
+// password stops working immediately.
+const unusablePasswordHash = authpkg.UnusablePasswordHash
+
+type createUserRequest struct {
+    Username string `json:"username" binding:"required" validate:"min=3,max=50"`
+    Email    string `json:"email" binding:"required,email"`
+    // optional; without it the user receives a link to choose a password
+    Password string `json:"password"`
+    Role     string `json:"role" binding:"required" validate:"oneof=district_admin admin teacher student guardian"`
+    Status   string `json:"status" validate:"omitempty,oneof=active inactive suspended"`
+    // defaults to the school the admin acts in; only district admins may pick another
+    SchoolID string `json:"school_id" validate:"omitempty,uuid"`
+}
+
+type updateUserRequest struct {
+    Username *string `json:"username" validate:"omitempty,min=3,max=50"`
+    Email    *string `json:"email" validate:"omitempty,email"`
+    // "" removes the user from their school; district admins only
+    SchoolID *string `json:"school_id" validate:"omitempty,uuid"`
+}
+
+type changeRoleRequest struct {
+    Role string `json:"role" binding:"required" validate:"oneof=district_admin admin teacher student guardian"`
+}
+
+type changeStatusRequest struct {
+    Status string `json:"status" binding:"required" validate:"oneof=active inactive suspended"`
+}
+
+// pagination reads page/page_size query parameters (defaults 1 and 20, max 100).
+func pagination(c *gin.Context) (int, int) {
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+    size, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+    if page < 1 {
+        page = 1
+    }
+    if size < 1 || size > 100 {
+        size = 20
+    }
+    return page, size
+}
+
+// ListUsers searches the users of the school by username/email (q) and
+// filters by role, status and kind.
+func ListUsers(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    page, size := pagination(c)
+
+    q := gdb.Model(&models.User{}).Scopes(schoolScope(c, "school_id"))
+    if term := strings.TrimSpace(c.Query("q")); term != "" {
+        like := "%" + strings.ToLower(term) + "%"
+        q = q.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", like, like)
+    }
+    if role := c.Query("role"); role != "" {
+        q = q.Where("role = ?", role)
+    }
+    if status := c.Query("status"); status != "" {
+        q = q.Where("status = ?", status)
+    }
+    if kind := c.Query("kind"); kind != "" {
+        q = q.Where("kind = ?", kind)
+    }
+
+    var total int64
+    if err := q.Count(&total).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    var list []models.User
+    if err := q.Order("username").Offset((page - 1) * size).Limit(size).Find(&list).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, gin.H{"items": list, "total": total, "page": page, "page_size": size})
+}
+
+// CreateUser creates an account in the admin's school with any role but
+// district_admin, which only district admins may give. Accounts created by an
+// admin count as verified; without a password the user is mailed a reset link.
+func CreateUser(m mail.Mailer, policy *password.Policy) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req createUserRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+        if req.Role == models.RoleDistrictAdmin && c.GetString("user_role") != models.RoleDistrictAdmin {
+            response.Error(c, http.StatusForbidden, "only district admins can create district admins", nil)
+            return
+        }
+        school, ok := requestSchool(c, req.SchoolID)
+        if !ok {
+            response.Error(c, http.StatusForbidden, "you can only create users in your own school", nil)
+            return
+        }
+
+        hash := unusablePasswordHash
+        if req.Password != "" {
+            if err := policy.Validate(req.Password, req.Username, req.Email); err != nil {
+                respondPasswordPolicy(c, err)
+                return
+            }
+            var err error
+            if hash, err = hashPassword(req.Password); err != nil {
+                response.Error(c, http.StatusInternalServerError, "create user failed", err.Error())
+                return
+            }
+        }
+        status := req.Status
+        if status == "" {
+            status = models.StatusActive
+        }
+
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        now := time.Now()
+        user := &models.User{
+            Username:        req.Username,
+            Email:           req.Email,
+            PasswordHash:    hash,
+            Role:            req.Role,
+            Status:          status,
+            EmailVerifiedAt: &now,
+        }
+        if req.Role != models.RoleDistrictAdmin {
+            user.SchoolID = optionalID(school)
+        }
+        if err := gdb.Create(user).Error; err != nil {
+            response.Error(c, http.StatusBadRequest, "create user failed", err.Error())
+            return
+        }
+        if req.Password == "" {
+            if err := sendPasswordReset(c, gdb, m, user); err != nil {
+                _ = c.Error(err)
+            }
+        }
+        response.Success(c, user)
+    }
+}
+
+func GetUser(c *gin.Context) {
+    id := c.Param("id")
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var user models.User
+    if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", id).Error; err != nil {
+        response.Error(c, http.StatusNotFound, "not found", nil)
+        return
+    }
+    response.Success(c, user)
+}
+
+// UpdateUser edits username, email and school; role and status have their own endpoints.
+func UpdateUser(c *gin.Context) {
+    id := c.Param("id")
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var user models.User
+    if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", id).Error; err != nil {
+        response.Error(c, http.StatusNotFound, "not found", nil)
+        return
+    }
+    var req updateUserRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+    if err := utils.ValidateStruct(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+        return
+    }
+    updates := map[string]interface{}{}
+    if req.Username != nil {
+        updates["username"] = *req.Username
+    }
+    if req.Email != nil {
+        updates["email"] = *req.Email
+    }
+    if req.SchoolID != nil {
+        if c.GetString("user_role") != models.RoleDistrictAdmin {
+            response.Error(c, http.StatusForbidden, "only district admins can move users between schools", nil)
+            return
+        }
+        if *req.SchoolID == "" {
+            updates["school_id"] = nil
+        } else {
+            var school models.School
+            if err := gdb.First(&school, "id = ?", *req.SchoolID).Error; err != nil {
+                response.Error(c, http.StatusBadRequest, "school not found", nil)
+                return
+            }
+            updates["school_id"] = *req.SchoolID
+        }
+    }
+    if len(updates) > 0 {
+        if err := gdb.Model(&user).Updates(updates).Error; err != nil {
+            response.Error(c, http.StatusBadRequest, "update failed", err.Error())
+            return
+        }
+        gdb.First(&user, "id = ?", id)
+    }
+    response.Success(c, user)
+}
+
+// DeleteUser soft-deletes a user and signs them out everywhere.
+func DeleteUser(dl *authpkg.Denylist, sc *authpkg.StatusCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        id := c.Param("id")
+        if id == c.GetString("user_id") {
+            response.Error(c, http.StatusBadRequest, "cannot delete your own account", nil)
+            return
+        }
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", id).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if err := gdb.Delete(&user).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "delete failed", err.Error())
+            return
+        }
+        sc.Invalidate(user.ID)
+        if err := revokeUserSessions(gdb, dl, user.ID); err != nil {
+            _ = c.Error(err)
+        }
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// ChangeUserRole sets the role a user has in their own school; roles in
+// other schools are granted through /admin/users/:id/roles. Only district
+// admins give or take district_admin. The role is embedded in access tokens,
+// so existing sessions are revoked to make the change effective.
+func ChangeUserRole(dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        id := c.Param("id")
+        var req changeRoleRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", id).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if user.ID == c.GetString("user_id") && req.Role != user.Role {
+            response.Error(c, http.StatusBadRequest, "cannot change your own role", nil)
+            return
+        }
+        if (user.Role == models.RoleDistrictAdmin || req.Role == models.RoleDistrictAdmin) && c.GetString("user_role") != models.RoleDistrictAdmin {
+            response.Error(c, http.StatusForbidden, "only district admins can change district admins", nil)
+            return
+        }
+        if user.Role == req.Role {
+            response.Success(c, user)
+            return
+        }
+        if err := gdb.Model(&user).Update("role", req.Role).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "update failed", err.Error())
+            return
+        }
+        user.Role = req.Role
+        if err := revokeUserSessions(gdb, dl, user.ID); err != nil {
+            _ = c.Error(err)
+        }
+        response.Success(c, user)
+    }
+}
+
+// ChangeUserStatus activates, deactivates or suspends a user. Leaving the
+// active status signs the user out everywhere.
+func ChangeUserStatus(dl *authpkg.Denylist, sc *authpkg.StatusCache) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        id := c.Param("id")
+        var req changeStatusRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+        if id == c.GetString("user_id") && req.Status != models.StatusActive {
+            response.Error(c, http.StatusBadRequest, "cannot deactivate your own account", nil)
+            return
+        }
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", id).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if err := gdb.Model(&user).Update("status", req.Status).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "update failed", err.Error())
+            return
+        }
+        user.Status = req.Status
+        sc.Invalidate(user.ID)
+        if req.Status != models.StatusActive {
+            if err := revokeUserSessions(gdb, dl, user.ID); err != nil {
+                _ = c.Error(err)
+            }
+        }
+        response.Success(c, user)
+    }
+}
+
+// ForcePasswordReset invalidates the current password, signs the user out
+// and mails them a reset link.
+func ForcePasswordReset(m mail.Mailer, dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        id := c.Param("id")
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", id).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if err := gdb.Model(&user).Update("password_hash", unusablePasswordHash).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "reset failed", err.Error())
+            return
+        }
+        if err := revokeUserSessions(gdb, dl, user.ID); err != nil {
+            _ = c.Error(err)
+        }
+        mailed := true
+        if err := sendPasswordReset(c, gdb, m, &user); err != nil {
+            _ = c.Error(err)
+            mailed = false
+        }
+        response.Success(c, gin.H{"id": user.ID, "password_reset": true, "email_sent": mailed})
+    }
+}
+
+// revokeUserSessions invalidates every session, access and refresh token of a user.
+func revokeUserSessions(gdb *gorm.DB, dl *authpkg.Denylist, userID string) error {
+    cfg, _ := config.LoadConfig()
+    if err := dl.RevokeUser(userID, cfg.MaxTokenTTL()); err != nil {
+        return err
+    }
+    now := time.Now()
+    err := gdb.Model(&models.RefreshToken{}).
+        Where("user_id = ? AND revoked_at IS NULL", userID).
+        Update("revoked_at", now).Error
+    if err != nil {
+        return err
+    }
+    return gdb.Model(&models.Session{}).
+        Where("user_id = ? AND revoked_at IS NULL", userID).
+        Update("revoked_at", now).Error
+}
+
+// RevokeUserSessions signs a user out everywhere (admin only).
+func RevokeUserSessions(dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        id := c.Param("id")
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", id).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if err := revokeUserSessions(gdb, dl, user.ID); err != nil {
+            response.Error(c, http.StatusInternalServerError, "revoke failed", err.Error())
+            return
+        }
+        response.Success(c, gin.H{"id": user.ID, "sessions_revoked": true})
+    }
+}
+
+type unlockRequest struct {
+    IP string `json:"ip"`
+}
+
+// UnlockUser lifts a login lockout of a user and optionally of a client IP (admin only).
+func UnlockUser(guard *authpkg.LoginGuard) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req unlockRequest
+        // the body is optional
+        _ = c.ShouldBindJSON(&req)
+
+        id := c.Param("id")
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", id).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if err := guard.Unlock(user.Username, req.IP); err != nil {
+            response.Error(c, http.StatusInternalServerError, "unlock failed", err.Error())
+            return
+        }
+        response.Success(c, gin.H{"id": user.ID, "unlocked": true})
+    }
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+    "net/http"
+    "sort"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func newAdminDB(t *testing.T) *gorm.DB {
+    return testutil.NewDB(t, &models.School{}, &models.User{}, &models.Session{}, &models.RefreshToken{}, &models.TokenRevocation{})
+}
+
+// createSchoolUser stores a user of role in school.
+func createSchoolUser(t *testing.T, db *gorm.DB, name, role, school string) *models.User {
+    t.Helper()
+    return createUser(t, db, &models.User{
+        Username: name, Email: name + "@example.org", Role: role, Status: models.StatusActive, SchoolID: optionalID(school),
+    })
+}
+
+func TestListUsersFiltersWithinSchool(t *testing.T) {
+    db := newAdminDB(t)
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    createSchoolUser(t, db, "anna", models.RoleTeacher, testSchool)
+    createSchoolUser(t, db, "annika", models.RoleStudent, testSchool)
+    createSchoolUser(t, db, "ben", models.RoleStudent, testSchool)
+    createSchoolUser(t, db, "anton", models.RoleTeacher, otherSchool)
+
+    tests := []struct {
+        name  string
+        query string
+        want  []string
+    }{
+        {"whole school", "", []string{"admin", "anna", "annika", "ben"}},
+        {"search", "?q=ANN", []string{"anna", "annika"}},
+        {"search by email", "?q=ben@example", []string{"ben"}},
+        {"role", "?role=teacher", []string{"anna"}},
+        {"paged", "?page=2&page_size=3", []string{"ben"}},
+    }
+    r := newTestRouter(db, asUser(admin.ID, models.RoleAdmin, testSchool))
+    r.GET("/users", ListUsers)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := doJSON(t, r, "GET", "/users"+tt.query, nil)
+            if w.Code != http.StatusOK {
+                t.Fatalf("status %d: %s", w.Code, w.Body)
+            }
+            var got []string
+            for _, item := range decodeData(t, w)["items"].([]interface{}) {
+                got = append(got, item.(map[string]interface{})["username"].(string))
+            }
+            sort.Strings(got)
+            if len(got) != len(tt.want) {
+                t.Fatalf("users %v, want %v", got, tt.want)
+            }
+            for i := range got {
+                if got[i] != tt.want[i] {
+                    t.Fatalf("users %v, want %v", got, tt.want)
+                }
+            }
+        })
+    }
+}
+
+func TestChangeUserRole(t *testing.T) {
+    db := newAdminDB(t)
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    teacher := createSchoolUser(t, db, "anna", models.RoleTeacher, testSchool)
+    stranger := createSchoolUser(t, db, "anton", models.RoleTeacher, otherSchool)
+    dl := authpkg.NewDenylist(db, time.Hour)
+    ks := newTestKeySet(t)
+    _, sid := signIn(t, db, ks, teacher)
+
+    tests := []struct {
+        name string
+        id   string
+        role string
+        want int
+    }{
+        {"own role", admin.ID, models.RoleTeacher, http.StatusBadRequest},
+        {"district admin by an admin", teacher.ID, models.RoleDistrictAdmin, http.StatusForbidden},
+        {"unknown role", teacher.ID, "janitor", http.StatusBadRequest},
+        {"other school", stranger.ID, models.RoleStudent, http.StatusNotFound},
+        {"own school", teacher.ID, models.RoleStudent, http.StatusOK},
+    }
+    r := newTestRouter(db, asUser(admin.ID, models.RoleAdmin, testSchool))
+    r.PUT("/users/:id/role", ChangeUserRole(dl))
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := doJSON(t, r, "PUT", "/users/"+tt.id+"/role", map[string]string{"role": tt.role})
+            if w.Code != tt.want {
+                t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+            }
+        })
+    }
+
+    var stored models.User
+    db.First(&stored, "id = ?", teacher.ID)
+    if stored.Role != models.RoleStudent {
+        t.Errorf("role %q, want student", stored.Role)
+    }
+    // the old role is in the user's access tokens
+    var s models.Session
+    db.First(&s, "id = ?", sid)
+    if s.RevokedAt == nil {
+        t.Error("session not revoked after the role change")
+    }
+}
+
+func TestChangeUserStatus(t *testing.T) {
+    db := newAdminDB(t)
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    teacher := createSchoolUser(t, db, "anna", models.RoleTeacher, testSchool)
+    dl := authpkg.NewDenylist(db, time.Hour)
+    sc := authpkg.NewStatusCache(db, time.Hour)
+    ks := newTestKeySet(t)
+    signIn(t, db, ks, teacher)
+
+    tests := []struct {
+        name   string
+        id     string
+        status string
+        want   int
+    }{
+        {"deactivate yourself", admin.ID, models.StatusInactive, http.StatusBadRequest},
+        {"unknown status", teacher.ID, "banned", http.StatusBadRequest},
+        {"suspend", teacher.ID, models.StatusSuspended, http.StatusOK},
+    }
+    r := newTestRouter(db, asUser(admin.ID, models.RoleAdmin, testSchool))
+    r.PUT("/users/:id/status", ChangeUserStatus(dl, sc))
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := doJSON(t, r, "PUT", "/users/"+tt.id+"/status", map[string]string{"status": tt.status})
+            if w.Code != tt.want {
+                t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+            }
+        })
+    }
+
+    if status, _ := sc.Status(teacher.ID); status != models.StatusSuspended {
+        t.Errorf("cached status %q, want suspended", status)
+    }
+    var active int64
+    db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", teacher.ID).Count(&active)
+    if active != 0 {
+        t.Errorf("%d refresh tokens of the suspended user still active", active)
+    }
+    if !dl.IsRevoked("", "", teacher.ID, time.Now().Add(-time.Second)) {
+        t.Error("access tokens of the suspended user not revoked")
+    }
+}
+
+func TestUpdateUserSchool(t *testing.T) {
+    db := newAdminDB(t)
+    for _, s := range []models.School{{ID: testSchool, Name: "North", Code: "N"}, {ID: otherSchool, Name: "South", Code: "S"}} {
+        if err := db.Create(&s).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+    district := createSchoolUser(t, db, "district", models.RoleDistrictAdmin, "")
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    teacher := createSchoolUser(t, db, "anna", models.RoleTeacher, testSchool)
+
+    byAdmin := asUser(admin.ID, models.RoleAdmin, testSchool)
+    byDistrict := asUser(district.ID, models.RoleDistrictAdmin, "")
+    tests := []struct {
+        name   string
+        as     gin.HandlerFunc
+        school string
+        want   int
+    }{
+        {"by a school admin", byAdmin, otherSchool, http.StatusForbidden},
+        {"to a school that does not exist", byDistrict, "5c4e7a9e-0000-4000-8000-0000000000ff", http.StatusBadRequest},
+        {"to another school", byDistrict, otherSchool, http.StatusOK},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := newTestRouter(db, tt.as)
+            r.PUT("/users/:id", UpdateUser)
+            w := doJSON(t, r, "PUT", "/users/"+teacher.ID, map[string]string{"school_id": tt.school})
+            if w.Code != tt.want {
+                t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+            }
+        })
+    }
+
+    var stored models.User
+    db.First(&stored, "id = ?", teacher.ID)
+    if stored.SchoolID == nil || *stored.SchoolID != otherSchool {
+        t.Errorf("school %v, want %s", stored.SchoolID, otherSchool)
+    }
+}
+
+func TestDeleteUser(t *testing.T) {
+    db := newAdminDB(t)
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    teacher := createSchoolUser(t, db, "anna", models.RoleTeacher, testSchool)
+    stranger := createSchoolUser(t, db, "anton", models.RoleTeacher, otherSchool)
+
+    tests := []struct {
+        name string
+        id   string
+        want int
+    }{
+        {"yourself", admin.ID, http.StatusBadRequest},
+        {"other school", stranger.ID, http.StatusNotFound},
+        {"own school", teacher.ID, http.StatusNoContent},
+        {"already deleted", teacher.ID, http.StatusNotFound},
+    }
+    r := newTestRouter(db, asUser(admin.ID, models.RoleAdmin, testSchool))
+    r.DELETE("/users/:id", DeleteUser(authpkg.NewDenylist(db, time.Hour), nil))
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := doJSON(t, r, "DELETE", "/users/"+tt.id, nil)
+            if w.Code != tt.want {
+                t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+            }
+        })
+    }
+    var n int64
+    db.Unscoped().Model(&models.User{}).Where("id = ? AND deleted_at IS NOT NULL", teacher.ID).Count(&n)
+    if n != 1 {
+        t.Error("user not soft-deleted")
+    }
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// apiTokenTouchInterval limits how often last_used_at of a token is written.
+const apiTokenTouchInterval = time.Minute
+
+// serviceAccountEmailDomain gives service accounts a unique address that can
+// never receive mail (.invalid is reserved by RFC 2606).
+const serviceAccountEmailDomain = "service.invalid"
+
+type createAPITokenRequest struct {
+    Name          string   `json:"name" binding:"required" validate:"max=100"`
+    Scopes        []string `json:"scopes" binding:"required" validate:"min=1"`
+    ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1"`
+}
+
+type createServiceAccountRequest struct {
+    Username string `json:"username" binding:"required" validate:"min=3,max=50"`
+    Role     string `json:"role" binding:"required" validate:"oneof=admin teacher student"`
+}
+
+var errScopeUnknown = errors.New("unknown scope")
+
+func apiTokenView(t *models.APIToken) gin.H {
+    return gin.H{
+        "id":           t.ID,
+        "name":         t.Name,
+        "prefix":       t.Prefix,
+        "scopes":       t.ScopeList(),
+        "expires_at":   t.ExpiresAt,
+        "last_used_at": t.LastUsedAt,
+        "created_at":   t.CreatedAt,
+    }
+}
+
+// accountStatusError refuses a credential whose owner may not sign in.
+type accountStatusError struct {
+    status string
+}
+
+func (e *accountStatusError) Error() string { return "account " + e.status }
+
+// authenticateAPIToken resolves a personal access token to the token and its
+// owner. Tokens of accounts that are not active fail with an
+// *accountStatusError, so every caller refuses them.
+func authenticateAPIToken(c *gin.Context, raw string) (*models.APIToken, *models.User, error) {
+    db, ok := c.Get("db")
+    if !ok {
+        return nil, nil, errInvalidToken
+    }
+    gdb := db.(*gorm.DB)
+
+    var tok models.APIToken
+    if err := gdb.Where("token_hash = ?", authpkg.HashToken(raw)).First(&tok).Error; err != nil {
+        return nil, nil, errInvalidToken
+    }
+    if tok.RevokedAt != nil {
+        return nil, nil, errTokenRevoked
+    }
+    if time.Now().After(tok.ExpiresAt) {
+        return nil, nil, errInvalidToken
+    }
+    var user models.User
+    err := gdb.First(&user, "id = ? AND kind IN ?", tok.UserID, []string{models.KindHuman, models.KindService}).Error
+    if err != nil {
+        return nil, nil, errInvalidToken
+    }
+    if user.Status != models.StatusActive {
+        return nil, nil, &accountStatusError{user.Status}
+    }
+    return &tok, &user, nil
+}
+
+// touchAPIToken records that tok was used, at most once per
+// apiTokenTouchInterval across all instances.
+func touchAPIToken(gdb *gorm.DB, tok *models.APIToken) error {
+    now := time.Now()
+    if tok.LastUsedAt != nil && now.Sub(*tok.LastUsedAt) < apiTokenTouchInterval {
+        return nil
+    }
+    return gdb.Model(&models.APIToken{}).
+        Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", tok.ID, now.Add(-apiTokenTouchInterval)).
+        Update("last_used_at", now).Error
+}
+
+// createAPIToken issues a token for userID. The plain token is only ever
+// returned here; afterwards just its prefix is known.
+func createAPIToken(c *gin.Context, e *casbin.SyncedEnforcer, userID string) {
+    var req createAPITokenRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+    if err := utils.ValidateStruct(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+        return
+    }
+
+    known := authpkg.Scopes(e)
+    scopes := map[string]bool{}
+    for _, s := range req.Scopes {
+        i := sort.SearchStrings(known, s)
+        if i == len(known) || known[i] != s {
+            response.Error(c, http.StatusBadRequest, errScopeUnknown.Error(), gin.H{"scope": s, "known_scopes": known})
+            return
+        }
+        scopes[s] = true
+    }
+    list := make([]string, 0, len(scopes))
+    for s := range scopes {
+        list = append(list, s)
+    }
+    sort.Strings(list)
+
+    cfg, _ := config.LoadConfig()
+    ttl := cfg.Auth.APITokens.DefaultTTL
+    if req.ExpiresInDays > 0 {
+        ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+    }
+    if ttl > cfg.Auth.APITokens.MaxTTL {
+        response.Error(c, http.StatusBadRequest, "expiry exceeds the allowed maximum", gin.H{"max_days": int(cfg.Auth.APITokens.MaxTTL.Hours() / 24)})
+        return
+    }
+
+    raw, hash, err := authpkg.GenerateAPIToken()
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "create token failed", err.Error())
+        return
+    }
+    tok := &models.APIToken{
+        UserID:    userID,
+        Name:      req.Name,
+        Prefix:    raw[:len(authpkg.APITokenPrefix)+6],
+        TokenHash: hash,
+        Scopes:    strings.Join(list, " "),
+        ExpiresAt: time.Now().Add(ttl),
+        CreatedBy: c.GetString("user_id"),
+    }
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    if err := gdb.Create(tok).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "create token failed", err.Error())
+        return
+    }
+    data := apiTokenView(tok)
+    data["token"] = raw
+    response.Success(c, data)
+}
+
+func listAPITokens(c *gin.Context, userID string) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var list []models.APIToken
+    if err := gdb.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC").Find(&list).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    items := make([]gin.H, 0, len(list))
+    for i := range list {
+        items = append(items, apiTokenView(&list[i]))
+    }
+    response.Success(c, items)
+}
+
+func revokeAPIToken(c *gin.Context, userID, tokenID string) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    res := gdb.Model(&models.APIToken{}).
+        Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+        Update("revoked_at", time.Now())
+    if res.Error != nil {
+        response.Error(c, http.StatusInternalServerError, "revoke failed", res.Error.Error())
+        return
+    }
+    if res.RowsAffected == 0 {
+        response.Error(c, http.StatusNotFound, "token not found", nil)
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
+
+// ListAPITokensHandler returns the current user's active personal access tokens.
+func ListAPITokensHandler(c *gin.Context) {
+    listAPITokens(c, c.GetString("user_id"))
+}
+
+// CreateAPITokenHandler issues a personal access token for the current user.
+// The token acts with the user's role, limited to the requested scopes.
+func CreateAPITokenHandler(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        createAPIToken(c, e, c.GetString("user_id"))
+    }
+}
+
+// RevokeAPITokenHandler revokes one of the current user's tokens.
+func RevokeAPITokenHandler(c *gin.Context) {
+    revokeAPIToken(c, c.GetString("user_id"), c.Param("id"))
+}
+
+// RejectAPITokens keeps API tokens away from account management such as
+// sessions, passwords and creating further tokens.
+func RejectAPITokens() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if _, isToken := c.Get("token_scopes"); isToken {
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed with an API token"})
+            return
+        }
+        c.Next()
+    }
+}
+
+// serviceAccount loads the service account of the school named by the :id
+// path parameter.
+func serviceAccount(c *gin.Context) (*models.User, bool) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var user models.User
+    if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ? AND kind = ?", c.Param("id"), models.KindService).Error; err != nil {
+        response.Error(c, http.StatusNotFound, "service account not found", nil)
+        return nil, false
+    }
+    return &user, true
+}
+
+// ListServiceAccounts returns the service accounts of the school (admin only).
+func ListServiceAccounts(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var list []models.User
+    if err := gdb.Scopes(schoolScope(c, "school_id")).Where("kind = ?", models.KindService).Order("username").Find(&list).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, list)
+}
+
+// CreateServiceAccount creates a non-human account of the school that can
+// only authenticate with API tokens (admin only). It is disabled through the
+// user status endpoint.
+func CreateServiceAccount(c *gin.Context) {
+    var req createServiceAccountRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+    if err := utils.ValidateStruct(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+        return
+    }
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    now := time.Now()
+    user := &models.User{
+        Username:        req.Username,
+        Email:           req.Username + "@" + serviceAccountEmailDomain,
+        PasswordHash:    unusablePasswordHash,
+        Role:            req.Role,
+        Status:          models.StatusActive,
+        Kind:            models.KindService,
+        SchoolID:        optionalID(c.GetString("school_id")),
+        EmailVerifiedAt: &now,
+    }
+    if err := gdb.Create(user).Error; err != nil {
+        response.Error(c, http.StatusBadRequest, "create service account failed", err.Error())
+        return
+    }
+    response.Success(c, user)
+}
+
+// ListServiceAccountTokens returns the active tokens of a service account (admin only).
+func ListServiceAccountTokens(c *gin.Context) {
+    if user, ok := serviceAccount(c); ok {
+        listAPITokens(c, user.ID)
+    }
+}
+
+// CreateServiceAccountToken issues a token for a service account (admin only).
+func CreateServiceAccountToken(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if user, ok := serviceAccount(c); ok {
+            createAPIToken(c, e, user.ID)
+        }
+    }
+}
+
+// RevokeServiceAccountToken revokes a token of a service account (admin only).
+func RevokeServiceAccountToken(c *gin.Context) {
+    if user, ok := serviceAccount(c); ok {
+        revokeAPIToken(c, user.ID, c.Param("tokenId"))
+    }
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func newAPITokenDB(t *testing.T) *gorm.DB {
+    return testutil.NewDB(t, &models.User{}, &models.APIToken{}, &models.Session{}, &models.TokenRevocation{})
+}
+
+// issueAPIToken stores a token of user with scopes and returns it in plain.
+func issueAPIToken(t *testing.T, db *gorm.DB, user *models.User, scopes string) string {
+    t.Helper()
+    raw, hash, err := authpkg.GenerateAPIToken()
+    if err != nil {
+        t.Fatal(err)
+    }
+    tok := &models.APIToken{
+        UserID: user.ID, Name: "ci", Prefix: raw[:12], TokenHash: hash, Scopes: scopes,
+        ExpiresAt: time.Now().Add(time.Hour), CreatedBy: user.ID,
+    }
+    if err := db.Create(tok).Error; err != nil {
+        t.Fatal(err)
+    }
+    return raw
+}
+
+// newAPITokenRouter authenticates requests like cmd/api does.
+func newAPITokenRouter(t *testing.T, db *gorm.DB) *gin.Engine {
+    return newTestRouter(db, AuthMiddleware(newTestKeySet(t), authpkg.NewDenylist(db, time.Hour),
+        authpkg.NewStatusCache(db, time.Hour), authpkg.NewSessionTracker(db, time.Minute)))
+}
+
+// withBearer sends a GET request carrying token.
+func withBearer(h http.Handler, path, token string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest("GET", path, nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, req)
+    return w
+}
+
+func TestAPITokenScopes(t *testing.T) {
+    db := newAPITokenDB(t)
+    teacher := createSchoolUser(t, db, "anna", models.RoleTeacher, testSchool)
+    token := issueAPIToken(t, db, teacher, "assignments:read users:read")
+
+    e := newTestEnforcer()
+    ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+    r := newAPITokenRouter(t, db)
+    r.GET("/assignments", authpkg.RequirePermission(e, authpkg.PermAssignmentView), ok)
+    r.GET("/assignments/manage", authpkg.RequirePermission(e, authpkg.PermAssignmentManage), ok)
+    r.GET("/users", authpkg.RequirePermission(e, authpkg.PermUserView), ok)
+    r.GET("/account", RejectAPITokens(), ok)
+
+    tests := []struct {
+        name string
+        path string
+        want int
+    }{
+        {"granted by role and scope", "/assignments", http.StatusOK},
+        {"granted by role only", "/assignments/manage", http.StatusForbidden},
+        {"granted by scope only", "/users", http.StatusForbidden},
+        {"account management", "/account", http.StatusForbidden},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if w := withBearer(r, tt.path, token); w.Code != tt.want {
+                t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+            }
+        })
+    }
+
+    // the same routes stay open to a signed-in user
+    s := newTestRouter(db, asUser(teacher.ID, models.RoleTeacher, testSchool))
+    s.GET("/account", RejectAPITokens(), ok)
+    if w := doJSON(t, s, "GET", "/account", nil); w.Code != http.StatusOK {
+        t.Errorf("account management without a token: status %d", w.Code)
+    }
+}
+
+func TestAPITokenOwnerStatus(t *testing.T) {
+    db := newAPITokenDB(t)
+    r := newAPITokenRouter(t, db)
+    r.GET("/me", func(c *gin.Context) { c.String(http.StatusOK, c.GetString("user_id")) })
+
+    tests := []struct {
+        name   string
+        status string
+        kind   string
+        want   int
+    }{
+        {"active", models.StatusActive, models.KindHuman, http.StatusOK},
+        {"service account", models.StatusActive, models.KindService, http.StatusOK},
+        {"suspended", models.StatusSuspended, models.KindHuman, http.StatusForbidden},
+        {"inactive", models.StatusInactive, models.KindHuman, http.StatusForbidden},
+        {"unknown kind", models.StatusActive, "robot", http.StatusUnauthorized},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            u := createUser(t, db, &models.User{
+                Username: tt.name, Email: tt.name + "@example.org", Role: models.RoleTeacher,
+                Status: tt.status, Kind: tt.kind, SchoolID: optionalID(testSchool),
+            })
+            w := withBearer(r, "/me", issueAPIToken(t, db, u, "assignments:read"))
+            if w.Code != tt.want {
+                t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+            }
+
+            var tok models.APIToken
+            db.First(&tok, "user_id = ?", u.ID)
+            if used := tok.LastUsedAt != nil; used != (tt.want == http.StatusOK) {
+                t.Errorf("last used recorded = %v after status %d", used, w.Code)
+            }
+        })
+    }
+}
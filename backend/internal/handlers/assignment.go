@@ -11,14 +11,24 @@ import (
     "github.com/C14147/SmartCampus-Workbench/pkg/response"
 )
 
+// ListAssignments returns the assignments of the caller's courses, optionally
+// filtered by course_id.
 func ListAssignments(c *gin.Context) {
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
+    q := gdb.Scopes(assignmentScope(c, gdb, false))
+    if v := c.Query("course_id"); v != "" {
+        q = q.Where("course_id = ?", v)
+    }
     var list []models.Assignment
-    gdb.Find(&list)
+    if err := q.Order("due_date DESC").Find(&list).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
     response.Success(c, list)
 }
 
+// CreateAssignment adds an assignment to a course the caller manages.
 func CreateAssignment(c *gin.Context) {
     var req models.Assignment
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -31,6 +41,15 @@ func CreateAssignment(c *gin.Context) {
     }
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
+    ok, err := canManageCourse(c, gdb, req.CourseID)
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "create failed", err.Error())
+        return
+    }
+    if !ok {
+        response.Error(c, http.StatusForbidden, "you cannot manage assignments of this course", nil)
+        return
+    }
     if err := gdb.Create(&req).Error; err != nil {
         response.Error(c, http.StatusBadRequest, "create failed", err.Error())
         return
@@ -38,47 +57,86 @@ func CreateAssignment(c *gin.Context) {
     response.Success(c, req)
 }
 
+// GetAssignment returns an assignment of one of the caller's courses.
 func GetAssignment(c *gin.Context) {
     id := c.Param("id")
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
     var a models.Assignment
-    if err := gdb.First(&a, "id = ?", id).Error; err != nil {
+    if err := gdb.Scopes(assignmentScope(c, gdb, false)).First(&a, "id = ?", id).Error; err != nil {
         response.Error(c, http.StatusNotFound, "not found", nil)
         return
     }
     response.Success(c, a)
 }
 
+// findManagedAssignment loads the assignment in :id for a change. It answers
+// 404 when the caller cannot see it and 403 when they can only read it.
+func findManagedAssignment(c *gin.Context, gdb *gorm.DB) (*models.Assignment, bool) {
+    var a models.Assignment
+    if err := gdb.Scopes(assignmentScope(c, gdb, false)).First(&a, "id = ?", c.Param("id")).Error; err != nil {
+        response.Error(c, http.StatusNotFound, "not found", nil)
+        return nil, false
+    }
+    ok, err := canManageCourse(c, gdb, a.CourseID)
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "permission check failed", err.Error())
+        return nil, false
+    }
+    if !ok {
+        response.Error(c, http.StatusForbidden, "you cannot manage assignments of this course", nil)
+        return nil, false
+    }
+    return &a, true
+}
+
+// UpdateAssignment changes an assignment of a course the caller manages; it
+// can only be moved to another such course.
 func UpdateAssignment(c *gin.Context) {
-    id := c.Param("id")
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
-    var a models.Assignment
-    if err := gdb.First(&a, "id = ?", id).Error; err != nil {
-        response.Error(c, http.StatusNotFound, "not found", nil)
+    a, ok := findManagedAssignment(c, gdb)
+    if !ok {
         return
     }
-    if err := c.ShouldBindJSON(&a); err != nil {
+    id, courseID := a.ID, a.CourseID
+    if err := c.ShouldBindJSON(a); err != nil {
         response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
         return
     }
-    if err := utils.ValidateStruct(&a); err != nil {
+    // an id in the body must not redirect the save to another assignment
+    a.ID = id
+    if err := utils.ValidateStruct(a); err != nil {
         response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
         return
     }
-    if err := gdb.Save(&a).Error; err != nil {
+    if a.CourseID != courseID {
+        ok, err := canManageCourse(c, gdb, a.CourseID)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "update failed", err.Error())
+            return
+        }
+        if !ok {
+            response.Error(c, http.StatusForbidden, "you cannot manage assignments of this course", nil)
+            return
+        }
+    }
+    if err := gdb.Save(a).Error; err != nil {
         response.Error(c, http.StatusInternalServerError, "update failed", err.Error())
         return
     }
     response.Success(c, a)
 }
 
+// DeleteAssignment removes an assignment of a course the caller manages.
 func DeleteAssignment(c *gin.Context) {
-    id := c.Param("id")
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
-    if err := gdb.Delete(&models.Assignment{}, "id = ?", id).Error; err != nil {
+    a, ok := findManagedAssignment(c, gdb)
+    if !ok {
+        return
+    }
+    if err := gdb.Delete(&models.Assignment{}, "id = ?", a.ID).Error; err != nil {
         response.Error(c, http.StatusInternalServerError, "delete failed", err.Error())
         return
     }
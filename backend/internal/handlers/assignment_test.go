@@ -0,0 +1,70 @@
+package handlers
+
+import (
+    "net/http"
+    "testing"
+
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+// schoolFixture is one school with a class headed by head, a course of it
+// taught by teacher, and a student enrolled in the class.
+type schoolFixture struct {
+    school, class, course  string
+    head, teacher, student  string
+}
+
+const testSchool = "5c4e7a9e-0000-4000-8000-000000000001"
+
+func newSchoolFixture(t *testing.T, db *gorm.DB, school, suffix string) schoolFixture {
+    t.Helper()
+    f := schoolFixture{school: school}
+    f.head = createUser(t, db, &models.User{Username: "head" + suffix, Email: "head" + suffix + "@example.org", Role: models.RoleTeacher}).ID
+    f.teacher = createUser(t, db, &models.User{Username: "teacher" + suffix, Email: "teacher" + suffix + "@example.org", Role: models.RoleTeacher}).ID
+    f.student = createUser(t, db, &models.User{Username: "student" + suffix, Email: "student" + suffix + "@example.org", Role: models.RoleStudent}).ID
+    class := models.Class{SchoolID: school, Name: "1A" + suffix, HeadTeacher: f.head}
+    if err := db.Create(&class).Error; err != nil {
+        t.Fatal(err)
+    }
+    course := models.Course{Name: "Maths", Code: "MA" + suffix, TeacherID: f.teacher, ClassID: class.ID}
+    if err := db.Create(&course).Error; err != nil {
+        t.Fatal(err)
+    }
+    if err := db.Create(&models.ClassStudent{ClassID: class.ID, StudentID: f.student, Status: "active"}).Error; err != nil {
+        t.Fatal(err)
+    }
+    f.class, f.course = class.ID, course.ID
+    return f
+}
+
+func newScopeDB(t *testing.T) *gorm.DB {
+    return testutil.NewDB(t, &models.User{}, &models.Class{}, &models.Course{}, &models.ClassStudent{}, &models.Assignment{})
+}
+
+func TestCreateAssignmentValidatesCourse(t *testing.T) {
+    db := newScopeDB(t)
+    f := newSchoolFixture(t, db, testSchool, "")
+
+    for _, tc := range []struct {
+        name     string
+        courseID string
+        want     int
+    }{
+        {"missing course", "", http.StatusBadRequest},
+        {"malformed course", "maths", http.StatusBadRequest},
+        {"unknown course", "5c4e7a9e-0000-4000-8000-0000000000ff", http.StatusForbidden},
+        {"own course", f.course, http.StatusOK},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            r := newTestRouter(db, asUser(f.teacher, models.RoleTeacher, f.school))
+            r.POST("/assignments", CreateAssignment)
+            w := doJSON(t, r, "POST", "/assignments", map[string]string{"course_id": tc.courseID, "title": "Homework"})
+            if w.Code != tc.want {
+                t.Errorf("status %d, want %d: %s", w.Code, tc.want, w.Body)
+            }
+        })
+    }
+}
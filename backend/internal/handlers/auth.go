@@ -1,17 +1,22 @@
 package handlers
 
 import (
+    "errors"
     "fmt"
     "net/http"
+    "strconv"
     "time"
 
+    "github.com/casbin/casbin/v2"
     "github.com/gin-gonic/gin"
     "github.com/golang-jwt/jwt/v5"
-    "golang.org/x/crypto/bcrypt"
     "gorm.io/gorm"
 
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
     "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/mail"
     "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/password"
     "github.com/C14147/SmartCampus-Workbench/internal/utils"
     "github.com/C14147/SmartCampus-Workbench/pkg/response"
 )
@@ -25,86 +30,194 @@ type registerRequest struct {
     Username string `json:"username" binding:"required"`
     Email    string `json:"email" binding:"required,email"`
     Password string `json:"password" binding:"required"`
+    // required when registration is invite_only
+    InvitationCode string `json:"invitation_code"`
 }
 
-// RegisterHandler creates a user (uses GORM via context)
-func RegisterHandler(c *gin.Context) {
-    var req registerRequest
-    if err := c.ShouldBindJSON(&req); err != nil {
-        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
-        return
-    }
+// RegisterHandler creates an unverified user (uses GORM via context) and
+// mails an email verification link. An invitation code sets the role, school
+// and class of the new account.
+func RegisterHandler(m mail.Mailer, policy *password.Policy) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req registerRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
 
-    if err := utils.ValidateStruct(&req); err != nil {
-        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
-        return
-    }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
 
-    db, ok := c.Get("db")
-    if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
-        return
-    }
-    gdb := db.(*gorm.DB)
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
 
-    hash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-    user := &models.User{Username: req.Username, Email: req.Email, PasswordHash: string(hash), Role: "student"}
-    if err := gdb.Create(user).Error; err != nil {
-        response.Error(c, http.StatusBadRequest, "create user failed", err.Error())
-        return
-    }
+        if err := policy.Validate(req.Password, req.Username, req.Email); err != nil {
+            respondPasswordPolicy(c, err)
+            return
+        }
 
-    response.Success(c, gin.H{"id": user.ID, "username": user.Username})
-}
+        hash, err := hashPassword(req.Password)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "create user failed", err.Error())
+            return
+        }
+        cfg, _ := config.LoadConfig()
+        if req.InvitationCode == "" && cfg.Auth.Registration.Mode == RegistrationInviteOnly {
+            response.ErrorWithCode(c, http.StatusForbidden, CodeInvitationRequired, "registration requires an invitation code", nil)
+            return
+        }
 
-// LoginHandler verifies credentials and returns JWT
-func LoginHandler(c *gin.Context) {
-    var req loginRequest
-    if err := c.ShouldBindJSON(&req); err != nil {
-        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
-        return
+        user := &models.User{Username: req.Username, Email: req.Email, PasswordHash: hash, Role: models.RoleStudent}
+        err = gdb.Transaction(func(tx *gorm.DB) error {
+            var inv *models.Invitation
+            if req.InvitationCode != "" {
+                var err error
+                if inv, err = redeemInvitation(tx, req.InvitationCode); err != nil {
+                    return err
+                }
+                user.Role = inv.Role
+                user.SchoolID = &inv.SchoolID
+            }
+            if err := tx.Create(user).Error; err != nil {
+                return err
+            }
+            if inv != nil && inv.ClassID != nil {
+                return tx.Create(&models.ClassStudent{ClassID: *inv.ClassID, StudentID: user.ID}).Error
+            }
+            return nil
+        })
+        if errors.Is(err, errInvitationInvalid) {
+            response.ErrorWithCode(c, http.StatusBadRequest, CodeInvitationInvalid, err.Error(), nil)
+            return
+        }
+        if err != nil {
+            response.Error(c, http.StatusBadRequest, "create user failed", err.Error())
+            return
+        }
+        if err := sendEmailVerification(c, gdb, m, user); err != nil {
+            // the account exists; the user can ask for a new link via /auth/email/resend
+            _ = c.Error(err)
+        }
+
+        response.Success(c, gin.H{"id": user.ID, "username": user.Username, "role": user.Role, "school_id": user.SchoolID, "email_verified": false})
     }
+}
 
-    if err := utils.ValidateStruct(&req); err != nil {
-        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
-        return
+// LoginHandler verifies credentials with the configured authenticators and
+// returns an access token plus a refresh token, or an MFA challenge token when
+// a second factor is needed.
+// Repeated failures slow down and eventually lock the account and client IP.
+func LoginHandler(ks *authpkg.KeySet, e *casbin.SyncedEnforcer, guard *authpkg.LoginGuard, authn authpkg.AuthenticatorChain) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req loginRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
+
+        ip := c.ClientIP()
+        // the attempt counts as a failure until the credentials turn out right
+        if err := guard.Reserve(req.Username, ip); err != nil {
+            respondLoginRefused(c, err)
+            return
+        }
+
+        user, err := authn.Authenticate(c.Request.Context(), req.Username, req.Password)
+        if errors.Is(err, authpkg.ErrInvalidCredentials) || errors.Is(err, authpkg.ErrUnknownUser) {
+            response.Error(c, http.StatusUnauthorized, "invalid credentials", nil)
+            return
+        }
+        if err != nil {
+            // a backend is unreachable; not the user's fault, so the attempt is given back
+            _ = guard.Release(req.Username, ip)
+            response.Error(c, http.StatusServiceUnavailable, "login temporarily unavailable", err.Error())
+            return
+        }
+        // a disabled account neither clears its lockout nor gets its hash upgraded
+        if respondAccountStatus(c, user.Status) {
+            _ = guard.Release(req.Username, ip)
+            return
+        }
+        _ = guard.RecordSuccess(req.Username, ip)
+        if err := rehashPassword(gdb, user, req.Password); err != nil {
+            // the old hash keeps working; try again next time
+            _ = c.Error(err)
+        }
+
+        cfg, _ := config.LoadConfig()
+        if emailVerificationBlocksLogin(cfg, user) {
+            response.ErrorWithCode(c, http.StatusForbidden, CodeEmailNotVerified, "email address not verified", nil)
+            return
+        }
+        result, err := completeLogin(c, gdb, ks, e, cfg, user)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "token generation failed", err.Error())
+            return
+        }
+
+        response.Success(c, result)
     }
+}
 
-    db, ok := c.Get("db")
+// respondLoginRefused reports a lockout with its error code and a Retry-After header.
+func respondLoginRefused(c *gin.Context, err error) {
+    le, ok := authpkg.AsLockout(err)
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+        response.Error(c, http.StatusInternalServerError, "login failed", err.Error())
         return
     }
-    gdb := db.(*gorm.DB)
-
-    var user models.User
-    if err := gdb.Where("username = ?", req.Username).First(&user).Error; err != nil {
-        response.Error(c, http.StatusUnauthorized, "invalid credentials", nil)
-        return
+    seconds := int(le.RetryAfter.Seconds()) + 1
+    c.Header("Retry-After", strconv.Itoa(seconds))
+    status := http.StatusTooManyRequests
+    msg := "too many login attempts"
+    if le.Code == authpkg.CodeAccountLocked {
+        status = http.StatusLocked
+        msg = "account temporarily locked"
     }
+    response.ErrorWithCode(c, status, le.Code, msg, gin.H{"retry_after": seconds})
+}
 
-    if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-        response.Error(c, http.StatusUnauthorized, "invalid credentials", nil)
-        return
-    }
+// Error codes for accounts that may not sign in.
+const (
+    CodeAccountInactive  = "ACCOUNT_INACTIVE"
+    CodeAccountSuspended = "ACCOUNT_SUSPENDED"
+)
 
-    cfg, _ := config.LoadConfig()
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-        "sub":  user.ID,
-        "name": user.Username,
-        "role": user.Role,
-        "exp":  time.Now().Add(time.Hour * 24).Unix(),
-    })
-    signed, err := token.SignedString([]byte(cfg.JWT.Secret))
-    if err != nil {
-        response.Error(c, http.StatusInternalServerError, "token generation failed", err.Error())
-        return
-    }
+var errAccountNotActive = errors.New("account is not active")
 
-    response.Success(c, gin.H{"token": signed})
+// respondAccountStatus refuses a user whose account is not active and reports whether it did.
+func respondAccountStatus(c *gin.Context, status string) bool {
+    switch status {
+    case models.StatusActive:
+        return false
+    case models.StatusSuspended:
+        response.ErrorWithCode(c, http.StatusForbidden, CodeAccountSuspended, "account suspended", nil)
+    default:
+        response.ErrorWithCode(c, http.StatusForbidden, CodeAccountInactive, "account inactive", nil)
+    }
+    return true
 }
 
-// MeHandler returns a minimal current user; the AuthMiddleware will set userID in context
+// MeHandler returns a minimal current user; the AuthMiddleware will set userID in context.
+// During impersonation it names the admin acting as the user.
 func MeHandler(c *gin.Context) {
     uid, ok := c.Get("user_id")
     if !ok {
@@ -120,38 +233,186 @@ func MeHandler(c *gin.Context) {
         return
     }
 
-    response.Success(c, gin.H{"id": user.ID, "username": user.Username, "role": user.Role})
+    // role and school are the ones this token acts with
+    data := gin.H{"id": user.ID, "username": user.Username, "role": c.GetString("user_role"), "school_id": c.GetString("school_id"), "status": user.Status, "kind": user.Kind, "email_verified": user.EmailVerifiedAt != nil}
+    if actor := c.GetString("impersonator_id"); actor != "" {
+        var admin models.User
+        gdb.Unscoped().Select("id", "username").First(&admin, "id = ?", actor)
+        data["impersonated_by"] = gin.H{"id": actor, "username": admin.Username}
+    }
+    response.Success(c, data)
+}
+
+type logoutRequest struct {
+    RefreshToken string `json:"refresh_token"`
 }
 
-// AuthMiddleware parses JWT and sets user_id in context
-func AuthMiddleware() gin.HandlerFunc {
+// LogoutHandler ends the session of the presented access token. Tokens from
+// before session tracking are revoked on their own, together with the
+// refresh token family of the refresh token if one is supplied.
+func LogoutHandler(dl *authpkg.Denylist) gin.HandlerFunc {
     return func(c *gin.Context) {
-        auth := c.GetHeader("Authorization")
-        if auth == "" {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+        var req logoutRequest
+        // the body is optional
+        _ = c.ShouldBindJSON(&req)
+
+        uid := c.GetString("user_id")
+        exp, _ := c.Get("token_exp")
+        expiresAt, _ := exp.(time.Time)
+        if err := dl.RevokeToken(c.GetString("token_jti"), uid, expiresAt); err != nil {
+            response.Error(c, http.StatusInternalServerError, "logout failed", err.Error())
             return
         }
-        // expect Bearer <token>
-        var tokenString string
-        fmt.Sscanf(auth, "Bearer %s", &tokenString)
 
-        cfg, _ := config.LoadConfig()
-        token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-            return []byte(cfg.JWT.Secret), nil
-        })
-        if err != nil || !token.Valid {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-            return
+        if db, ok := c.Get("db"); ok {
+            gdb := db.(*gorm.DB)
+            sid := c.GetString("session_id")
+            if sid == "" && req.RefreshToken != "" {
+                var rt models.RefreshToken
+                if err := gdb.Where("token_hash = ? AND user_id = ?", authpkg.HashToken(req.RefreshToken), uid).First(&rt).Error; err == nil {
+                    sid = rt.FamilyID
+                }
+            }
+            if sid != "" {
+                if err := revokeSession(gdb, dl, sid, uid); err != nil {
+                    response.Error(c, http.StatusInternalServerError, "logout failed", err.Error())
+                    return
+                }
+            }
         }
-        if claims, ok := token.Claims.(jwt.MapClaims); ok {
-            if sub, ok := claims["sub"].(string); ok {
-                c.Set("user_id", sub)
+
+        response.Success(c, gin.H{"logged_out": true})
+    }
+}
+
+var (
+    errMissingAuthorization = errors.New("missing authorization header")
+    errInvalidToken         = errors.New("invalid token")
+    errTokenRevoked         = errors.New("token revoked")
+)
+
+// bearerToken returns the token of the Authorization header, or "" without one.
+func bearerToken(c *gin.Context) string {
+    // expect Bearer <token>
+    var tokenString string
+    fmt.Sscanf(c.GetHeader("Authorization"), "Bearer %s", &tokenString)
+    return tokenString
+}
+
+// authenticate verifies the bearer access token of the request and returns its claims.
+func authenticate(c *gin.Context, ks *authpkg.KeySet, dl *authpkg.Denylist) (jwt.MapClaims, error) {
+    if c.GetHeader("Authorization") == "" {
+        return nil, errMissingAuthorization
+    }
+    tokenString := bearerToken(c)
+
+    claims, err := authpkg.ParseAccessToken(ks, tokenString)
+    if err != nil {
+        return nil, errInvalidToken
+    }
+
+    sub, _ := claims["sub"].(string)
+    jti, _ := claims["jti"].(string)
+    sid, _ := claims["sid"].(string)
+    var issuedAt time.Time
+    if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+        issuedAt = iat.Time
+    }
+    if dl.IsRevoked(jti, sid, sub, issuedAt) {
+        return nil, errTokenRevoked
+    }
+    // signing the impersonating admin out ends their impersonation too
+    if actor := authpkg.Actor(claims); actor != "" && dl.IsRevoked("", "", actor, issuedAt) {
+        return nil, errTokenRevoked
+    }
+    return claims, nil
+}
+
+// AuthMiddleware verifies the JWT against the key named by its kid, rejects revoked tokens
+// and tokens of users that are no longer active, records session activity and sets user_id,
+// user_role and school_id (the school the request acts in) in context.
+// Personal access tokens are accepted as well; they additionally set token_scopes.
+func AuthMiddleware(ks *authpkg.KeySet, dl *authpkg.Denylist, sc *authpkg.StatusCache, st *authpkg.SessionTracker) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if raw := bearerToken(c); authpkg.IsAPIToken(raw) {
+            tok, user, err := authenticateAPIToken(c, raw)
+            var se *accountStatusError
+            if errors.As(err, &se) {
+                respondAccountStatus(c, se.status)
+                c.Abort()
+                return
+            }
+            if err != nil {
+                c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+                return
             }
-            if role, ok := claims["role"].(string); ok {
-                c.Set("user_role", role)
+            db, _ := c.Get("db")
+            if err := touchAPIToken(db.(*gorm.DB), tok); err != nil {
+                // activity tracking must not lock users out
+                _ = c.Error(err)
             }
+            // tokens act in their owner's own school with their own role
+            home := authpkg.HomeMembership(user)
+            c.Set("user_id", user.ID)
+            c.Set("user_role", home.Role)
+            c.Set("school_id", home.SchoolID)
+            c.Set("token_scopes", tok.ScopeList())
+            c.Set("api_token_id", tok.ID)
+            c.Next()
+            return
+        }
+
+        claims, err := authenticate(c, ks, dl)
+        if err != nil {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+            return
         }
+
+        sub, _ := claims["sub"].(string)
+        status, err := sc.Status(sub)
+        if err != nil {
+            _ = c.Error(err)
+            c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "account status lookup failed"})
+            return
+        }
+        if respondAccountStatus(c, status) {
+            c.Abort()
+            return
+        }
+        actor := authpkg.Actor(claims)
+        if actor != "" {
+            if status, err := sc.Status(actor); err != nil || status != models.StatusActive {
+                c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errTokenRevoked.Error()})
+                return
+            }
+            c.Set("impersonator_id", actor)
+        }
+
+        if sub != "" {
+            c.Set("user_id", sub)
+        }
+        if role, ok := claims["role"].(string); ok {
+            c.Set("user_role", role)
+        }
+        school, _ := claims["school"].(string)
+        c.Set("school_id", school)
+        jti, _ := claims["jti"].(string)
+        var expiresAt time.Time
+        if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+            expiresAt = exp.Time
+        }
+        sid, _ := claims["sid"].(string)
+        if err := st.Touch(sid); err != nil {
+            // activity tracking must not lock users out
+            _ = c.Error(err)
+        }
+        c.Set("token_jti", jti)
+        c.Set("token_exp", expiresAt)
+        c.Set("session_id", sid)
         c.Next()
+
+        if actor != "" {
+            auditImpersonatedRequest(c, actor, sub)
+        }
     }
 }
-
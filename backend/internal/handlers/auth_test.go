@@ -0,0 +1,57 @@
+package handlers
+
+import (
+    "net/http"
+    "testing"
+    "time"
+
+    "golang.org/x/crypto/bcrypt"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestLoginRefusesDisabledAccountBeforeSideEffects(t *testing.T) {
+    for _, status := range []string{models.StatusInactive, models.StatusSuspended} {
+        t.Run(status, func(t *testing.T) {
+            db := testutil.NewDB(t, &models.User{}, &models.LoginThrottle{})
+            // bcrypt is outdated, so a successful login would rehash it
+            hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+            if err != nil {
+                t.Fatal(err)
+            }
+            user := createUser(t, db, &models.User{
+                Username: "ana", Email: "ana@example.org", PasswordHash: string(hash), Status: status,
+            })
+            guard := authpkg.NewLoginGuard(db, config.LockoutConfig{
+                MaxAttempts: 5, Window: time.Hour, Duration: time.Hour,
+            })
+            if err := guard.Reserve("ana", "192.0.2.1"); err != nil {
+                t.Fatal(err)
+            }
+            authn, err := authpkg.NewAuthenticatorChain(db, config.AuthConfig{Authenticators: []string{"local"}})
+            if err != nil {
+                t.Fatal(err)
+            }
+            r := newTestRouter(db)
+            r.POST("/login", LoginHandler(nil, nil, guard, authn))
+
+            w := doJSON(t, r, "POST", "/login", map[string]string{"username": "ana", "password": "correct horse"})
+            if w.Code != http.StatusForbidden {
+                t.Fatalf("status %d, want 403: %s", w.Code, w.Body)
+            }
+            var n int64
+            db.Model(&models.LoginThrottle{}).Where("key = ? AND failures = 1", "user:ana").Count(&n)
+            if n != 1 {
+                t.Error("failure count of the account was cleared")
+            }
+            var stored models.User
+            db.First(&stored, "id = ?", user.ID)
+            if stored.PasswordHash != string(hash) {
+                t.Error("password hash was upgraded")
+            }
+        })
+    }
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/mail"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// Error codes of the email verification flow.
+const (
+    CodeEmailNotVerified = "EMAIL_NOT_VERIFIED"
+)
+
+type verifyEmailRequest struct {
+    Token string `json:"token" binding:"required"`
+}
+
+type resendVerificationRequest struct {
+    Email string `json:"email" binding:"required,email"`
+}
+
+var errVerificationTokenInvalid = errors.New("invalid or expired verification token")
+
+// sendEmailVerification replaces pending verification tokens of the user and
+// mails a new verification link.
+func sendEmailVerification(c *gin.Context, gdb *gorm.DB, m mail.Mailer, user *models.User) error {
+    cfg, _ := config.LoadConfig()
+    token, hash, err := authpkg.GenerateOpaqueToken()
+    if err != nil {
+        return err
+    }
+    err = gdb.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.EmailVerificationToken{}).Error; err != nil {
+            return err
+        }
+        return tx.Create(&models.EmailVerificationToken{
+            UserID:    user.ID,
+            TokenHash: hash,
+            ExpiresAt: time.Now().Add(cfg.Auth.EmailVerification.TokenTTL),
+        }).Error
+    })
+    if err != nil {
+        return err
+    }
+
+    link := cfg.Server.PublicURL + "/verify-email?token=" + url.QueryEscape(token)
+    return m.Send(c.Request.Context(), mail.Message{
+        To:      user.Email,
+        Subject: "Confirm your SmartCampus email address",
+        Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+            "The link expires in %s.\n", user.Username, link, cfg.Auth.EmailVerification.TokenTTL),
+    })
+}
+
+// emailVerificationBlocksLogin applies auth.email_verification.login_policy to a user.
+func emailVerificationBlocksLogin(cfg *config.Config, user *models.User) bool {
+    if user.EmailVerifiedAt != nil {
+        return false
+    }
+    policy := cfg.Auth.EmailVerification
+    switch policy.LoginPolicy {
+    case "allow":
+        return false
+    case "grace":
+        return time.Since(user.CreatedAt) > policy.GracePeriod
+    default:
+        return true
+    }
+}
+
+// VerifyEmailHandler marks the address of the token's owner as verified.
+func VerifyEmailHandler(c *gin.Context) {
+    var req verifyEmailRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+
+    db, ok := c.Get("db")
+    if !ok {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+        return
+    }
+    gdb := db.(*gorm.DB)
+
+    err := gdb.Transaction(func(tx *gorm.DB) error {
+        var vt models.EmailVerificationToken
+        if err := tx.Where("token_hash = ?", authpkg.HashToken(req.Token)).First(&vt).Error; err != nil {
+            return errVerificationTokenInvalid
+        }
+        if vt.UsedAt != nil || time.Now().After(vt.ExpiresAt) {
+            return errVerificationTokenInvalid
+        }
+        now := time.Now()
+        if err := tx.Model(&vt).Update("used_at", now).Error; err != nil {
+            return err
+        }
+        return tx.Model(&models.User{}).
+            Where("id = ? AND email_verified_at IS NULL", vt.UserID).
+            Update("email_verified_at", now).Error
+    })
+    if errors.Is(err, errVerificationTokenInvalid) {
+        response.Error(c, http.StatusBadRequest, err.Error(), nil)
+        return
+    }
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "verification failed", err.Error())
+        return
+    }
+
+    response.Success(c, gin.H{"message": "email address verified"})
+}
+
+// sentWithin reports whether a token of model (a table of mailed tokens with
+// user_id and created_at) was created for userID within d.
+func sentWithin(gdb *gorm.DB, model interface{}, userID string, d time.Duration) bool {
+    var n int64
+    gdb.Model(model).Where("user_id = ? AND created_at > ?", userID, time.Now().Add(-d)).Count(&n)
+    return n > 0
+}
+
+// ResendVerificationHandler mails a fresh verification link to an unverified
+// account, at most once per auth.email_verification.resend_cooldown. The
+// answer is the same whether or not a link was sent, so that it does not tell
+// which addresses have accounts.
+func ResendVerificationHandler(m mail.Mailer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req resendVerificationRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
+        cfg, _ := config.LoadConfig()
+
+        var user models.User
+        if err := gdb.Where("email = ? AND email_verified_at IS NULL", req.Email).First(&user).Error; err == nil {
+            if !sentWithin(gdb, &models.EmailVerificationToken{}, user.ID, cfg.Auth.EmailVerification.ResendCooldown) {
+                if err := sendEmailVerification(c, gdb, m, &user); err != nil {
+                    _ = c.Error(err)
+                }
+            }
+        }
+
+        response.Success(c, gin.H{"message": "if the address belongs to an unverified account, a verification link has been sent"})
+    }
+}
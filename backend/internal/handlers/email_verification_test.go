@@ -0,0 +1,46 @@
+package handlers
+
+import (
+    "net/http"
+    "testing"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/mail"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestResendVerificationDoesNotRevealAccounts(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.EmailVerificationToken{})
+    createUser(t, db, &models.User{Username: "ana", Email: "ana@example.org"})
+    mailer := mail.NewMemoryMailer()
+    r := newTestRouter(db)
+    r.POST("/resend", ResendVerificationHandler(mailer))
+
+    var bodies []string
+    for i, tc := range []struct {
+        email string
+        sent  int
+    }{
+        {"ana@example.org", 1},
+        // within the cooldown: nothing is sent, and nothing tells
+        {"ana@example.org", 1},
+        {"nobody@example.org", 1},
+    } {
+        w := doJSON(t, r, "POST", "/resend", map[string]string{"email": tc.email})
+        if w.Code != http.StatusOK {
+            t.Fatalf("request %d: status %d, want 200", i, w.Code)
+        }
+        if w.Header().Get("Retry-After") != "" {
+            t.Errorf("request %d: Retry-After header set", i)
+        }
+        if n := len(mailer.Messages()); n != tc.sent {
+            t.Errorf("request %d: %d mails sent, want %d", i, n, tc.sent)
+        }
+        bodies = append(bodies, w.Body.String())
+    }
+    for i := 1; i < len(bodies); i++ {
+        if bodies[i] != bodies[0] {
+            t.Errorf("response %d differs: %s vs %s", i, bodies[i], bodies[0])
+        }
+    }
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+type requestGuardianLinkRequest struct {
+    // both must match the same student
+    StudentUsername string `json:"student_username" binding:"required"`
+    StudentNumber   string `json:"student_number" binding:"required"`
+    Relationship    string `json:"relationship" validate:"max=50"`
+}
+
+type createGuardianLinkRequest struct {
+    GuardianID   string `json:"guardian_id" binding:"required" validate:"uuid"`
+    StudentID    string `json:"student_id" binding:"required" validate:"uuid"`
+    Relationship string `json:"relationship" validate:"max=50"`
+}
+
+// guardianStudent is a linked student as shown to the guardian.
+type guardianStudent struct {
+    LinkID       string     `json:"link_id"`
+    Status       string     `json:"status"`
+    Relationship string     `json:"relationship"`
+    VerifiedAt   *time.Time `json:"verified_at"`
+    StudentID    string     `json:"student_id"`
+    Username     string     `json:"username"`
+    StudentNo    *string    `json:"student_number"`
+}
+
+// studentGrade is a graded submission of a student.
+type studentGrade struct {
+    AssignmentID    string     `json:"assignment_id"`
+    AssignmentTitle string     `json:"assignment_title"`
+    MaxScore        float64    `json:"max_score"`
+    SubmissionID    string     `json:"submission_id"`
+    SubmittedAt     time.Time  `json:"submitted_at"`
+    Score           *float64   `json:"score"`
+    Feedback        string     `json:"feedback"`
+    GradedAt        *time.Time `json:"graded_at"`
+}
+
+// RequireGuardianLink lets a guardian through to routes about the student
+// in the :id parameter only with a verified link to that student.
+func RequireGuardianLink() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var n int64
+        err := gdb.Model(&models.GuardianLink{}).
+            Where("guardian_id = ? AND student_id = ? AND status = ?", c.GetString("user_id"), c.Param("id"), models.GuardianLinkVerified).
+            Count(&n).Error
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "link check failed", err.Error())
+            c.Abort()
+            return
+        }
+        if n == 0 {
+            // the same answer whether the student exists or not
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            c.Abort()
+            return
+        }
+        c.Next()
+    }
+}
+
+// RequestGuardianLink asks for a link to a student, identified by username
+// and student number. The link is pending until an admin verifies it.
+func RequestGuardianLink(c *gin.Context) {
+    var req requestGuardianLinkRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+    if err := utils.ValidateStruct(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+        return
+    }
+
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var student models.User
+    err := gdb.Joins("JOIN user_profiles ON user_profiles.user_id = users.id").
+        Where("users.username = ? AND users.role = ? AND user_profiles.student_id = ?", req.StudentUsername, models.RoleStudent, req.StudentNumber).
+        First(&student).Error
+    if err != nil {
+        response.Error(c, http.StatusNotFound, "no student with this username and student number", nil)
+        return
+    }
+    link := &models.GuardianLink{
+        GuardianID:   c.GetString("user_id"),
+        StudentID:    student.ID,
+        Relationship: req.Relationship,
+        Status:       models.GuardianLinkPending,
+    }
+    var existing models.GuardianLink
+    if err := gdb.First(&existing, "guardian_id = ? AND student_id = ?", link.GuardianID, link.StudentID).Error; err == nil {
+        response.Error(c, http.StatusConflict, "a link to this student already exists", gin.H{"status": existing.Status})
+        return
+    }
+    if err := gdb.Create(link).Error; err != nil {
+        response.Error(c, http.StatusBadRequest, "create link failed", err.Error())
+        return
+    }
+    response.Success(c, link)
+}
+
+// ListGuardianStudents returns the caller's links with their students.
+func ListGuardianStudents(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var list []guardianStudent
+    err := gdb.Table("guardian_links").
+        Select("guardian_links.id AS link_id, guardian_links.status, guardian_links.relationship, guardian_links.verified_at, "+
+            "users.id AS student_id, users.username, user_profiles.student_id AS student_no").
+        Joins("JOIN users ON users.id = guardian_links.student_id AND users.deleted_at IS NULL").
+        Joins("LEFT JOIN user_profiles ON user_profiles.user_id = users.id").
+        Where("guardian_links.guardian_id = ?", c.GetString("user_id")).
+        Order("guardian_links.created_at").
+        Scan(&list).Error
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, list)
+}
+
+// ListStudentAssignments returns the assignments of the courses of the
+// student's classes (guardians with a verified link).
+func ListStudentAssignments(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    courses := courseIDs(gdb, c.Param("id"), models.RoleStudent, false)
+    var list []models.Assignment
+    if err := gdb.Where("course_id IN (?)", courses).Order("due_date DESC").Find(&list).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, list)
+}
+
+// ListStudentGrades returns the student's graded submissions (guardians with
+// a verified link).
+func ListStudentGrades(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var list []studentGrade
+    err := gdb.Table("grades").
+        Select("assignments.id AS assignment_id, assignments.title AS assignment_title, assignments.max_score, "+
+            "assignment_submissions.id AS submission_id, assignment_submissions.submitted_at, "+
+            "grades.score, grades.feedback, grades.graded_at").
+        Joins("JOIN assignment_submissions ON assignment_submissions.id = grades.submission_id").
+        Joins("JOIN assignments ON assignments.id = assignment_submissions.assignment_id AND assignments.deleted_at IS NULL").
+        Where("assignment_submissions.student_id = ? AND grades.graded_at IS NOT NULL", c.Param("id")).
+        Order("grades.graded_at DESC").
+        Scan(&list).Error
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, list)
+}
+
+// ListStudentNotifications returns the current notifications the student
+// receives: those to everyone, to all students and to the student's classes
+// (guardians with a verified link).
+func ListStudentNotifications(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var list []models.Notification
+    err := gdb.Where("(expires_at IS NULL OR expires_at > ?)", time.Now()).
+        Where(gdb.Where("target_audience IN ?", []string{models.AudienceAll, models.AudienceStudents}).
+            Or("target_audience = ? AND target_id IN (?)", models.AudienceClass, studentClassIDs(gdb, c.Param("id")))).
+        Order("created_at DESC").
+        Find(&list).Error
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, list)
+}
+
+// schoolLinks restricts guardian links to students of the request's school.
+func schoolLinks(c *gin.Context, gdb *gorm.DB) func(*gorm.DB) *gorm.DB {
+    students := schoolUserIDs(c, gdb)
+    return func(q *gorm.DB) *gorm.DB {
+        if students == nil {
+            return q
+        }
+        return q.Where("student_id IN (?)", students)
+    }
+}
+
+// ListGuardianLinks returns the guardian links of the school's students,
+// optionally filtered by status, guardian_id and student_id (admin only).
+func ListGuardianLinks(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    page, size := pagination(c)
+
+    q := gdb.Model(&models.GuardianLink{}).Scopes(schoolLinks(c, gdb))
+    for _, f := range []string{"status", "guardian_id", "student_id"} {
+        if v := c.Query(f); v != "" {
+            q = q.Where(f+" = ?", v)
+        }
+    }
+    var total int64
+    if err := q.Count(&total).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    var list []models.GuardianLink
+    if err := q.Order("created_at DESC").Offset((page - 1) * size).Limit(size).Find(&list).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, gin.H{"items": list, "total": total, "page": page, "page_size": size})
+}
+
+// CreateGuardianLink links a guardian to a student of the school right away,
+// verified (admin only).
+func CreateGuardianLink(c *gin.Context) {
+    var req createGuardianLinkRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+    if err := utils.ValidateStruct(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+        return
+    }
+
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var guardian, student models.User
+    if err := gdb.First(&guardian, "id = ? AND role = ?", req.GuardianID, models.RoleGuardian).Error; err != nil {
+        response.Error(c, http.StatusBadRequest, "guardian not found", nil)
+        return
+    }
+    if err := gdb.Scopes(schoolScope(c, "school_id")).First(&student, "id = ? AND role = ?", req.StudentID, models.RoleStudent).Error; err != nil {
+        response.Error(c, http.StatusBadRequest, "student not found", nil)
+        return
+    }
+    adminID := c.GetString("user_id")
+    now := time.Now()
+    link := &models.GuardianLink{
+        GuardianID:   guardian.ID,
+        StudentID:    student.ID,
+        Relationship: req.Relationship,
+        Status:       models.GuardianLinkVerified,
+        VerifiedBy:   &adminID,
+        VerifiedAt:   &now,
+    }
+    if err := gdb.Create(link).Error; err != nil {
+        response.Error(c, http.StatusConflict, "create link failed", err.Error())
+        return
+    }
+    response.Success(c, link)
+}
+
+// setGuardianLinkStatus verifies or rejects a link (admin only).
+func setGuardianLinkStatus(status string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var link models.GuardianLink
+        if err := gdb.Scopes(schoolLinks(c, gdb)).First(&link, "id = ?", c.Param("id")).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        updates := map[string]interface{}{"status": status, "verified_by": nil, "verified_at": nil}
+        if status == models.GuardianLinkVerified {
+            updates["verified_by"] = c.GetString("user_id")
+            updates["verified_at"] = time.Now()
+        }
+        if err := gdb.Model(&link).Updates(updates).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "update failed", err.Error())
+            return
+        }
+        gdb.First(&link, "id = ?", link.ID)
+        response.Success(c, link)
+    }
+}
+
+// VerifyGuardianLink gives the guardian access to the student (admin only).
+func VerifyGuardianLink() gin.HandlerFunc { return setGuardianLinkStatus(models.GuardianLinkVerified) }
+
+// RejectGuardianLink refuses a link request or withdraws access (admin only).
+func RejectGuardianLink() gin.HandlerFunc { return setGuardianLinkStatus(models.GuardianLinkRejected) }
+
+// DeleteGuardianLink removes a link (admin only).
+func DeleteGuardianLink(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    res := gdb.Scopes(schoolLinks(c, gdb)).Delete(&models.GuardianLink{}, "id = ?", c.Param("id"))
+    if res.Error != nil {
+        response.Error(c, http.StatusInternalServerError, "delete failed", res.Error.Error())
+        return
+    }
+    if res.RowsAffected == 0 {
+        response.Error(c, http.StatusNotFound, "not found", nil)
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+    "net/http"
+    "sort"
+    "testing"
+    "time"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestGuardianLinkGivesReadAccess(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.UserProfile{}, &models.Class{}, &models.Course{}, &models.ClassStudent{},
+        &models.Assignment{}, &models.AssignmentSubmission{}, &models.Grade{}, &models.Notification{}, &models.GuardianLink{})
+    f := newSchoolFixture(t, db, testSchool, "")
+    db.Model(&models.User{}).Where("id = ?", f.student).Update("school_id", testSchool)
+    number := "S-1"
+    db.Create(&models.UserProfile{UserID: f.student, StudentID: &number})
+    other := newSchoolFixture(t, db, testSchool, "2")
+    guardian := createSchoolUser(t, db, "gina", models.RoleGuardian, "")
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    stranger := createSchoolUser(t, db, "otto", models.RoleAdmin, otherSchool)
+
+    assignment := models.Assignment{CourseID: f.course, Title: "Fractions", MaxScore: 10, DueDate: time.Now()}
+    db.Create(&assignment)
+    submission := models.AssignmentSubmission{AssignmentID: assignment.ID, StudentID: f.student, SubmittedAt: time.Now()}
+    db.Create(&submission)
+    score, gradedAt := 8.5, time.Now()
+    db.Create(&models.Grade{SubmissionID: submission.ID, Score: &score, GradedAt: &gradedAt})
+    for _, n := range []models.Notification{
+        {Title: "School fair", TargetAudience: models.AudienceAll},
+        {Title: "Class trip", TargetAudience: models.AudienceClass, TargetID: &f.class},
+        {Title: "Other class", TargetAudience: models.AudienceClass, TargetID: &other.class},
+        {Title: "Staff meeting", TargetAudience: models.AudienceTeachers},
+    } {
+        n.Content, n.NotificationType = "-", "announcement"
+        db.Create(&n)
+    }
+
+    g := newTestRouter(db, asUser(guardian.ID, models.RoleGuardian, ""))
+    g.POST("/guardian/links", RequestGuardianLink)
+    student := g.Group("/guardian/students/:id", RequireGuardianLink())
+    student.GET("/assignments", ListStudentAssignments)
+    student.GET("/grades", ListStudentGrades)
+    student.GET("/notifications", ListStudentNotifications)
+
+    request := func(number string) int {
+        return doJSON(t, g, "POST", "/guardian/links", map[string]string{"student_username": "student", "student_number": number}).Code
+    }
+    if code := request("S-2"); code != http.StatusNotFound {
+        t.Errorf("wrong student number: status %d, want 404", code)
+    }
+    if code := request("S-1"); code != http.StatusOK {
+        t.Fatalf("request link: status %d", code)
+    }
+    if code := request("S-1"); code != http.StatusConflict {
+        t.Errorf("second request: status %d, want 409", code)
+    }
+    if w := doJSON(t, g, "GET", "/guardian/students/"+f.student+"/grades", nil); w.Code != http.StatusNotFound {
+        t.Errorf("grades with a pending link: status %d, want 404", w.Code)
+    }
+
+    var link models.GuardianLink
+    db.First(&link, "guardian_id = ?", guardian.ID)
+    for _, tt := range []struct {
+        name   string
+        admin  string
+        school string
+        want   int
+    }{
+        {"admin of another school", stranger.ID, otherSchool, http.StatusNotFound},
+        {"admin of the student's school", admin.ID, testSchool, http.StatusOK},
+    } {
+        r := newTestRouter(db, asUser(tt.admin, models.RoleAdmin, tt.school))
+        r.POST("/admin/guardian-links/:id/verify", VerifyGuardianLink())
+        if w := doJSON(t, r, "POST", "/admin/guardian-links/"+link.ID+"/verify", nil); w.Code != tt.want {
+            t.Errorf("verify by %s: status %d, want %d", tt.name, w.Code, tt.want)
+        }
+    }
+
+    titles := func(path, key string) []string {
+        w := doJSON(t, g, "GET", path, nil)
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s: status %d: %s", path, w.Code, w.Body)
+        }
+        var got []string
+        for _, item := range decodeList(t, w) {
+            got = append(got, item[key].(string))
+        }
+        sort.Strings(got)
+        return got
+    }
+    base := "/guardian/students/" + f.student
+    if got := titles(base+"/assignments", "title"); len(got) != 1 || got[0] != "Fractions" {
+        t.Errorf("assignments %v", got)
+    }
+    if got := titles(base+"/grades", "assignment_title"); len(got) != 1 || got[0] != "Fractions" {
+        t.Errorf("grades %v", got)
+    }
+    if got := titles(base+"/notifications", "title"); len(got) != 2 || got[0] != "Class trip" || got[1] != "School fair" {
+        t.Errorf("notifications %v, want the class trip and the school fair", got)
+    }
+    if w := doJSON(t, g, "GET", "/guardian/students/"+other.student+"/grades", nil); w.Code != http.StatusNotFound {
+        t.Errorf("grades of an unlinked student: status %d, want 404", w.Code)
+    }
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "net/http"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// CodeImpersonationForbidden is returned for actions an impersonating admin may not take.
+const CodeImpersonationForbidden = "IMPERSONATION_FORBIDDEN"
+
+var errImpersonationForbidden = errors.New("not allowed while impersonating")
+
+type impersonateRequest struct {
+    Reason string `json:"reason" binding:"required" validate:"max=500"`
+}
+
+// ImpersonateUser issues a short-lived token with which the calling admin acts
+// as another user of the school, e.g. to reproduce what a student sees (admin only). The
+// token names both users, cannot be refreshed and every request made with it
+// is logged.
+func ImpersonateUser(ks *authpkg.KeySet, e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req impersonateRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var admin, user models.User
+        if err := gdb.First(&admin, "id = ?", c.GetString("user_id")).Error; err != nil {
+            response.Error(c, http.StatusUnauthorized, "unauthenticated", nil)
+            return
+        }
+        if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", c.Param("id")).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        // the user acts in the admin's school; district admins acting in
+        // every school get the user's default one
+        m := authpkg.DefaultMembership(e, &user)
+        if school := c.GetString("school_id"); school != "" {
+            m = authpkg.Membership{SchoolID: school, Role: authpkg.RoleInSchool(e, &user, school)}
+        }
+        switch {
+        case user.ID == admin.ID:
+            response.Error(c, http.StatusBadRequest, "cannot impersonate yourself", nil)
+            return
+        case isAdminRole(m.Role) || isAdminRole(user.Role):
+            response.Error(c, http.StatusForbidden, "admins cannot be impersonated", nil)
+            return
+        case user.Status != models.StatusActive:
+            response.Error(c, http.StatusBadRequest, "only active users can be impersonated", nil)
+            return
+        }
+
+        cfg, _ := config.LoadConfig()
+        token, err := authpkg.GenerateImpersonationToken(ks, &user, &admin, m, cfg.Auth.ImpersonationTTL)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "token generation failed", err.Error())
+            return
+        }
+        claims, _ := authpkg.ParseAccessToken(ks, token)
+        jti, _ := claims["jti"].(string)
+
+        entry := &models.ImpersonationLog{
+            ImpersonatorID: admin.ID,
+            UserID:         user.ID,
+            Kind:           models.ImpersonationStart,
+            Reason:         req.Reason,
+            Method:         c.Request.Method,
+            Path:           c.Request.URL.Path,
+            Status:         http.StatusOK,
+            IP:             c.ClientIP(),
+            TokenJTI:       jti,
+        }
+        // no audit entry, no impersonation
+        if err := gdb.Create(entry).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "audit log failed", err.Error())
+            return
+        }
+        log.Printf("impersonation: %s (%s) started acting as %s (%s): %s", admin.Username, admin.ID, user.Username, user.ID, req.Reason)
+
+        response.Success(c, gin.H{
+            "token":         token,
+            "token_type":    "Bearer",
+            "expires_in":    int(cfg.Auth.ImpersonationTTL.Seconds()),
+            "impersonating": gin.H{"id": user.ID, "username": user.Username, "role": m.Role, "school_id": m.SchoolID},
+        })
+    }
+}
+
+// ForbidImpersonation refuses sensitive actions (passwords, 2FA, sessions,
+// tokens) to an admin who is acting as another user.
+func ForbidImpersonation() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if c.GetString("impersonator_id") != "" {
+            response.ErrorWithCode(c, http.StatusForbidden, CodeImpersonationForbidden, errImpersonationForbidden.Error(), nil)
+            c.Abort()
+            return
+        }
+        c.Next()
+    }
+}
+
+// auditImpersonatedRequest records a request made with an impersonation token.
+func auditImpersonatedRequest(c *gin.Context, actor, userID string) {
+    log.Printf("impersonation: %s as %s: %s %s -> %d", actor, userID, c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+    db, ok := c.Get("db")
+    if !ok {
+        return
+    }
+    entry := &models.ImpersonationLog{
+        ImpersonatorID: actor,
+        UserID:         userID,
+        Kind:           models.ImpersonationRequest,
+        Method:         c.Request.Method,
+        Path:           c.Request.URL.Path,
+        Status:         c.Writer.Status(),
+        IP:             c.ClientIP(),
+        TokenJTI:       c.GetString("token_jti"),
+    }
+    if err := db.(*gorm.DB).Create(entry).Error; err != nil {
+        log.Printf("impersonation: audit log failed: %v", err)
+    }
+}
+
+// ListImpersonationLogs returns the impersonation audit trail of the users of
+// the school, newest first, optionally filtered by impersonator_id and
+// user_id (admin only).
+func ListImpersonationLogs(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    page, size := pagination(c)
+
+    q := gdb.Model(&models.ImpersonationLog{})
+    if users := schoolUserIDs(c, gdb); users != nil {
+        q = q.Where("user_id IN (?)", users)
+    }
+    if id := c.Query("impersonator_id"); id != "" {
+        q = q.Where("impersonator_id = ?", id)
+    }
+    if id := c.Query("user_id"); id != "" {
+        q = q.Where("user_id = ?", id)
+    }
+    var total int64
+    if err := q.Count(&total).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    var list []models.ImpersonationLog
+    if err := q.Order("created_at DESC").Offset((page - 1) * size).Limit(size).Find(&list).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, gin.H{"items": list, "total": total, "page": page, "page_size": size})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestImpersonateUserLimits(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.ImpersonationLog{})
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    colleague := createSchoolUser(t, db, "carla", models.RoleAdmin, testSchool)
+    promoted := createSchoolUser(t, db, "paul", models.RoleTeacher, testSchool)
+    suspended := createSchoolUser(t, db, "sam", models.RoleStudent, testSchool)
+    db.Model(suspended).Update("status", models.StatusSuspended)
+    stranger := createSchoolUser(t, db, "otto", models.RoleStudent, otherSchool)
+    student := createSchoolUser(t, db, "stella", models.RoleStudent, testSchool)
+
+    e := newTestEnforcer()
+    if _, err := e.AddGroupingPolicy(promoted.ID, models.RoleAdmin, testSchool); err != nil {
+        t.Fatal(err)
+    }
+    ks := newTestKeySet(t)
+    r := newTestRouter(db, asUser(admin.ID, models.RoleAdmin, testSchool))
+    r.POST("/users/:id/impersonate", ImpersonateUser(ks, e))
+
+    tests := []struct {
+        name string
+        id   string
+        body interface{}
+        want int
+    }{
+        {"without a reason", student.ID, map[string]string{}, http.StatusBadRequest},
+        {"yourself", admin.ID, nil, http.StatusBadRequest},
+        {"another admin", colleague.ID, nil, http.StatusForbidden},
+        {"admin in this school by grant", promoted.ID, nil, http.StatusForbidden},
+        {"suspended user", suspended.ID, nil, http.StatusBadRequest},
+        {"user of another school", stranger.ID, nil, http.StatusNotFound},
+        {"student", student.ID, nil, http.StatusOK},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            body := tt.body
+            if body == nil {
+                body = map[string]string{"reason": "ticket 42"}
+            }
+            if w := doJSON(t, r, "POST", "/users/"+tt.id+"/impersonate", body); w.Code != tt.want {
+                t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+            }
+        })
+    }
+
+    var logs []models.ImpersonationLog
+    db.Find(&logs)
+    if len(logs) != 1 || logs[0].UserID != student.ID || logs[0].ImpersonatorID != admin.ID ||
+        logs[0].Kind != models.ImpersonationStart || logs[0].Reason != "ticket 42" || logs[0].TokenJTI == "" {
+        t.Errorf("audit log %+v, want one start entry for the student", logs)
+    }
+}
+
+func TestImpersonationIsAudited(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.ImpersonationLog{}, &models.Session{}, &models.TokenRevocation{})
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    student := createSchoolUser(t, db, "stella", models.RoleStudent, testSchool)
+    ks := newTestKeySet(t)
+
+    start := newTestRouter(db, asUser(admin.ID, models.RoleAdmin, testSchool))
+    start.POST("/users/:id/impersonate", ImpersonateUser(ks, newTestEnforcer()))
+    w := doJSON(t, start, "POST", "/users/"+student.ID+"/impersonate", map[string]string{"reason": "ticket 42"})
+    if w.Code != http.StatusOK {
+        t.Fatalf("impersonate: status %d: %s", w.Code, w.Body)
+    }
+    token := decodeData(t, w)["token"].(string)
+
+    sc := authpkg.NewStatusCache(db, 0)
+    r := newTestRouter(db, AuthMiddleware(ks, authpkg.NewDenylist(db, time.Hour), sc, nil))
+    r.GET("/me", func(c *gin.Context) {
+        if c.GetString("user_id") != student.ID || c.GetString("impersonator_id") != admin.ID {
+            t.Errorf("request as %q by %q", c.GetString("user_id"), c.GetString("impersonator_id"))
+        }
+        c.Status(http.StatusOK)
+    })
+    r.GET("/password", ForbidImpersonation(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+    steps := []struct {
+        path string
+        want int
+    }{
+        {"/me", http.StatusOK},
+        {"/password", http.StatusForbidden},
+    }
+    for _, st := range steps {
+        if w := withBearer(r, st.path, token); w.Code != st.want {
+            t.Fatalf("%s: status %d, want %d: %s", st.path, w.Code, st.want, w.Body)
+        }
+    }
+
+    var logs []models.ImpersonationLog
+    db.Where("kind = ?", models.ImpersonationRequest).Find(&logs)
+    if len(logs) != len(steps) {
+        t.Fatalf("%d request entries, want %d", len(logs), len(steps))
+    }
+    for _, st := range steps {
+        var l models.ImpersonationLog
+        db.First(&l, "kind = ? AND path = ?", models.ImpersonationRequest, st.path)
+        if l.Status != st.want || l.ImpersonatorID != admin.ID || l.UserID != student.ID || l.TokenJTI == "" {
+            t.Errorf("entry %+v, want %s -> %d", l, st.path, st.want)
+        }
+    }
+
+    // the token dies with the admin's access
+    db.Model(admin).Update("status", models.StatusSuspended)
+    if w := withBearer(r, "/me", token); w.Code != http.StatusUnauthorized {
+        t.Errorf("after suspending the admin: status %d, want 401", w.Code)
+    }
+}
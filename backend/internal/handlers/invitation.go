@@ -0,0 +1,183 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// Registration modes.
+const (
+    RegistrationOpen       = "open"
+    RegistrationInviteOnly = "invite_only"
+)
+
+// Error codes of registration with an invitation.
+const (
+    CodeInvitationRequired = "INVITATION_REQUIRED"
+    CodeInvitationInvalid  = "INVITATION_INVALID"
+)
+
+var errInvitationInvalid = errors.New("invalid, expired or used up invitation code")
+
+type createInvitationRequest struct {
+    Role     string `json:"role" binding:"required" validate:"oneof=admin teacher student guardian"`
+    SchoolID string `json:"school_id" validate:"omitempty,uuid"`
+    ClassID  string `json:"class_id" validate:"omitempty,uuid"`
+    // defaults to 1; 0 allows unlimited uses until expiry (class-join codes)
+    MaxUses        *int `json:"max_uses" validate:"omitempty,min=0"`
+    ExpiresInHours int  `json:"expires_in_hours" validate:"omitempty,min=1"`
+}
+
+// redeemInvitation uses up one use of an invitation code inside tx.
+func redeemInvitation(tx *gorm.DB, code string) (*models.Invitation, error) {
+    var inv models.Invitation
+    hash := authpkg.HashToken(authpkg.NormalizeInvitationCode(code))
+    if err := tx.Where("code_hash = ?", hash).First(&inv).Error; err != nil {
+        return nil, errInvitationInvalid
+    }
+    if inv.RevokedAt != nil || time.Now().After(inv.ExpiresAt) {
+        return nil, errInvitationInvalid
+    }
+    // the guard on uses keeps concurrent registrations within max_uses
+    res := tx.Model(&models.Invitation{}).
+        Where("id = ? AND (max_uses = 0 OR uses < max_uses)", inv.ID).
+        Update("uses", gorm.Expr("uses + 1"))
+    if res.Error != nil {
+        return nil, res.Error
+    }
+    if res.RowsAffected == 0 {
+        return nil, errInvitationInvalid
+    }
+    return &inv, nil
+}
+
+// ListInvitations returns the open invitations of the school; teachers see
+// their own only.
+func ListInvitations(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+
+    q := gdb.Scopes(schoolScope(c, "school_id")).Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+    if !isAdminRole(c.GetString("user_role")) {
+        q = q.Where("created_by = ?", c.GetString("user_id"))
+    }
+    var list []models.Invitation
+    if err := q.Order("created_at DESC").Find(&list).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+    response.Success(c, list)
+}
+
+// CreateInvitation creates an invitation code into the school the request
+// acts in. Teachers may only invite students; admins may invite any role.
+// The code is only returned here.
+func CreateInvitation(c *gin.Context) {
+    var req createInvitationRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+    if err := utils.ValidateStruct(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+        return
+    }
+
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    if !isAdminRole(c.GetString("user_role")) && req.Role != models.RoleStudent {
+        response.Error(c, http.StatusForbidden, "teachers can only invite students", nil)
+        return
+    }
+    var ok bool
+    if req.SchoolID, ok = requestSchool(c, req.SchoolID); !ok {
+        response.Error(c, http.StatusForbidden, "you can only invite into your own school", nil)
+        return
+    }
+    if req.SchoolID == "" {
+        response.Error(c, http.StatusBadRequest, "school_id is required", nil)
+        return
+    }
+    var school models.School
+    if err := gdb.First(&school, "id = ?", req.SchoolID).Error; err != nil {
+        response.Error(c, http.StatusBadRequest, "school not found", nil)
+        return
+    }
+    inv := &models.Invitation{Role: req.Role, SchoolID: req.SchoolID, MaxUses: 1, CreatedBy: c.GetString("user_id")}
+    if req.ClassID != "" {
+        var class models.Class
+        if err := gdb.First(&class, "id = ? AND school_id = ?", req.ClassID, req.SchoolID).Error; err != nil {
+            response.Error(c, http.StatusBadRequest, "class not found in this school", nil)
+            return
+        }
+        ok, err := canManageClass(c, gdb, class.ID)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "create invitation failed", err.Error())
+            return
+        }
+        if !ok {
+            response.Error(c, http.StatusForbidden, "teachers can only invite into the class they head", nil)
+            return
+        }
+        inv.ClassID = &class.ID
+    }
+    if req.MaxUses != nil {
+        inv.MaxUses = *req.MaxUses
+    }
+
+    cfg, _ := config.LoadConfig()
+    ttl := cfg.Auth.Registration.InvitationTTL
+    if req.ExpiresInHours > 0 {
+        ttl = time.Duration(req.ExpiresInHours) * time.Hour
+    }
+    if ttl > cfg.Auth.Registration.MaxInvitationTTL {
+        response.Error(c, http.StatusBadRequest, "expiry exceeds the allowed maximum", gin.H{"max_hours": int(cfg.Auth.Registration.MaxInvitationTTL.Hours())})
+        return
+    }
+    inv.ExpiresAt = time.Now().Add(ttl)
+
+    code, err := authpkg.GenerateInvitationCode()
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "create invitation failed", err.Error())
+        return
+    }
+    inv.CodeHash = authpkg.HashToken(code)
+    inv.Hint = code[:5]
+    if err := gdb.Create(inv).Error; err != nil {
+        response.Error(c, http.StatusInternalServerError, "create invitation failed", err.Error())
+        return
+    }
+    response.Success(c, gin.H{"invitation": inv, "code": code})
+}
+
+// RevokeInvitation stops an invitation of the school from being used;
+// teachers can only revoke their own.
+func RevokeInvitation(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+
+    q := gdb.Model(&models.Invitation{}).Scopes(schoolScope(c, "school_id")).Where("id = ? AND revoked_at IS NULL", c.Param("id"))
+    if !isAdminRole(c.GetString("user_role")) {
+        q = q.Where("created_by = ?", c.GetString("user_id"))
+    }
+    res := q.Update("revoked_at", time.Now())
+    if res.Error != nil {
+        response.Error(c, http.StatusInternalServerError, "revoke failed", res.Error.Error())
+        return
+    }
+    if res.RowsAffected == 0 {
+        response.Error(c, http.StatusNotFound, "not found", nil)
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
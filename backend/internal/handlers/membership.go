@@ -0,0 +1,286 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+type switchSchoolRequest struct {
+    // "" acts in all schools (district admins)
+    SchoolID string `json:"school_id" validate:"omitempty,uuid"`
+}
+
+type roleGrantRequest struct {
+    Role string `json:"role" form:"role" binding:"required" validate:"oneof=district_admin admin teacher student guardian"`
+    // defaults to the school the admin acts in; * (all schools) for district_admin
+    SchoolID string `json:"school_id" form:"school_id" validate:"omitempty,uuid|eq=*"`
+}
+
+// schoolMembership is a school the user may act in, as listed to them.
+type schoolMembership struct {
+    authpkg.Membership
+    SchoolName string `json:"school_name"`
+}
+
+// ListMySchoolsHandler returns the schools the caller may act in with their
+// role there, and the one the current token acts in.
+func ListMySchoolsHandler(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+            response.Error(c, http.StatusUnauthorized, "unauthenticated", nil)
+            return
+        }
+        memberships := authpkg.Memberships(e, &user)
+        ids := make([]string, 0, len(memberships))
+        for _, m := range memberships {
+            if m.SchoolID != "" {
+                ids = append(ids, m.SchoolID)
+            }
+        }
+        var schools []models.School
+        if err := gdb.Select("id", "name").Where("id IN ?", ids).Find(&schools).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+            return
+        }
+        names := map[string]string{}
+        for _, s := range schools {
+            names[s.ID] = s.Name
+        }
+        list := make([]schoolMembership, 0, len(memberships))
+        for _, m := range memberships {
+            list = append(list, schoolMembership{Membership: m, SchoolName: names[m.SchoolID]})
+        }
+        response.Success(c, gin.H{
+            "current": authpkg.Membership{SchoolID: c.GetString("school_id"), Role: c.GetString("user_role")},
+            "schools": list,
+        })
+    }
+}
+
+// SwitchSchoolHandler moves the caller's session to another school they have
+// a role in and returns an access token acting there; refreshing the session
+// keeps the school. The token used for the switch is revoked.
+func SwitchSchoolHandler(ks *authpkg.KeySet, e *casbin.SyncedEnforcer, dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req switchSchoolRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+        sid := c.GetString("session_id")
+        if sid == "" {
+            response.Error(c, http.StatusBadRequest, "this token belongs to no session; sign in again", nil)
+            return
+        }
+
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+            response.Error(c, http.StatusUnauthorized, "unauthenticated", nil)
+            return
+        }
+        m := authpkg.Membership{SchoolID: req.SchoolID, Role: authpkg.RoleInSchool(e, &user, req.SchoolID)}
+        if m.Role == "" {
+            response.Error(c, http.StatusForbidden, "you have no role in this school", nil)
+            return
+        }
+        if err := gdb.Model(&models.Session{}).Where("id = ?", sid).Update("school_id", optionalID(m.SchoolID)).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "switch failed", err.Error())
+            return
+        }
+
+        cfg, _ := config.LoadConfig()
+        token, err := authpkg.GenerateAccessToken(ks, &user, m, sid, cfg.JWT.AccessTTL)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "token generation failed", err.Error())
+            return
+        }
+        exp, _ := c.Get("token_exp")
+        expiresAt, _ := exp.(time.Time)
+        if err := dl.RevokeToken(c.GetString("token_jti"), user.ID, expiresAt); err != nil {
+            _ = c.Error(err)
+        }
+        response.Success(c, gin.H{
+            "token":      token,
+            "token_type": "Bearer",
+            "expires_in": int(cfg.JWT.AccessTTL.Seconds()),
+            "school_id":  m.SchoolID,
+            "role":       m.Role,
+        })
+    }
+}
+
+// grantSchool returns the school a role grant of the request applies in, or
+// responds with an error. School admins grant in their own school only; the
+// district_admin role is granted by district admins, in all schools.
+func grantSchool(c *gin.Context, req *roleGrantRequest) (string, bool) {
+    district := c.GetString("user_role") == models.RoleDistrictAdmin
+    switch {
+    case req.Role == models.RoleDistrictAdmin && !district:
+        response.Error(c, http.StatusForbidden, "only district admins can grant district_admin", nil)
+        return "", false
+    case req.Role == models.RoleDistrictAdmin:
+        return authpkg.AllSchools, true
+    case req.SchoolID == authpkg.AllSchools && !district:
+        response.Error(c, http.StatusForbidden, "only district admins can grant roles in all schools", nil)
+        return "", false
+    case req.SchoolID == authpkg.AllSchools:
+        return authpkg.AllSchools, true
+    }
+    school, ok := requestSchool(c, req.SchoolID)
+    if !ok {
+        response.Error(c, http.StatusForbidden, "you can only grant roles in your own school", nil)
+        return "", false
+    }
+    if school == "" {
+        response.Error(c, http.StatusBadRequest, "school_id is required", nil)
+        return "", false
+    }
+    return school, true
+}
+
+// visibleGrants returns the role grants of userID in the request's school,
+// or all of them for district admins acting in all schools.
+func visibleGrants(c *gin.Context, e *casbin.SyncedEnforcer, userID string) ([]gin.H, error) {
+    rules, err := e.GetFilteredGroupingPolicy(0, userID)
+    if err != nil {
+        return nil, err
+    }
+    grants := []gin.H{}
+    for _, r := range rules {
+        if len(r) < 3 || (!allSchools(c) && r[2] != c.GetString("school_id") && r[2] != authpkg.AllSchools) {
+            continue
+        }
+        grants = append(grants, gin.H{"role": r[1], "school_id": r[2]})
+    }
+    return grants, nil
+}
+
+// ListUserRoles returns a user's home role and school and the roles granted
+// to them in the admin's school (admin only). Users who are neither from nor
+// granted a role in that school are not found.
+func ListUserRoles(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        grants, err := visibleGrants(c, e, user.ID)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+            return
+        }
+        home := authpkg.HomeMembership(&user)
+        if !allSchools(c) && home.SchoolID != c.GetString("school_id") && len(grants) == 0 {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        response.Success(c, gin.H{"home": home, "grants": grants})
+    }
+}
+
+// GrantUserRole gives a user a role in a school besides their home role, e.g.
+// to a teacher who also teaches at another school (admin only). It applies
+// from the user's next sign-in, refresh or school switch.
+func GrantUserRole(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req roleGrantRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+        school, ok := grantSchool(c, &req)
+        if !ok {
+            return
+        }
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        var user models.User
+        if err := gdb.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if school != authpkg.AllSchools {
+            var s models.School
+            if err := gdb.First(&s, "id = ?", school).Error; err != nil {
+                response.Error(c, http.StatusBadRequest, "school not found", nil)
+                return
+            }
+        }
+        added, err := e.AddRoleForUserInDomain(user.ID, req.Role, school)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "grant failed", err.Error())
+            return
+        }
+        if !added {
+            response.Error(c, http.StatusConflict, "the user already has this role there", nil)
+            return
+        }
+        response.Success(c, gin.H{"user_id": user.ID, "role": req.Role, "school_id": school})
+    }
+}
+
+// RevokeUserRole takes back a role granted with GrantUserRole, given by the
+// role and school_id query parameters, and signs the user out so that it
+// stops applying at once (admin only).
+func RevokeUserRole(e *casbin.SyncedEnforcer, dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req roleGrantRequest
+        if err := c.ShouldBindQuery(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+        school, ok := grantSchool(c, &req)
+        if !ok {
+            return
+        }
+        id := c.Param("id")
+        if id == c.GetString("user_id") {
+            response.Error(c, http.StatusBadRequest, "cannot revoke your own roles", nil)
+            return
+        }
+        removed, err := e.DeleteRoleForUserInDomain(id, req.Role, school)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "revoke failed", err.Error())
+            return
+        }
+        if !removed {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        db, _ := c.Get("db")
+        if err := revokeUserSessions(db.(*gorm.DB), dl, id); err != nil {
+            _ = c.Error(err)
+        }
+        c.Status(http.StatusNoContent)
+    }
+}
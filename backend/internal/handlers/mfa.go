@@ -0,0 +1,519 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/password"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// Error codes of the two-factor flow.
+const (
+    CodeMFAInvalidCode      = "MFA_INVALID_CODE"
+    CodeMFARequiredByPolicy = "MFA_REQUIRED_BY_POLICY"
+)
+
+type mfaVerifyRequest struct {
+    ChallengeToken string `json:"challenge_token" binding:"required"`
+    Code           string `json:"code"`
+    RecoveryCode   string `json:"recovery_code"`
+}
+
+type mfaEnrollRequest struct {
+    // required when enrolling during login instead of with an access token
+    ChallengeToken string `json:"challenge_token"`
+}
+
+type mfaActivateRequest struct {
+    ChallengeToken string `json:"challenge_token"`
+    Code           string `json:"code" binding:"required"`
+}
+
+type mfaDisableRequest struct {
+    Password     string `json:"password" binding:"required"`
+    Code         string `json:"code"`
+    RecoveryCode string `json:"recovery_code"`
+}
+
+type mfaCodeRequest struct {
+    Code string `json:"code" binding:"required"`
+}
+
+var (
+    errMFAInvalidCode  = errors.New("invalid two-factor code")
+    errMFANotEnabled   = errors.New("two-factor authentication is not enabled")
+    errMFANotEnrolling = errors.New("no pending two-factor enrollment")
+    errChallengeUsed   = errors.New("challenge token already used")
+)
+
+// mfaRequiredForUser reports whether any role user has in any of their
+// schools, or inherits, is listed in auth.mfa.required_roles.
+func mfaRequiredForUser(cfg *config.Config, e *casbin.SyncedEnforcer, user *models.User) bool {
+    for _, role := range authpkg.EffectiveRoles(e, user) {
+        for _, r := range cfg.Auth.MFA.RequiredRoles {
+            if r == role {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// completeLogin finishes a login whose first factor succeeded. Users with 2FA
+// get a challenge token for /auth/mfa/verify, users whose role requires 2FA
+// but who have not set it up get a challenge token for enrollment, and
+// everyone else gets their tokens right away.
+func completeLogin(c *gin.Context, gdb *gorm.DB, ks *authpkg.KeySet, e *casbin.SyncedEnforcer, cfg *config.Config, user *models.User) (gin.H, error) {
+    var m models.UserMFA
+    err := gdb.First(&m, "user_id = ?", user.ID).Error
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, err
+    }
+    enabled := err == nil && m.EnabledAt != nil
+
+    purpose := ""
+    switch {
+    case enabled:
+        purpose = authpkg.MFAPurposeVerify
+    case mfaRequiredForUser(cfg, e, user):
+        purpose = authpkg.MFAPurposeEnroll
+    default:
+        return issueTokens(c, gdb, ks, e, cfg, user, "")
+    }
+
+    challenge, err := authpkg.GenerateChallengeToken(ks, user.ID, purpose, cfg.Auth.MFA.ChallengeTTL)
+    if err != nil {
+        return nil, err
+    }
+    data := gin.H{
+        "challenge_token": challenge,
+        "expires_in":      int(cfg.Auth.MFA.ChallengeTTL.Seconds()),
+    }
+    if enabled {
+        data["mfa_required"] = true
+    } else {
+        data["mfa_enrollment_required"] = true
+    }
+    return data, nil
+}
+
+// verifySecondFactor accepts either a TOTP code (never the same time step
+// twice) or an unused recovery code, which is consumed.
+func verifySecondFactor(tx *gorm.DB, userID, code, recoveryCode string) (bool, error) {
+    if recoveryCode != "" {
+        hash := authpkg.HashToken(authpkg.NormalizeRecoveryCode(recoveryCode))
+        res := tx.Model(&models.MFARecoveryCode{}).
+            Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+            Update("used_at", time.Now())
+        if res.Error != nil {
+            return false, res.Error
+        }
+        if res.RowsAffected == 0 {
+            return false, errMFAInvalidCode
+        }
+        return true, nil
+    }
+
+    var m models.UserMFA
+    if err := tx.First(&m, "user_id = ? AND enabled_at IS NOT NULL", userID).Error; err != nil {
+        return false, errMFANotEnabled
+    }
+    step, ok := authpkg.ValidateTOTP(m.Secret, code, time.Now())
+    if !ok || step <= m.LastUsedStep {
+        return false, errMFAInvalidCode
+    }
+    res := tx.Model(&models.UserMFA{}).
+        Where("user_id = ? AND last_used_step < ?", userID, step).
+        Update("last_used_step", step)
+    if res.Error != nil {
+        return false, res.Error
+    }
+    if res.RowsAffected == 0 {
+        return false, errMFAInvalidCode
+    }
+    return false, nil
+}
+
+// replaceRecoveryCodes discards all recovery codes of a user and returns new ones.
+func replaceRecoveryCodes(tx *gorm.DB, userID string, n int) ([]string, error) {
+    if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+        return nil, err
+    }
+    codes := make([]string, 0, n)
+    for i := 0; i < n; i++ {
+        code, err := authpkg.GenerateRecoveryCode()
+        if err != nil {
+            return nil, err
+        }
+        if err := tx.Create(&models.MFARecoveryCode{UserID: userID, CodeHash: authpkg.HashToken(code)}).Error; err != nil {
+            return nil, err
+        }
+        codes = append(codes, code)
+    }
+    return codes, nil
+}
+
+// parseChallenge validates a challenge token for purpose that has not been
+// used or revoked yet.
+func parseChallenge(ks *authpkg.KeySet, dl *authpkg.Denylist, token, purpose string) (*authpkg.Challenge, error) {
+    ch, err := authpkg.ParseChallengeToken(ks, token, purpose)
+    if err != nil {
+        return nil, err
+    }
+    if dl.IsRevoked(ch.JTI, "", ch.UserID, ch.IssuedAt) {
+        return nil, errChallengeUsed
+    }
+    return ch, nil
+}
+
+// consumeChallenge marks a challenge token as used within the transaction of
+// its second step, so that neither counts without the other; it fails if
+// another request used the token first.
+func consumeChallenge(tx *gorm.DB, dl *authpkg.Denylist, ch *authpkg.Challenge) error {
+    ok, err := dl.ConsumeTokenTx(tx, ch.JTI, ch.UserID, ch.ExpiresAt)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return errChallengeUsed
+    }
+    return nil
+}
+
+// respondChallengeError reports a challenge token that cannot be used.
+func respondChallengeError(c *gin.Context, err error) {
+    if errors.Is(err, errChallengeUsed) {
+        response.Error(c, http.StatusUnauthorized, "invalid challenge token", nil)
+        return
+    }
+    response.Error(c, http.StatusInternalServerError, "token generation failed", err.Error())
+}
+
+// mfaSubject identifies the user of an enrollment request, either from an
+// enrollment challenge token (forced enrollment during login), which is then
+// returned too, or from the bearer access token of a signed-in user.
+func mfaSubject(c *gin.Context, ks *authpkg.KeySet, dl *authpkg.Denylist, challengeToken string) (string, *authpkg.Challenge, error) {
+    if challengeToken != "" {
+        ch, err := parseChallenge(ks, dl, challengeToken, authpkg.MFAPurposeEnroll)
+        if err != nil {
+            return "", nil, err
+        }
+        return ch.UserID, ch, nil
+    }
+    claims, err := authenticate(c, ks, dl)
+    if err != nil {
+        return "", nil, err
+    }
+    if authpkg.Actor(claims) != "" {
+        return "", nil, errImpersonationForbidden
+    }
+    uid, _ := claims["sub"].(string)
+    return uid, nil, nil
+}
+
+func respondMFAError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, errMFAInvalidCode):
+        response.ErrorWithCode(c, http.StatusUnauthorized, CodeMFAInvalidCode, err.Error(), nil)
+    case errors.Is(err, errMFANotEnabled), errors.Is(err, errMFANotEnrolling):
+        response.Error(c, http.StatusBadRequest, err.Error(), nil)
+    default:
+        response.Error(c, http.StatusInternalServerError, "two-factor check failed", err.Error())
+    }
+}
+
+// MFAVerifyHandler completes a login with the challenge token from
+// LoginHandler and a TOTP or recovery code. Wrong codes count towards the
+// login lockout of the account; the right one uses up the challenge token.
+func MFAVerifyHandler(ks *authpkg.KeySet, e *casbin.SyncedEnforcer, dl *authpkg.Denylist, guard *authpkg.LoginGuard) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req mfaVerifyRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
+
+        ch, err := parseChallenge(ks, dl, req.ChallengeToken, authpkg.MFAPurposeVerify)
+        if err != nil {
+            response.Error(c, http.StatusUnauthorized, "invalid challenge token", nil)
+            return
+        }
+        var user models.User
+        if err := gdb.First(&user, "id = ?", ch.UserID).Error; err != nil {
+            response.Error(c, http.StatusUnauthorized, "invalid challenge token", nil)
+            return
+        }
+        if respondAccountStatus(c, user.Status) {
+            return
+        }
+
+        ip := c.ClientIP()
+        if err := guard.Reserve(user.Username, ip); err != nil {
+            respondLoginRefused(c, err)
+            return
+        }
+
+        // a used up recovery code or TOTP step is rolled back when the
+        // challenge turns out to be used already
+        var usedRecovery bool
+        err = gdb.Transaction(func(tx *gorm.DB) error {
+            var err error
+            if usedRecovery, err = verifySecondFactor(tx, user.ID, req.Code, req.RecoveryCode); err != nil {
+                return err
+            }
+            return consumeChallenge(tx, dl, ch)
+        })
+        if err != nil {
+            // only wrong codes count as failed attempts
+            if !errors.Is(err, errMFAInvalidCode) {
+                _ = guard.Release(user.Username, ip)
+            }
+            if errors.Is(err, errChallengeUsed) {
+                respondChallengeError(c, err)
+            } else {
+                respondMFAError(c, err)
+            }
+            return
+        }
+        _ = guard.RecordSuccess(user.Username, ip)
+
+        cfg, _ := config.LoadConfig()
+        tokens, err := issueTokens(c, gdb, ks, e, cfg, &user, "")
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "token generation failed", err.Error())
+            return
+        }
+        if usedRecovery {
+            var remaining int64
+            gdb.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+            tokens["recovery_codes_remaining"] = remaining
+        }
+        response.Success(c, tokens)
+    }
+}
+
+// MFAEnrollHandler creates a pending TOTP secret and returns it together with
+// the otpauth:// URI for authenticator apps.
+func MFAEnrollHandler(ks *authpkg.KeySet, dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req mfaEnrollRequest
+        // the body is optional when called with an access token
+        _ = c.ShouldBindJSON(&req)
+
+        uid, _, err := mfaSubject(c, ks, dl, req.ChallengeToken)
+        if err != nil {
+            response.Error(c, http.StatusUnauthorized, "unauthenticated", err.Error())
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
+
+        var user models.User
+        if err := gdb.First(&user, "id = ?", uid).Error; err != nil {
+            response.Error(c, http.StatusUnauthorized, "unauthenticated", nil)
+            return
+        }
+        var existing models.UserMFA
+        if err := gdb.First(&existing, "user_id = ?", user.ID).Error; err == nil && existing.EnabledAt != nil {
+            response.Error(c, http.StatusConflict, "two-factor authentication already enabled", nil)
+            return
+        }
+
+        secret, err := authpkg.GenerateTOTPSecret()
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "enrollment failed", err.Error())
+            return
+        }
+        m := models.UserMFA{UserID: user.ID, Secret: secret}
+        err = gdb.Clauses(clause.OnConflict{
+            Columns:   []clause.Column{{Name: "user_id"}},
+            DoUpdates: clause.AssignmentColumns([]string{"secret", "enabled_at", "last_used_step", "updated_at"}),
+        }).Create(&m).Error
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "enrollment failed", err.Error())
+            return
+        }
+
+        cfg, _ := config.LoadConfig()
+        response.Success(c, gin.H{
+            "secret":      secret,
+            "otpauth_uri": authpkg.TOTPURI(cfg.Auth.MFA.Issuer, user.Username, secret),
+        })
+    }
+}
+
+// MFAActivateHandler enables a pending TOTP secret after checking a first code
+// and returns freshly generated recovery codes. When enrolling during login
+// the response also contains the access and refresh tokens.
+func MFAActivateHandler(ks *authpkg.KeySet, e *casbin.SyncedEnforcer, dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req mfaActivateRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+
+        uid, ch, err := mfaSubject(c, ks, dl, req.ChallengeToken)
+        if err != nil {
+            response.Error(c, http.StatusUnauthorized, "unauthenticated", err.Error())
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
+        cfg, _ := config.LoadConfig()
+
+        var codes []string
+        err = gdb.Transaction(func(tx *gorm.DB) error {
+            var m models.UserMFA
+            if err := tx.First(&m, "user_id = ? AND enabled_at IS NULL", uid).Error; err != nil {
+                return errMFANotEnrolling
+            }
+            step, ok := authpkg.ValidateTOTP(m.Secret, req.Code, time.Now())
+            if !ok {
+                return errMFAInvalidCode
+            }
+            now := time.Now()
+            if err := tx.Model(&m).Updates(map[string]interface{}{"enabled_at": now, "last_used_step": step}).Error; err != nil {
+                return err
+            }
+            var err error
+            if codes, err = replaceRecoveryCodes(tx, uid, cfg.Auth.MFA.RecoveryCodes); err != nil {
+                return err
+            }
+            // 2FA is not switched on with codes the user never gets to see
+            if ch != nil {
+                return consumeChallenge(tx, dl, ch)
+            }
+            return nil
+        })
+        if errors.Is(err, errChallengeUsed) {
+            respondChallengeError(c, err)
+            return
+        }
+        if err != nil {
+            respondMFAError(c, err)
+            return
+        }
+
+        data := gin.H{"enabled": true, "recovery_codes": codes}
+        if ch != nil {
+            var user models.User
+            if err := gdb.First(&user, "id = ?", uid).Error; err != nil {
+                response.Error(c, http.StatusInternalServerError, "token generation failed", err.Error())
+                return
+            }
+            if respondAccountStatus(c, user.Status) {
+                return
+            }
+            tokens, err := issueTokens(c, gdb, ks, e, cfg, &user, "")
+            if err != nil {
+                response.Error(c, http.StatusInternalServerError, "token generation failed", err.Error())
+                return
+            }
+            for k, v := range tokens {
+                data[k] = v
+            }
+        }
+        response.Success(c, data)
+    }
+}
+
+// MFADisableHandler turns 2FA off after re-checking password and a second
+// factor. Users with a role listed in auth.mfa.required_roles, in any of
+// their schools, cannot disable it.
+func MFADisableHandler(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req mfaDisableRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+
+        var user models.User
+        if err := gdb.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "user not found", nil)
+            return
+        }
+        cfg, _ := config.LoadConfig()
+        if mfaRequiredForUser(cfg, e, &user) {
+            response.ErrorWithCode(c, http.StatusForbidden, CodeMFARequiredByPolicy, "two-factor authentication is required for your role", nil)
+            return
+        }
+        if !password.Verify(req.Password, user.PasswordHash) {
+            response.Error(c, http.StatusUnauthorized, "invalid credentials", nil)
+            return
+        }
+
+        err := gdb.Transaction(func(tx *gorm.DB) error {
+            if _, err := verifySecondFactor(tx, user.ID, req.Code, req.RecoveryCode); err != nil {
+                return err
+            }
+            if err := tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+                return err
+            }
+            return tx.Where("user_id = ?", user.ID).Delete(&models.UserMFA{}).Error
+        })
+        if err != nil {
+            respondMFAError(c, err)
+            return
+        }
+        response.Success(c, gin.H{"enabled": false})
+    }
+}
+
+// MFARecoveryCodesHandler replaces the recovery codes of the current user.
+func MFARecoveryCodesHandler(c *gin.Context) {
+    var req mfaCodeRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    cfg, _ := config.LoadConfig()
+    uid := c.GetString("user_id")
+
+    var codes []string
+    err := gdb.Transaction(func(tx *gorm.DB) error {
+        if _, err := verifySecondFactor(tx, uid, req.Code, ""); err != nil {
+            return err
+        }
+        var err error
+        codes, err = replaceRecoveryCodes(tx, uid, cfg.Auth.MFA.RecoveryCodes)
+        return err
+    })
+    if err != nil {
+        respondMFAError(c, err)
+        return
+    }
+    response.Success(c, gin.H{"recovery_codes": codes})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+    "crypto/hmac"
+    "crypto/sha1"
+    "encoding/base32"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestMFAChallengeIsSingleUse(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.UserMFA{}, &models.MFARecoveryCode{},
+        &models.TokenRevocation{}, &models.Session{}, &models.RefreshToken{})
+    user := createUser(t, db, &models.User{Username: "ana", Email: "ana@example.org", Role: models.RoleTeacher})
+    now := time.Now()
+    if err := db.Create(&models.UserMFA{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP", EnabledAt: &now}).Error; err != nil {
+        t.Fatal(err)
+    }
+    codes, err := replaceRecoveryCodes(db, user.ID, 3)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ks := newTestKeySet(t)
+    dl := authpkg.NewDenylist(db, time.Hour)
+    r := newTestRouter(db)
+    r.POST("/verify", MFAVerifyHandler(ks, newTestEnforcer(), dl, nil))
+    challenge, err := authpkg.GenerateChallengeToken(ks, user.ID, authpkg.MFAPurposeVerify, time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for i, tc := range []struct {
+        name string
+        code string
+        want int
+    }{
+        {"wrong code", "AAAA-BBBB", http.StatusUnauthorized},
+        // a wrong code does not use up the challenge
+        {"right code", codes[0], http.StatusOK},
+        {"replayed challenge", codes[1], http.StatusUnauthorized},
+    } {
+        w := doJSON(t, r, "POST", "/verify", map[string]string{"challenge_token": challenge, "recovery_code": tc.code})
+        if w.Code != tc.want {
+            t.Errorf("%d %s: status %d, want %d: %s", i, tc.name, w.Code, tc.want, w.Body)
+        }
+    }
+
+    // the recovery code sent with the replayed challenge was not used up
+    var unused int64
+    db.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&unused)
+    if unused != 2 {
+        t.Errorf("%d unused recovery codes, want 2", unused)
+    }
+    next, err := authpkg.GenerateChallengeToken(ks, user.ID, authpkg.MFAPurposeVerify, time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    w := doJSON(t, r, "POST", "/verify", map[string]string{"challenge_token": next, "recovery_code": codes[1]})
+    if w.Code != http.StatusOK {
+        t.Errorf("recovery code of the replay on a new challenge: status %d, want 200: %s", w.Code, w.Body)
+    }
+}
+
+// totpCode computes the code of secret for a time step (RFC 6238, six digits).
+func totpCode(t *testing.T, secret string, step int64) string {
+    t.Helper()
+    key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var msg [8]byte
+    binary.BigEndian.PutUint64(msg[:], uint64(step))
+    mac := hmac.New(sha1.New, key)
+    mac.Write(msg[:])
+    sum := mac.Sum(nil)
+    offset := sum[len(sum)-1] & 0x0f
+    return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+func TestVerifySecondFactorRefusesReplays(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.UserMFA{}, &models.MFARecoveryCode{})
+    user := createUser(t, db, &models.User{Username: "ana", Email: "ana@example.org"})
+    const secret = "JBSWY3DPEHPK3PXP"
+    now := time.Now()
+    if err := db.Create(&models.UserMFA{UserID: user.ID, Secret: secret, EnabledAt: &now}).Error; err != nil {
+        t.Fatal(err)
+    }
+    codes, err := replaceRecoveryCodes(db, user.ID, 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    step := now.Unix() / 30
+
+    for _, tc := range []struct {
+        name      string
+        code      string
+        recovery  string
+        err       error
+        recovered bool
+    }{
+        {"previous step", totpCode(t, secret, step-1), "", nil, false},
+        {"current step", totpCode(t, secret, step), "", nil, false},
+        {"same code again", totpCode(t, secret, step), "", errMFAInvalidCode, false},
+        // an older step than the last used one is a replay too
+        {"step before the last used", totpCode(t, secret, step-1), "", errMFAInvalidCode, false},
+        {"outside the skew", totpCode(t, secret, step+2), "", errMFAInvalidCode, false},
+        {"recovery code", "", codes[0], nil, true},
+        {"recovery code again", "", codes[0], errMFAInvalidCode, false},
+        {"unknown recovery code", "", "aaaaa-bbbbb", errMFAInvalidCode, false},
+    } {
+        recovered, err := verifySecondFactor(db, user.ID, tc.code, tc.recovery)
+        if !errors.Is(err, tc.err) || (err == nil && recovered != tc.recovered) {
+            t.Errorf("%s: %v, %v; want %v, %v", tc.name, recovered, err, tc.recovered, tc.err)
+        }
+    }
+
+    other := createUser(t, db, &models.User{Username: "ben", Email: "ben@example.org"})
+    if _, err := verifySecondFactor(db, other.ID, totpCode(t, secret, step), ""); !errors.Is(err, errMFANotEnabled) {
+        t.Errorf("user without 2FA: %v, want %v", err, errMFANotEnabled)
+    }
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+    "crypto/subtle"
+    "errors"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// oidcStateCookie carries the signed login state from the redirect to the callback.
+const oidcStateCookie = "sc_oidc_state"
+
+// Error codes passed to the frontend in the sso_error query parameter.
+const (
+    CodeSSOFailed      = "SSO_FAILED"
+    CodeSSONoAccount   = "SSO_NO_ACCOUNT"
+    CodeSSONoRole      = "SSO_NO_ROLE"
+    CodeSSONoSchool    = "SSO_NO_SCHOOL"
+    // the local account with the email is unverified or an admin
+    CodeSSOLinkRefused = "SSO_LINK_REFUSED"
+)
+
+// ssoError is a failed SSO login with the code reported to the frontend.
+type ssoError struct {
+    code string
+    err  error
+}
+
+func (e *ssoError) Error() string { return e.code + ": " + e.err.Error() }
+
+// oidcReturnTo only allows paths within the frontend as post-login target.
+func oidcReturnTo(s string) string {
+    if !strings.HasPrefix(s, "/") || strings.HasPrefix(s, "//") || strings.Contains(s, "\\") {
+        return "/"
+    }
+    return s
+}
+
+// redirectSSOError sends the browser back to the frontend login page.
+func redirectSSOError(c *gin.Context, code string, err error) {
+    if err != nil {
+        _ = c.Error(err)
+    }
+    cfg, _ := config.LoadConfig()
+    c.Redirect(http.StatusFound, cfg.Server.PublicURL+"/login?"+url.Values{"sso_error": {code}}.Encode())
+}
+
+// OIDCLoginHandler starts an SSO login: it stores state, nonce and PKCE
+// verifier in a signed cookie and redirects the browser to the IdP.
+func OIDCLoginHandler(p *authpkg.OIDCProvider, ks *authpkg.KeySet) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        l, err := authpkg.NewOIDCLogin(oidcReturnTo(c.Query("return_to")))
+        if err != nil {
+            redirectSSOError(c, CodeSSOFailed, err)
+            return
+        }
+        ttl := p.Config().StateTTL
+        state, err := authpkg.GenerateOIDCStateToken(ks, l, ttl)
+        if err != nil {
+            redirectSSOError(c, CodeSSOFailed, err)
+            return
+        }
+        target, err := p.AuthCodeURL(c.Request.Context(), l)
+        if err != nil {
+            redirectSSOError(c, CodeSSOFailed, err)
+            return
+        }
+
+        c.SetSameSite(http.SameSiteLaxMode)
+        c.SetCookie(oidcStateCookie, state, int(ttl.Seconds()), "/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+        c.Redirect(http.StatusFound, target)
+    }
+}
+
+// OIDCCallbackHandler finishes an SSO login. The user is looked up by the
+// IdP identity, linked by verified email or created, and then receives our
+// normal token pair in the URL fragment of the frontend's /auth/sso page.
+// Second factors are the IdP's business, so no TOTP challenge follows.
+func OIDCCallbackHandler(p *authpkg.OIDCProvider, ks *authpkg.KeySet, enforcer *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        raw, _ := c.Cookie(oidcStateCookie)
+        // the state is single use
+        c.SetCookie(oidcStateCookie, "", -1, "/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+
+        l, err := authpkg.ParseOIDCStateToken(ks, raw)
+        if err != nil || subtle.ConstantTimeCompare([]byte(l.State), []byte(c.Query("state"))) != 1 {
+            redirectSSOError(c, CodeSSOFailed, errors.New("oidc: missing or mismatching state"))
+            return
+        }
+        if e := c.Query("error"); e != "" {
+            redirectSSOError(c, CodeSSOFailed, errors.New("oidc: provider returned "+e))
+            return
+        }
+        claims, err := p.Exchange(c.Request.Context(), c.Query("code"), l)
+        if err != nil {
+            redirectSSOError(c, CodeSSOFailed, err)
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            redirectSSOError(c, CodeSSOFailed, errors.New("database not configured"))
+            return
+        }
+        gdb := db.(*gorm.DB)
+        cfg, _ := config.LoadConfig()
+
+        user, err := oidcUser(gdb, p.Config(), claims)
+        if err != nil {
+            var se *ssoError
+            if errors.As(err, &se) {
+                redirectSSOError(c, se.code, se.err)
+            } else {
+                redirectSSOError(c, CodeSSOFailed, err)
+            }
+            return
+        }
+        switch user.Status {
+        case models.StatusActive:
+        case models.StatusSuspended:
+            redirectSSOError(c, CodeAccountSuspended, nil)
+            return
+        default:
+            redirectSSOError(c, CodeAccountInactive, nil)
+            return
+        }
+
+        var data gin.H
+        if p.Config().SkipMFA {
+            data, err = issueTokens(c, gdb, ks, enforcer, cfg, user, "")
+        } else {
+            data, err = completeLogin(c, gdb, ks, enforcer, cfg, user)
+        }
+        if err != nil {
+            redirectSSOError(c, CodeSSOFailed, err)
+            return
+        }
+        c.Redirect(http.StatusFound, cfg.Server.PublicURL+"/auth/sso#"+ssoFragment(data, l.ReturnTo).Encode())
+    }
+}
+
+// ssoFragment passes the result of completeLogin to the frontend: the tokens,
+// or the challenge token for /auth/mfa/verify or enrollment.
+func ssoFragment(data gin.H, returnTo string) url.Values {
+    f := url.Values{
+        "expires_in": {strconv.Itoa(data["expires_in"].(int))},
+        "return_to":  {returnTo},
+    }
+    if challenge, ok := data["challenge_token"].(string); ok {
+        f.Set("challenge_token", challenge)
+        if data["mfa_required"] == true {
+            f.Set("mfa_required", "true")
+        } else {
+            f.Set("mfa_enrollment_required", "true")
+        }
+        return f
+    }
+    f.Set("token", data["token"].(string))
+    f.Set("token_type", "Bearer")
+    f.Set("refresh_token", data["refresh_token"].(string))
+    return f
+}
+
+// oidcRole maps the role claim of an ID token to a role, or "" when no value is mapped.
+func oidcRole(oc config.OIDCConfig, claims jwt.MapClaims) string {
+    var values []string
+    switch v := claims[oc.RoleClaim].(type) {
+    case string:
+        values = strings.Fields(v)
+    case []interface{}:
+        for _, x := range v {
+            if s, ok := x.(string); ok {
+                values = append(values, s)
+            }
+        }
+    }
+    return authpkg.MapRole(oc.RoleMappings, values)
+}
+
+// oidcUser finds or provisions the user behind a verified ID token.
+func oidcUser(gdb *gorm.DB, oc config.OIDCConfig, claims jwt.MapClaims) (*models.User, error) {
+    id := authpkg.ExternalIdentity{Role: oidcRole(oc, claims)}
+    id.Issuer, _ = claims["iss"].(string)
+    id.Subject, _ = claims["sub"].(string)
+    id.Username, _ = claims["preferred_username"].(string)
+    id.Email, _ = claims["email"].(string)
+    id.EmailVerified = claims["email_verified"] == true || claims["email_verified"] == "true"
+    if oc.SchoolClaim != "" {
+        id.School, _ = claims[oc.SchoolClaim].(string)
+    }
+    if id.Subject == "" {
+        return nil, &ssoError{CodeSSOFailed, errors.New("oidc: id token without subject")}
+    }
+
+    user, err := authpkg.ProvisionUser(gdb, id, authpkg.ProvisionPolicy{
+        AllowSignup:     oc.AllowSignup,
+        LinkByEmail:     oc.LinkByEmail,
+        SyncRole:        oc.SyncRole,
+        DefaultRole:     oc.DefaultRole,
+        DefaultSchool:   oc.DefaultSchool,
+        AllowPrivileged: oc.LinkPrivileged,
+    })
+    switch {
+    case errors.Is(err, authpkg.ErrNoAccount):
+        return nil, &ssoError{CodeSSONoAccount, err}
+    case errors.Is(err, authpkg.ErrNoRole):
+        return nil, &ssoError{CodeSSONoRole, err}
+    case errors.Is(err, authpkg.ErrNoSchool):
+        return nil, &ssoError{CodeSSONoSchool, err}
+    case errors.Is(err, authpkg.ErrLinkUnverified), errors.Is(err, authpkg.ErrLinkPrivileged):
+        return nil, &ssoError{CodeSSOLinkRefused, err}
+    }
+    return user, err
+}
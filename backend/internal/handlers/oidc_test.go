@@ -0,0 +1,388 @@
+package handlers
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+const (
+    testClientID = "smartcampus"
+    testAuthCode = "code-1"
+)
+
+// mockIdP is an OpenID provider serving discovery, its JWKS and a token
+// endpoint that redeems testAuthCode for an ID token of the claims.
+type mockIdP struct {
+    srv *httptest.Server
+    key ed25519.PrivateKey
+    kid string
+    // signs the ID token instead of key when set
+    signer ed25519.PrivateKey
+    // client secret the token endpoint requires
+    secret string
+    // nonce and PKCE challenge of the last authorization request
+    nonce     string
+    challenge string
+    claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+    t.Helper()
+    _, key, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    idp := &mockIdP{key: key, kid: "idp-key-1"}
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(map[string]string{
+            "issuer":                 idp.srv.URL,
+            "authorization_endpoint": idp.srv.URL + "/authorize",
+            "token_endpoint":         idp.srv.URL + "/token",
+            "jwks_uri":               idp.srv.URL + "/jwks",
+        })
+    })
+    mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+        pub := idp.key.Public().(ed25519.PublicKey)
+        json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+            "kty": "OKP", "crv": "Ed25519", "use": "sig", "kid": idp.kid,
+            "x": base64.RawURLEncoding.EncodeToString(pub),
+        }}})
+    })
+    mux.HandleFunc("/token", idp.token)
+    idp.srv = httptest.NewServer(mux)
+    t.Cleanup(idp.srv.Close)
+    return idp
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+    if err := r.ParseForm(); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+    if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != testAuthCode ||
+        r.PostForm.Get("client_id") != testClientID || r.PostForm.Get("client_secret") != idp.secret ||
+        base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+        http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+        return
+    }
+
+    claims := jwt.MapClaims{
+        "iss":   idp.srv.URL,
+        "aud":   testClientID,
+        "exp":   time.Now().Add(time.Minute).Unix(),
+        "iat":   time.Now().Unix(),
+        "nonce": idp.nonce,
+    }
+    for k, v := range idp.claims {
+        claims[k] = v
+    }
+    signer := idp.key
+    if idp.signer != nil {
+        signer = idp.signer
+    }
+    tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+    tok.Header["kid"] = idp.kid
+    raw, err := tok.SignedString(signer)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    json.NewEncoder(w).Encode(map[string]string{"id_token": raw, "token_type": "Bearer"})
+}
+
+// oidcTestConfig returns the relying party settings for idp.
+func oidcTestConfig(idp *mockIdP) config.OIDCConfig {
+    return config.OIDCConfig{
+        Enabled:      true,
+        IssuerURL:    idp.srv.URL,
+        ClientID:     testClientID,
+        RedirectURL:  "http://api.test/api/v1/auth/oidc/callback",
+        Scopes:       []string{"openid", "email", "profile"},
+        RoleClaim:    "groups",
+        RoleMappings: []config.RoleMapping{{Value: "staff", Role: models.RoleTeacher}},
+        SchoolClaim:  "school",
+        AllowSignup:  true,
+        LinkByEmail:  true,
+        StateTTL:     5 * time.Minute,
+    }
+}
+
+// ssoLogin runs a browser through login and callback. state replaces the
+// state returned to the callback when set. It returns the final redirect.
+func ssoLogin(t *testing.T, r http.Handler, idp *mockIdP, state string) *url.URL {
+    t.Helper()
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/auth/oidc/login?return_to=/grades", nil))
+    if w.Code != http.StatusFound {
+        t.Fatalf("login: status %d, want 302", w.Code)
+    }
+    authURL, err := url.Parse(w.Header().Get("Location"))
+    if err != nil || !strings.HasPrefix(authURL.String(), idp.srv.URL+"/authorize?") {
+        t.Fatalf("login redirects to %q", w.Header().Get("Location"))
+    }
+    q := authURL.Query()
+    if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testClientID {
+        t.Fatalf("authorization request %v", q)
+    }
+    idp.nonce, idp.challenge = q.Get("nonce"), q.Get("code_challenge")
+    if state == "" {
+        state = q.Get("state")
+    }
+
+    req := httptest.NewRequest("GET", "/api/v1/auth/oidc/callback?"+url.Values{
+        "code": {testAuthCode}, "state": {state},
+    }.Encode(), nil)
+    for _, c := range w.Result().Cookies() {
+        req.AddCookie(c)
+    }
+    w = httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    if w.Code != http.StatusFound {
+        t.Fatalf("callback: status %d, want 302", w.Code)
+    }
+    target, err := url.Parse(w.Header().Get("Location"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return target
+}
+
+func newOIDCRouter(t *testing.T, db *gorm.DB, oc config.OIDCConfig) http.Handler {
+    t.Helper()
+    ks := newTestKeySet(t)
+    p := authpkg.NewOIDCProvider(oc)
+    r := newTestRouter(db)
+    r.GET("/api/v1/auth/oidc/login", OIDCLoginHandler(p, ks))
+    r.GET("/api/v1/auth/oidc/callback", OIDCCallbackHandler(p, ks, newTestEnforcer()))
+    return r
+}
+
+// newOIDCDB returns a database with the school NORTH.
+func newOIDCDB(t *testing.T) *gorm.DB {
+    db := testutil.NewDB(t, &models.School{}, &models.User{}, &models.UserIdentity{}, &models.UserMFA{}, &models.Session{}, &models.RefreshToken{})
+    if err := db.Create(&models.School{ID: testSchool, Name: "North", Code: "NORTH"}).Error; err != nil {
+        t.Fatal(err)
+    }
+    return db
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+    db := newOIDCDB(t)
+    idp := newMockIdP(t)
+    idp.claims = jwt.MapClaims{
+        "sub": "idp-user-1", "email": "ana@example.org", "email_verified": true,
+        "preferred_username": "ana", "groups": []string{"staff"}, "school": "NORTH",
+    }
+    r := newOIDCRouter(t, db, oidcTestConfig(idp))
+
+    target := ssoLogin(t, r, idp, "")
+    if target.Path != "/auth/sso" {
+        t.Fatalf("callback redirects to %s, want /auth/sso", target)
+    }
+    frag, _ := url.ParseQuery(target.Fragment)
+    if frag.Get("token") == "" || frag.Get("refresh_token") == "" || frag.Get("return_to") != "/grades" {
+        t.Fatalf("fragment %v lacks the tokens or return_to", frag)
+    }
+
+    var user models.User
+    if err := db.First(&user, "username = ?", "ana").Error; err != nil {
+        t.Fatalf("user not provisioned: %v", err)
+    }
+    if user.Role != models.RoleTeacher || user.EmailVerifiedAt == nil || user.SchoolID == nil || *user.SchoolID != testSchool {
+        t.Errorf("user role %q, email verified %v, school %v; want teacher, verified, NORTH", user.Role, user.EmailVerifiedAt != nil, user.SchoolID)
+    }
+    var ident models.UserIdentity
+    if err := db.First(&ident, "issuer = ? AND subject = ?", idp.srv.URL, "idp-user-1").Error; err != nil || ident.UserID != user.ID {
+        t.Errorf("identity %+v, err %v; want linked to %s", ident, err, user.ID)
+    }
+
+    // the second login finds the user through the identity
+    if target := ssoLogin(t, r, idp, ""); target.Path != "/auth/sso" {
+        t.Fatalf("second login redirects to %s", target)
+    }
+    var n int64
+    db.Model(&models.User{}).Count(&n)
+    if n != 1 {
+        t.Errorf("%d users after two logins, want 1", n)
+    }
+}
+
+func TestOIDCLoginFailures(t *testing.T) {
+    _, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+    claims := func() jwt.MapClaims {
+        return jwt.MapClaims{"sub": "idp-user-1", "email": "ana@example.org", "email_verified": true, "groups": "staff", "school": "NORTH"}
+    }
+    tests := []struct {
+        name    string
+        state   string
+        setup   func(idp *mockIdP, oc *config.OIDCConfig)
+        wantSSO string
+    }{
+        {name: "state mismatch", state: "forged", wantSSO: CodeSSOFailed},
+        {name: "wrong nonce", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            idp.claims["nonce"] = "replayed"
+        }, wantSSO: CodeSSOFailed},
+        {name: "other audience", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            idp.claims["aud"] = "another-client"
+        }, wantSSO: CodeSSOFailed},
+        {name: "other issuer", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            idp.claims["iss"] = "https://evil.example.org"
+        }, wantSSO: CodeSSOFailed},
+        {name: "expired id token", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            idp.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+        }, wantSSO: CodeSSOFailed},
+        {name: "signed with an unknown key", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            idp.signer = otherKey
+        }, wantSSO: CodeSSOFailed},
+        {name: "token endpoint rejects the client", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            idp.secret, oc.ClientSecret = "s3cret", "wrong"
+        }, wantSSO: CodeSSOFailed},
+        {name: "signup disabled", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            oc.AllowSignup = false
+        }, wantSSO: CodeSSONoAccount},
+        {name: "unmapped role", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            idp.claims["groups"] = "visitors"
+        }, wantSSO: CodeSSONoRole},
+        {name: "unknown school", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            idp.claims["school"] = "WEST"
+        }, wantSSO: CodeSSONoSchool},
+        {name: "no school", setup: func(idp *mockIdP, oc *config.OIDCConfig) {
+            delete(idp.claims, "school")
+        }, wantSSO: CodeSSONoSchool},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db := newOIDCDB(t)
+            idp := newMockIdP(t)
+            idp.claims = claims()
+            oc := oidcTestConfig(idp)
+            if tt.setup != nil {
+                tt.setup(idp, &oc)
+            }
+            r := newOIDCRouter(t, db, oc)
+
+            target := ssoLogin(t, r, idp, tt.state)
+            if target.Path != "/login" || target.Query().Get("sso_error") != tt.wantSSO {
+                t.Errorf("callback redirects to %s, want /login?sso_error=%s", target, tt.wantSSO)
+            }
+            if strings.Contains(target.String(), "token=") {
+                t.Errorf("failed login carries tokens: %s", target)
+            }
+            var n int64
+            db.Model(&models.Session{}).Count(&n)
+            if n != 0 {
+                t.Errorf("%d sessions after a failed login, want 0", n)
+            }
+        })
+    }
+}
+
+func TestOIDCLinksExistingUserByVerifiedEmail(t *testing.T) {
+    db := newOIDCDB(t)
+    idp := newMockIdP(t)
+    verifiedAt := time.Now()
+    existing := createUser(t, db, &models.User{
+        Username: "bea", Email: "bea@example.org", Role: models.RoleStudent, Status: models.StatusActive, EmailVerifiedAt: &verifiedAt,
+    })
+    createUser(t, db, &models.User{Username: "cem", Email: "cem@example.org", Role: models.RoleStudent, Status: models.StatusActive})
+    oc := oidcTestConfig(idp)
+    oc.AllowSignup = false
+
+    tests := []struct {
+        name      string
+        sub       string
+        email     string
+        verified  bool
+        wantPath  string
+        wantError string
+    }{
+        {"unverified at the IdP", "idp-bea", "bea@example.org", false, "/login", CodeSSONoAccount},
+        {"unverified local account", "idp-cem", "cem@example.org", true, "/login", CodeSSOLinkRefused},
+        {"verified on both sides", "idp-bea", "bea@example.org", true, "/auth/sso", ""},
+    }
+    r := newOIDCRouter(t, db, oc)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            idp.claims = jwt.MapClaims{"sub": tt.sub, "email": tt.email, "email_verified": tt.verified}
+            target := ssoLogin(t, r, idp, "")
+            if target.Path != tt.wantPath || target.Query().Get("sso_error") != tt.wantError {
+                t.Fatalf("callback redirects to %s, want %s with sso_error %q", target, tt.wantPath, tt.wantError)
+            }
+        })
+    }
+    var idents []models.UserIdentity
+    db.Find(&idents)
+    if len(idents) != 1 || idents[0].UserID != existing.ID {
+        t.Errorf("identities %+v, want one linked to %s", idents, existing.ID)
+    }
+}
+
+func TestOIDCLoginRequiresSecondFactor(t *testing.T) {
+    tests := []struct {
+        name    string
+        groups  string
+        totp    bool
+        skipMFA bool
+        want    string
+    }{
+        {"no 2FA", "staff", false, false, "token"},
+        {"2FA enabled", "staff", true, false, "mfa_required"},
+        {"role requires 2FA", "district", false, false, "mfa_enrollment_required"},
+        {"IdP enforces 2FA", "staff", true, true, "token"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db := newOIDCDB(t)
+            idp := newMockIdP(t)
+            verifiedAt := time.Now()
+            user := createUser(t, db, &models.User{
+                Username: "ana", Email: "ana@example.org", Role: models.RoleTeacher, Status: models.StatusActive, EmailVerifiedAt: &verifiedAt,
+            })
+            if tt.totp {
+                if err := db.Create(&models.UserMFA{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP", EnabledAt: &verifiedAt}).Error; err != nil {
+                    t.Fatal(err)
+                }
+            }
+            oc := oidcTestConfig(idp)
+            oc.SyncRole = true
+            oc.SkipMFA = tt.skipMFA
+            oc.RoleMappings = append(oc.RoleMappings, config.RoleMapping{Value: "district", Role: models.RoleDistrictAdmin})
+            idp.claims = jwt.MapClaims{"sub": "idp-ana", "email": "ana@example.org", "email_verified": true, "groups": tt.groups}
+
+            target := ssoLogin(t, newOIDCRouter(t, db, oc), idp, "")
+            frag, _ := url.ParseQuery(target.Fragment)
+            if target.Path != "/auth/sso" || frag.Get(tt.want) == "" {
+                t.Fatalf("callback redirects to %s, want /auth/sso with %s", target, tt.want)
+            }
+            if tt.want != "token" {
+                if frag.Get("token") != "" || frag.Get("refresh_token") != "" || frag.Get("challenge_token") == "" {
+                    t.Errorf("fragment %v: want a challenge token and no tokens", frag)
+                }
+                var n int64
+                db.Model(&models.Session{}).Count(&n)
+                if n != 0 {
+                    t.Errorf("%d sessions before the second factor, want 0", n)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/mail"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/password"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+type forgotPasswordRequest struct {
+    Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordRequest struct {
+    Token    string `json:"token" binding:"required"`
+    Password string `json:"password" binding:"required"`
+}
+
+type changePasswordRequest struct {
+    CurrentPassword string `json:"current_password" binding:"required"`
+    NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// CodeWeakPassword is returned when a new password violates the password policy.
+const CodeWeakPassword = "WEAK_PASSWORD"
+
+var errResetTokenInvalid = errors.New("invalid or expired reset token")
+
+// hashPassword hashes pw with the configured algorithm (password.hash).
+func hashPassword(pw string) (string, error) {
+    cfg, _ := config.LoadConfig()
+    h, err := password.NewHasher(cfg.Password.Hash)
+    if err != nil {
+        return "", err
+    }
+    return h.Hash(pw)
+}
+
+// rehashPassword upgrades the stored hash of a user who has just logged in
+// with pw when it was made with an outdated algorithm or parameters. Only a
+// pw matching the local hash is stored, so logins through another backend
+// (e.g. LDAP) never overwrite it.
+func rehashPassword(gdb *gorm.DB, user *models.User, pw string) error {
+    cfg, _ := config.LoadConfig()
+    h, err := password.NewHasher(cfg.Password.Hash)
+    if err != nil {
+        return err
+    }
+    if user.PasswordHash == unusablePasswordHash || !h.NeedsRehash(user.PasswordHash) || !password.Verify(pw, user.PasswordHash) {
+        return nil
+    }
+    hash, err := h.Hash(pw)
+    if err != nil {
+        return err
+    }
+    // the old hash guards against overwriting a password changed meanwhile
+    return gdb.Model(&models.User{}).
+        Where("id = ? AND password_hash = ?", user.ID, user.PasswordHash).
+        Update("password_hash", hash).Error
+}
+
+// respondPasswordPolicy answers with the policy violations if err is a
+// *password.PolicyError and reports whether it did.
+func respondPasswordPolicy(c *gin.Context, err error) bool {
+    var pe *password.PolicyError
+    if !errors.As(err, &pe) {
+        return false
+    }
+    response.ErrorWithCode(c, http.StatusBadRequest, CodeWeakPassword, "password does not meet the policy", pe.Violations)
+    return true
+}
+
+// sendPasswordReset invalidates earlier reset tokens of the user and mails a new one.
+func sendPasswordReset(c *gin.Context, gdb *gorm.DB, m mail.Mailer, user *models.User) error {
+    cfg, _ := config.LoadConfig()
+    token, hash, err := authpkg.GenerateOpaqueToken()
+    if err != nil {
+        return err
+    }
+    err = gdb.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+            return err
+        }
+        return tx.Create(&models.PasswordResetToken{
+            UserID:    user.ID,
+            TokenHash: hash,
+            ExpiresAt: time.Now().Add(cfg.Auth.PasswordResetTTL),
+        }).Error
+    })
+    if err != nil {
+        return err
+    }
+
+    link := cfg.Server.PublicURL + "/reset-password?token=" + url.QueryEscape(token)
+    return m.Send(c.Request.Context(), mail.Message{
+        To:      user.Email,
+        Subject: "Reset your SmartCampus password",
+        Body: fmt.Sprintf("Hello %s,\n\nOpen the link below to choose a new password:\n\n%s\n\n"+
+            "The link expires in %s and can be used once. If you did not ask for a reset, ignore this email.\n",
+            user.Username, link, cfg.Auth.PasswordResetTTL),
+    })
+}
+
+// ForgotPasswordHandler mails a reset link to the account with the given email,
+// at most once per auth.password_reset_cooldown. It answers the same way
+// whether or not the account exists or a link was just sent.
+func ForgotPasswordHandler(m mail.Mailer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req forgotPasswordRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
+
+        cfg, _ := config.LoadConfig()
+        var user models.User
+        if err := gdb.Where("email = ?", req.Email).First(&user).Error; err == nil &&
+            !sentWithin(gdb, &models.PasswordResetToken{}, user.ID, cfg.Auth.PasswordResetCooldown) {
+            if err := sendPasswordReset(c, gdb, m, &user); err != nil {
+                // keep the response identical; the error shows up in the request log
+                _ = c.Error(err)
+            }
+        }
+
+        response.Success(c, gin.H{"message": "if the address belongs to an account, a reset link has been sent"})
+    }
+}
+
+// ResetPasswordHandler sets a new password using a reset token. All existing
+// sessions of the user are revoked and any login lockout is lifted.
+func ResetPasswordHandler(dl *authpkg.Denylist, guard *authpkg.LoginGuard, policy *password.Policy) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req resetPasswordRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
+
+        var user models.User
+        err := gdb.Transaction(func(tx *gorm.DB) error {
+            var rt models.PasswordResetToken
+            if err := tx.Where("token_hash = ?", authpkg.HashToken(req.Token)).First(&rt).Error; err != nil {
+                return errResetTokenInvalid
+            }
+            if rt.UsedAt != nil || time.Now().After(rt.ExpiresAt) {
+                return errResetTokenInvalid
+            }
+            res := tx.Model(&models.PasswordResetToken{}).
+                Where("id = ? AND used_at IS NULL", rt.ID).
+                Update("used_at", time.Now())
+            if res.Error != nil {
+                return res.Error
+            }
+            if res.RowsAffected == 0 {
+                return errResetTokenInvalid
+            }
+            if err := tx.First(&user, "id = ?", rt.UserID).Error; err != nil {
+                return err
+            }
+            // a rejected password rolls back, so the link can be used again
+            if err := policy.Validate(req.Password, user.Username, user.Email); err != nil {
+                return err
+            }
+            hash, err := hashPassword(req.Password)
+            if err != nil {
+                return err
+            }
+            // the reset link went to the user's mailbox, which proves ownership
+            updates := map[string]interface{}{"password_hash": hash}
+            if user.EmailVerifiedAt == nil {
+                updates["email_verified_at"] = time.Now()
+            }
+            return tx.Model(&user).Updates(updates).Error
+        })
+        if errors.Is(err, errResetTokenInvalid) {
+            response.Error(c, http.StatusBadRequest, err.Error(), nil)
+            return
+        }
+        if respondPasswordPolicy(c, err) {
+            return
+        }
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "reset failed", err.Error())
+            return
+        }
+
+        if err := revokeUserSessions(gdb, dl, user.ID); err != nil {
+            _ = c.Error(err)
+        }
+        if err := guard.Unlock(user.Username, ""); err != nil {
+            _ = c.Error(err)
+        }
+
+        response.Success(c, gin.H{"message": "password has been reset"})
+    }
+}
+
+// ChangePasswordHandler lets a signed-in user replace their password. All
+// sessions, including the current one, are revoked afterwards.
+func ChangePasswordHandler(dl *authpkg.Denylist, policy *password.Policy) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req changePasswordRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+
+        var user models.User
+        if err := gdb.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "user not found", nil)
+            return
+        }
+        if user.PasswordHash == unusablePasswordHash {
+            response.Error(c, http.StatusBadRequest, "the password of this account is managed by an external directory", nil)
+            return
+        }
+        if !password.Verify(req.CurrentPassword, user.PasswordHash) {
+            response.Error(c, http.StatusUnauthorized, "invalid credentials", nil)
+            return
+        }
+        if err := policy.Validate(req.NewPassword, user.Username, user.Email); err != nil {
+            respondPasswordPolicy(c, err)
+            return
+        }
+        hash, err := hashPassword(req.NewPassword)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "change password failed", err.Error())
+            return
+        }
+        if err := gdb.Model(&user).Update("password_hash", hash).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "change password failed", err.Error())
+            return
+        }
+        if err := revokeUserSessions(gdb, dl, user.ID); err != nil {
+            _ = c.Error(err)
+        }
+
+        response.Success(c, gin.H{"message": "password changed; please sign in again"})
+    }
+}
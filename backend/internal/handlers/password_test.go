@@ -0,0 +1,45 @@
+package handlers
+
+import (
+    "net/http"
+    "testing"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/mail"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestForgotPasswordCooldown(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.PasswordResetToken{})
+    createUser(t, db, &models.User{Username: "ana", Email: "ana@example.org"})
+    createUser(t, db, &models.User{Username: "ben", Email: "ben@example.org"})
+    mailer := mail.NewMemoryMailer()
+    r := newTestRouter(db)
+    r.POST("/forgot", ForgotPasswordHandler(mailer))
+
+    var first string
+    for i, tc := range []struct {
+        email string
+        sent  int
+    }{
+        {"ana@example.org", 1},
+        {"ana@example.org", 1},
+        {"ana@example.org", 1},
+        // the cooldown is per account
+        {"ben@example.org", 2},
+        {"nobody@example.org", 2},
+    } {
+        w := doJSON(t, r, "POST", "/forgot", map[string]string{"email": tc.email})
+        if w.Code != http.StatusOK {
+            t.Fatalf("request %d: status %d, want 200", i, w.Code)
+        }
+        if n := len(mailer.Messages()); n != tc.sent {
+            t.Errorf("request %d: %d mails sent, want %d", i, n, tc.sent)
+        }
+        if i == 0 {
+            first = w.Body.String()
+        } else if w.Body.String() != first {
+            t.Errorf("response %d differs: %s vs %s", i, w.Body.String(), first)
+        }
+    }
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+    "log"
+    "net/http"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/gin-gonic/gin"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+type policyRule struct {
+    // a role, or scope:<name> for API token scopes
+    Sub string `json:"sub" form:"sub" binding:"required" validate:"max=100"`
+    // a permission; * matches the rest, e.g. assignment:*
+    Permission string `json:"permission" form:"permission" binding:"required" validate:"max=100"`
+}
+
+type groupingRule struct {
+    // member (a role, or a user id) inherits every permission of role
+    Member string `json:"member" form:"member" binding:"required" validate:"max=100"`
+    Role   string `json:"role" form:"role" binding:"required" validate:"max=100"`
+    // the school the grouping applies in; defaults to * (every school)
+    Domain string `json:"domain" form:"domain" validate:"max=100"`
+}
+
+// adminKeepsPolicyAccess reports whether district admins can still manage
+// policies, so that no change locks everyone out of this API.
+func adminKeepsPolicyAccess(e *casbin.SyncedEnforcer) bool {
+    ok, err := e.Enforce(models.RoleDistrictAdmin, authpkg.AllSchools, string(authpkg.PermSystemManage))
+    return err == nil && ok
+}
+
+// ListPolicies returns every policy and grouping rule (district admins only).
+func ListPolicies(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        policies, err := e.GetPolicy()
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+            return
+        }
+        groupings, err := e.GetGroupingPolicy()
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+            return
+        }
+        p := make([]policyRule, 0, len(policies))
+        for _, r := range policies {
+            if len(r) >= 2 {
+                p = append(p, policyRule{Sub: r[0], Permission: r[1]})
+            }
+        }
+        g := make([]groupingRule, 0, len(groupings))
+        for _, r := range groupings {
+            if len(r) >= 3 {
+                g = append(g, groupingRule{Member: r[0], Role: r[1], Domain: r[2]})
+            }
+        }
+        response.Success(c, gin.H{"policies": p, "groupings": g})
+    }
+}
+
+// AddPolicy grants sub a permission in every school (district admins
+// only). The change is stored and applies at once; other instances
+// follow within auth.policy_sync_interval.
+func AddPolicy(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req policyRule
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+        if !authpkg.MatchesPermission(req.Permission) {
+            response.Error(c, http.StatusBadRequest, "unknown permission", gin.H{"permissions": authpkg.Permissions()})
+            return
+        }
+        added, err := e.AddPolicy(req.Sub, req.Permission)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "add policy failed", err.Error())
+            return
+        }
+        if !added {
+            response.Error(c, http.StatusConflict, "policy already exists", nil)
+            return
+        }
+        log.Printf("policy: %s added p, %s, %s", c.GetString("user_id"), req.Sub, req.Permission)
+        response.Success(c, req)
+    }
+}
+
+// RemovePolicy deletes the policy given by the sub and permission query
+// parameters (district admins only).
+func RemovePolicy(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req policyRule
+        if err := c.ShouldBindQuery(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        removed, err := e.RemovePolicy(req.Sub, req.Permission)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "remove policy failed", err.Error())
+            return
+        }
+        if !removed {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if !adminKeepsPolicyAccess(e) {
+            _, _ = e.AddPolicy(req.Sub, req.Permission)
+            response.Error(c, http.StatusConflict, "this would lock admins out of the policy API", nil)
+            return
+        }
+        log.Printf("policy: %s removed p, %s, %s", c.GetString("user_id"), req.Sub, req.Permission)
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// AddGrouping makes member inherit the permissions of role in domain
+// (district admins only). Per-user role grants in a school are easier made
+// through /admin/users/:id/roles.
+func AddGrouping(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req groupingRule
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if err := utils.ValidateStruct(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+            return
+        }
+        if req.Member == req.Role {
+            response.Error(c, http.StatusBadRequest, "a role cannot inherit from itself", nil)
+            return
+        }
+        if req.Domain == "" {
+            req.Domain = authpkg.AllSchools
+        }
+        added, err := e.AddGroupingPolicy(req.Member, req.Role, req.Domain)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "add grouping failed", err.Error())
+            return
+        }
+        if !added {
+            response.Error(c, http.StatusConflict, "grouping already exists", nil)
+            return
+        }
+        log.Printf("policy: %s added g, %s, %s, %s", c.GetString("user_id"), req.Member, req.Role, req.Domain)
+        response.Success(c, req)
+    }
+}
+
+// RemoveGrouping deletes the grouping given by the member, role and domain
+// (default *) query parameters (district admins only).
+func RemoveGrouping(e *casbin.SyncedEnforcer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req groupingRule
+        if err := c.ShouldBindQuery(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+        if req.Domain == "" {
+            req.Domain = authpkg.AllSchools
+        }
+        removed, err := e.RemoveGroupingPolicy(req.Member, req.Role, req.Domain)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "remove grouping failed", err.Error())
+            return
+        }
+        if !removed {
+            response.Error(c, http.StatusNotFound, "not found", nil)
+            return
+        }
+        if !adminKeepsPolicyAccess(e) {
+            _, _ = e.AddGroupingPolicy(req.Member, req.Role, req.Domain)
+            response.Error(c, http.StatusConflict, "this would lock admins out of the policy API", nil)
+            return
+        }
+        log.Printf("policy: %s removed g, %s, %s, %s", c.GetString("user_id"), req.Member, req.Role, req.Domain)
+        c.Status(http.StatusNoContent)
+    }
+}
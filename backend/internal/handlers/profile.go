@@ -0,0 +1,245 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "sort"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// CodeProfileFieldForbidden is returned when a user changes a profile field
+// that only the school administration may set.
+const CodeProfileFieldForbidden = "PROFILE_FIELD_FORBIDDEN"
+
+// profileFields lists the profile fields; the ones marked true may be changed
+// by the users themselves, the others (numbers, department, grade) by admins only.
+var profileFields = map[string]bool{
+    "student_id":         false,
+    "teacher_id":         false,
+    "department":         false,
+    "grade":              false,
+    "birth_date":         true,
+    "address":            true,
+    "emergency_contacts": true,
+}
+
+// updateProfileRequest changes the fields present in the body; "" clears a field.
+type updateProfileRequest struct {
+    StudentID         *string                   `json:"student_id" validate:"omitempty,max=50"`
+    TeacherID         *string                   `json:"teacher_id" validate:"omitempty,max=50"`
+    Department        *string                   `json:"department" validate:"omitempty,max=100"`
+    Grade             *string                   `json:"grade" validate:"omitempty,max=50"`
+    BirthDate         *string                   `json:"birth_date" validate:"omitempty,datetime=2006-01-02"`
+    Address           *string                   `json:"address" validate:"omitempty,max=500"`
+    EmergencyContacts *models.EmergencyContacts `json:"emergency_contacts" validate:"omitempty,max=5,dive"`
+}
+
+// fields returns the names of the fields present in the request.
+func (r *updateProfileRequest) fields() []string {
+    var f []string
+    for name, set := range map[string]bool{
+        "student_id":         r.StudentID != nil,
+        "teacher_id":         r.TeacherID != nil,
+        "department":         r.Department != nil,
+        "grade":              r.Grade != nil,
+        "birth_date":         r.BirthDate != nil,
+        "address":            r.Address != nil,
+        "emergency_contacts": r.EmergencyContacts != nil,
+    } {
+        if set {
+            f = append(f, name)
+        }
+    }
+    sort.Strings(f)
+    return f
+}
+
+// editableProfileFields returns the fields a user with role may change on
+// their own profile (self) or on someone else's.
+func editableProfileFields(role string, self bool) []string {
+    var f []string
+    for name, selfService := range profileFields {
+        if isAdminRole(role) || (self && selfService) {
+            f = append(f, name)
+        }
+    }
+    sort.Strings(f)
+    return f
+}
+
+// loadProfile returns the profile of userID, or an empty one if it has none yet.
+func loadProfile(gdb *gorm.DB, userID string) (*models.UserProfile, error) {
+    profile := &models.UserProfile{UserID: userID}
+    err := gdb.First(profile, "user_id = ?", userID).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return &models.UserProfile{UserID: userID, EmergencyContacts: models.EmergencyContacts{}}, nil
+    }
+    return profile, err
+}
+
+func respondProfile(c *gin.Context, gdb *gorm.DB, user *models.User, self bool) {
+    profile, err := loadProfile(gdb, user.ID)
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "load profile failed", err.Error())
+        return
+    }
+    response.Success(c, gin.H{
+        "user":     gin.H{"id": user.ID, "username": user.Username, "email": user.Email, "role": user.Role, "school_id": user.SchoolID},
+        "profile":  profile,
+        "editable": editableProfileFields(c.GetString("user_role"), self),
+    })
+}
+
+// updateProfile applies the request to the profile of user after checking
+// that the caller may change every field in it.
+func updateProfile(c *gin.Context, gdb *gorm.DB, user *models.User, self bool) {
+    var req updateProfileRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+        return
+    }
+    if err := utils.ValidateStruct(&req); err != nil {
+        response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
+        return
+    }
+    editable := map[string]bool{}
+    for _, f := range editableProfileFields(c.GetString("user_role"), self) {
+        editable[f] = true
+    }
+    var forbidden []string
+    for _, f := range req.fields() {
+        if !editable[f] {
+            forbidden = append(forbidden, f)
+        }
+    }
+    if len(forbidden) > 0 {
+        response.ErrorWithCode(c, http.StatusForbidden, CodeProfileFieldForbidden, "these fields can only be changed by an administrator", gin.H{"fields": forbidden})
+        return
+    }
+
+    profile, err := loadProfile(gdb, user.ID)
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "update profile failed", err.Error())
+        return
+    }
+    optional := func(s *string) *string {
+        if *s == "" {
+            return nil
+        }
+        return s
+    }
+    if req.StudentID != nil {
+        profile.StudentID = optional(req.StudentID)
+    }
+    if req.TeacherID != nil {
+        profile.TeacherID = optional(req.TeacherID)
+    }
+    if req.Department != nil {
+        profile.Department = *req.Department
+    }
+    if req.Grade != nil {
+        profile.Grade = *req.Grade
+    }
+    if req.BirthDate != nil {
+        profile.BirthDate = nil
+        if *req.BirthDate != "" {
+            d, _ := time.Parse("2006-01-02", *req.BirthDate)
+            if d.After(time.Now()) {
+                response.Error(c, http.StatusBadRequest, "birth_date lies in the future", nil)
+                return
+            }
+            profile.BirthDate = &d
+        }
+    }
+    if req.Address != nil {
+        profile.Address = *req.Address
+    }
+    if req.EmergencyContacts != nil {
+        profile.EmergencyContacts = *req.EmergencyContacts
+    }
+
+    // student and teacher numbers are unique
+    for column, value := range map[string]*string{"student_id": profile.StudentID, "teacher_id": profile.TeacherID} {
+        if value == nil {
+            continue
+        }
+        var n int64
+        if err := gdb.Model(&models.UserProfile{}).Where(column+" = ? AND user_id <> ?", *value, user.ID).Count(&n).Error; err != nil {
+            response.Error(c, http.StatusInternalServerError, "update profile failed", err.Error())
+            return
+        }
+        if n > 0 {
+            response.Error(c, http.StatusConflict, column+" is already assigned to another user", nil)
+            return
+        }
+    }
+
+    err = gdb.Clauses(clause.OnConflict{
+        Columns:   []clause.Column{{Name: "user_id"}},
+        DoUpdates: clause.AssignmentColumns([]string{"student_id", "teacher_id", "department", "grade", "birth_date", "address", "emergency_contact", "updated_at"}),
+    }).Create(profile).Error
+    if err != nil {
+        response.Error(c, http.StatusBadRequest, "update profile failed", err.Error())
+        return
+    }
+    respondProfile(c, gdb, user, self)
+}
+
+// GetProfileHandler returns the caller's user and profile, plus the fields
+// they may change themselves.
+func GetProfileHandler(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var user models.User
+    if err := gdb.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+        response.Error(c, http.StatusNotFound, "user not found", nil)
+        return
+    }
+    respondProfile(c, gdb, &user, true)
+}
+
+// UpdateProfileHandler lets users change their own address, birth date and
+// emergency contacts; other fields are refused with PROFILE_FIELD_FORBIDDEN.
+func UpdateProfileHandler(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var user models.User
+    if err := gdb.First(&user, "id = ?", c.GetString("user_id")).Error; err != nil {
+        response.Error(c, http.StatusNotFound, "user not found", nil)
+        return
+    }
+    updateProfile(c, gdb, &user, true)
+}
+
+// GetUserProfile returns the profile of any user of the school (admin only).
+func GetUserProfile(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var user models.User
+    if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", c.Param("id")).Error; err != nil {
+        response.Error(c, http.StatusNotFound, "not found", nil)
+        return
+    }
+    respondProfile(c, gdb, &user, user.ID == c.GetString("user_id"))
+}
+
+// UpdateUserProfile edits every field of the profile of any user of the
+// school (admin only).
+func UpdateUserProfile(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+    var user models.User
+    if err := gdb.Scopes(schoolScope(c, "school_id")).First(&user, "id = ?", c.Param("id")).Error; err != nil {
+        response.Error(c, http.StatusNotFound, "not found", nil)
+        return
+    }
+    updateProfile(c, gdb, &user, user.ID == c.GetString("user_id"))
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func TestUpdateProfileFieldPermissions(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.UserProfile{})
+    admin := createSchoolUser(t, db, "admin", models.RoleAdmin, testSchool)
+    student := createSchoolUser(t, db, "stella", models.RoleStudent, testSchool)
+    other := createSchoolUser(t, db, "sven", models.RoleStudent, testSchool)
+    stranger := createSchoolUser(t, db, "otto", models.RoleStudent, otherSchool)
+
+    self := newTestRouter(db, asUser(student.ID, models.RoleStudent, testSchool))
+    self.PUT("/users/profile", UpdateProfileHandler)
+    byAdmin := newTestRouter(db, asUser(admin.ID, models.RoleAdmin, testSchool))
+    byAdmin.PUT("/admin/users/:id/profile", UpdateUserProfile)
+
+    contacts := []map[string]string{{"name": "Mia", "relationship": "mother", "phone": "+49 30 1234"}}
+    tests := []struct {
+        name     string
+        r        http.Handler
+        path     string
+        body     map[string]interface{}
+        want     int
+        wantCode string
+    }{
+        {"own contact details", self, "/users/profile",
+            map[string]interface{}{"address": "Main St 1", "birth_date": "2010-04-01", "emergency_contacts": contacts}, http.StatusOK, ""},
+        {"own student number", self, "/users/profile",
+            map[string]interface{}{"address": "Main St 2", "student_id": "S-1"}, http.StatusForbidden, CodeProfileFieldForbidden},
+        {"birth date in the future", self, "/users/profile",
+            map[string]interface{}{"birth_date": "2999-01-01"}, http.StatusBadRequest, ""},
+        {"contact without phone", self, "/users/profile",
+            map[string]interface{}{"emergency_contacts": []map[string]string{{"name": "Mia"}}}, http.StatusBadRequest, ""},
+        {"student number by an admin", byAdmin, "/admin/users/" + student.ID + "/profile",
+            map[string]interface{}{"student_id": "S-1", "grade": "7"}, http.StatusOK, ""},
+        {"student number taken", byAdmin, "/admin/users/" + other.ID + "/profile",
+            map[string]interface{}{"student_id": "S-1"}, http.StatusConflict, ""},
+        {"user of another school", byAdmin, "/admin/users/" + stranger.ID + "/profile",
+            map[string]interface{}{"grade": "7"}, http.StatusNotFound, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := doJSON(t, tt.r, "PUT", tt.path, tt.body)
+            if w.Code != tt.want {
+                t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+            }
+            var body struct {
+                Code string `json:"code"`
+            }
+            json.Unmarshal(w.Body.Bytes(), &body)
+            if body.Code != tt.wantCode {
+                t.Errorf("code %q, want %q", body.Code, tt.wantCode)
+            }
+        })
+    }
+
+    var p models.UserProfile
+    if err := db.First(&p, "user_id = ?", student.ID).Error; err != nil {
+        t.Fatal(err)
+    }
+    if p.StudentID == nil || *p.StudentID != "S-1" || p.Grade != "7" || p.Address != "Main St 1" ||
+        p.BirthDate == nil || len(p.EmergencyContacts) != 1 || p.EmergencyContacts[0].Name != "Mia" {
+        t.Errorf("profile %+v", p)
+    }
+}
+
+func TestGetProfileListsEditableFields(t *testing.T) {
+    db := testutil.NewDB(t, &models.User{}, &models.UserProfile{})
+    student := createSchoolUser(t, db, "stella", models.RoleStudent, testSchool)
+    r := newTestRouter(db, asUser(student.ID, models.RoleStudent, testSchool))
+    r.GET("/users/profile", GetProfileHandler)
+
+    w := doJSON(t, r, "GET", "/users/profile", nil)
+    if w.Code != http.StatusOK {
+        t.Fatalf("status %d: %s", w.Code, w.Body)
+    }
+    var got []string
+    for _, f := range decodeData(t, w)["editable"].([]interface{}) {
+        got = append(got, f.(string))
+    }
+    want := []string{"address", "birth_date", "emergency_contacts"}
+    if len(got) != len(want) {
+        t.Fatalf("editable %v, want %v", got, want)
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Fatalf("editable %v, want %v", got, want)
+        }
+    }
+}
@@ -11,11 +11,13 @@ import (
     "github.com/C14147/SmartCampus-Workbench/pkg/response"
 )
 
+// ListSchools returns the school the request acts in, or every school for
+// district admins acting in all of them.
 func ListSchools(c *gin.Context) {
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
     var list []models.School
-    gdb.Find(&list)
+    gdb.Scopes(schoolScope(c, "id")).Find(&list)
     response.Success(c, list)
 }
 
@@ -43,7 +45,7 @@ func GetSchool(c *gin.Context) {
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
     var s models.School
-    if err := gdb.First(&s, "id = ?", id).Error; err != nil {
+    if err := gdb.Scopes(schoolScope(c, "id")).First(&s, "id = ?", id).Error; err != nil {
         response.Error(c, http.StatusNotFound, "not found", nil)
         return
     }
@@ -55,7 +57,7 @@ func UpdateSchool(c *gin.Context) {
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
     var s models.School
-    if err := gdb.First(&s, "id = ?", id).Error; err != nil {
+    if err := gdb.Scopes(schoolScope(c, "id")).First(&s, "id = ?", id).Error; err != nil {
         response.Error(c, http.StatusNotFound, "not found", nil)
         return
     }
@@ -63,6 +65,8 @@ func UpdateSchool(c *gin.Context) {
         response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
         return
     }
+    // an id in the body must not redirect the save to another school
+    s.ID = id
     if err := utils.ValidateStruct(&s); err != nil {
         response.Error(c, http.StatusBadRequest, "validation failed", err.Error())
         return
@@ -78,7 +82,7 @@ func DeleteSchool(c *gin.Context) {
     id := c.Param("id")
     db, _ := c.Get("db")
     gdb := db.(*gorm.DB)
-    if err := gdb.Delete(&models.School{}, "id = ?", id).Error; err != nil {
+    if err := gdb.Scopes(schoolScope(c, "id")).Delete(&models.School{}, "id = ?", id).Error; err != nil {
         response.Error(c, http.StatusInternalServerError, "delete failed", err.Error())
         return
     }
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// Resource scopes narrow what RequirePermission allows by role and
+// permission down to the rows the caller is related to. Everything is limited to
+// the school the request acts in (school_id in the context), unless a
+// district admin acts in all schools. Within the school:
+//   - admins reach every course
+//   - teachers reach the courses they teach and, as head teacher, every
+//     course of their class
+//   - students read the courses of the classes they are enrolled in and
+//     manage none
+//   - any other role reaches no course
+
+// isAdminRole reports whether role administers a school, or as district
+// admin, every school.
+func isAdminRole(role string) bool {
+    return role == models.RoleAdmin || role == models.RoleDistrictAdmin
+}
+
+// allSchools reports whether the request acts in every school, i.e. comes
+// from a district admin who has not picked one.
+func allSchools(c *gin.Context) bool {
+    return c.GetString("school_id") == "" && c.GetString("user_role") == models.RoleDistrictAdmin
+}
+
+// schoolScope restricts a query to the rows whose column is the school the
+// request acts in. Requests without a school reach none.
+func schoolScope(c *gin.Context, column string) func(*gorm.DB) *gorm.DB {
+    school := c.GetString("school_id")
+    all := allSchools(c)
+    return func(q *gorm.DB) *gorm.DB {
+        switch {
+        case all:
+            return q
+        case school == "":
+            return q.Where("1 = 0")
+        }
+        return q.Where(column+" = ?", school)
+    }
+}
+
+// requestSchool returns the school that rows created by the request belong
+// to: the one it acts in, or for district admins acting in all schools the
+// requested one (which may be none). ok is false when requested names a
+// school other than the one the request acts in.
+func requestSchool(c *gin.Context, requested string) (school string, ok bool) {
+    if allSchools(c) {
+        return requested, true
+    }
+    school = c.GetString("school_id")
+    return school, requested == "" || requested == school
+}
+
+// schoolUserIDs is a subquery of the users of the request's school, or nil
+// when the request acts in all schools.
+func schoolUserIDs(c *gin.Context, gdb *gorm.DB) *gorm.DB {
+    if allSchools(c) {
+        return nil
+    }
+    return gdb.Model(&models.User{}).Select("id").Scopes(schoolScope(c, "school_id"))
+}
+
+// schoolCourseIDs is a subquery of the courses of the request's school, or
+// nil when the request acts in all schools.
+func schoolCourseIDs(c *gin.Context, gdb *gorm.DB) *gorm.DB {
+    if allSchools(c) {
+        return nil
+    }
+    classes := gdb.Model(&models.Class{}).Select("id").Scopes(schoolScope(c, "school_id"))
+    return gdb.Model(&models.Course{}).Select("id").Where("class_id IN (?)", classes)
+}
+
+// studentClassIDs is a subquery of the classes a student is enrolled in.
+func studentClassIDs(gdb *gorm.DB, studentID string) *gorm.DB {
+    return gdb.Model(&models.ClassStudent{}).Select("class_id").Where("student_id = ? AND status = 'active'", studentID)
+}
+
+// headTeacherClassIDs is a subquery of the classes a teacher heads.
+func headTeacherClassIDs(gdb *gorm.DB, teacherID string) *gorm.DB {
+    return gdb.Model(&models.Class{}).Select("id").Where("head_teacher_id = ?", teacherID)
+}
+
+// courseIDs is a subquery of the courses userID may read, or with manage,
+// change the assignments of. It is nil for admins, who are not restricted.
+func courseIDs(gdb *gorm.DB, userID, role string, manage bool) *gorm.DB {
+    courses := gdb.Model(&models.Course{}).Select("id")
+    switch role {
+    case models.RoleAdmin, models.RoleDistrictAdmin:
+        return nil
+    case models.RoleTeacher:
+        return courses.Where("teacher_id = ? OR class_id IN (?)", userID, headTeacherClassIDs(gdb, userID))
+    case models.RoleStudent:
+        if !manage {
+            return courses.Where("class_id IN (?)", studentClassIDs(gdb, userID))
+        }
+    }
+    return courses.Where("1 = 0")
+}
+
+// assignmentScope restricts an assignment query to the caller's courses in
+// the request's school.
+func assignmentScope(c *gin.Context, gdb *gorm.DB, manage bool) func(*gorm.DB) *gorm.DB {
+    courses := courseIDs(gdb, c.GetString("user_id"), c.GetString("user_role"), manage)
+    school := schoolCourseIDs(c, gdb)
+    return func(q *gorm.DB) *gorm.DB {
+        if courses != nil {
+            q = q.Where("course_id IN (?)", courses)
+        }
+        if school != nil {
+            q = q.Where("course_id IN (?)", school)
+        }
+        return q
+    }
+}
+
+// canManageCourse reports whether the caller may add assignments to, or
+// move assignments into, the course.
+func canManageCourse(c *gin.Context, gdb *gorm.DB, courseID string) (bool, error) {
+    q := gdb.Model(&models.Course{}).Where("id = ?", courseID)
+    if courses := courseIDs(gdb, c.GetString("user_id"), c.GetString("user_role"), true); courses != nil {
+        q = q.Where("id IN (?)", courses)
+    }
+    if school := schoolCourseIDs(c, gdb); school != nil {
+        q = q.Where("id IN (?)", school)
+    }
+    var n int64
+    err := q.Count(&n).Error
+    return n > 0, err
+}
+
+// canManageClass reports whether the caller may act on the class: admins
+// on any of their school, teachers only on the class they head.
+func canManageClass(c *gin.Context, gdb *gorm.DB, classID string) (bool, error) {
+    q := gdb.Model(&models.Class{}).Scopes(schoolScope(c, "school_id")).Where("id = ?", classID)
+    switch role := c.GetString("user_role"); {
+    case isAdminRole(role):
+    case role == models.RoleTeacher:
+        q = q.Where("head_teacher_id = ?", c.GetString("user_id"))
+    default:
+        return false, nil
+    }
+    var n int64
+    err := q.Count(&n).Error
+    return n > 0, err
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+    "net/http/httptest"
+    "reflect"
+    "sort"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+const otherSchool = "5c4e7a9e-0000-4000-8000-000000000002"
+
+// testContext is a request context of userID acting with role in school.
+func testContext(userID, role, school string) *gin.Context {
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Set("user_id", userID)
+    c.Set("user_role", role)
+    c.Set("school_id", school)
+    return c
+}
+
+func TestAssignmentScope(t *testing.T) {
+    db := newScopeDB(t)
+    a := newSchoolFixture(t, db, testSchool, "a")
+    b := newSchoolFixture(t, db, otherSchool, "b")
+    // a second course of class a, taught by someone else
+    other := models.Course{Name: "Art", Code: "ARTa", TeacherID: b.teacher, ClassID: a.class}
+    if err := db.Create(&other).Error; err != nil {
+        t.Fatal(err)
+    }
+    assignments := map[string]string{}
+    for name, course := range map[string]string{"a": a.course, "art": other.ID, "b": b.course} {
+        as := models.Assignment{CourseID: course, Title: name}
+        if err := db.Create(&as).Error; err != nil {
+            t.Fatal(err)
+        }
+        assignments[as.ID] = name
+    }
+    admin := createUser(t, db, &models.User{Username: "admin", Email: "admin@example.org", Role: models.RoleAdmin}).ID
+    district := createUser(t, db, &models.User{Username: "district", Email: "district@example.org", Role: models.RoleDistrictAdmin}).ID
+
+    for _, tc := range []struct {
+        name         string
+        user, role   string
+        school       string
+        read, manage []string
+    }{
+        {"admin", admin, models.RoleAdmin, a.school, []string{"a", "art"}, []string{"a", "art"}},
+        {"admin without school", admin, models.RoleAdmin, "", nil, nil},
+        {"district admin in all schools", district, models.RoleDistrictAdmin, "", []string{"a", "art", "b"}, []string{"a", "art", "b"}},
+        {"district admin in a school", district, models.RoleDistrictAdmin, b.school, []string{"b"}, []string{"b"}},
+        {"course teacher", a.teacher, models.RoleTeacher, a.school, []string{"a"}, []string{"a"}},
+        {"head teacher", a.head, models.RoleTeacher, a.school, []string{"a", "art"}, []string{"a", "art"}},
+        // b's teacher teaches art in school a, but acts in school b
+        {"teacher in another school", b.teacher, models.RoleTeacher, b.school, []string{"b"}, []string{"b"}},
+        {"teacher acting in the course's school", b.teacher, models.RoleTeacher, a.school, []string{"art"}, []string{"art"}},
+        {"student", a.student, models.RoleStudent, a.school, []string{"a", "art"}, nil},
+        {"student of another school", b.student, models.RoleStudent, a.school, nil, nil},
+        {"guardian", a.student, models.RoleGuardian, a.school, nil, nil},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            c := testContext(tc.user, tc.role, tc.school)
+            for _, manage := range []bool{false, true} {
+                var list []models.Assignment
+                if err := db.Scopes(assignmentScope(c, db, manage)).Find(&list).Error; err != nil {
+                    t.Fatal(err)
+                }
+                var got []string
+                for _, as := range list {
+                    got = append(got, assignments[as.ID])
+                }
+                sort.Strings(got)
+                want := tc.read
+                if manage {
+                    want = tc.manage
+                }
+                if !reflect.DeepEqual(got, want) {
+                    t.Errorf("manage=%v: sees %q, want %q", manage, got, want)
+                }
+            }
+
+            // canManageCourse agrees with the manage scope
+            for course, name := range map[string]string{a.course: "a", other.ID: "art", b.course: "b"} {
+                ok, err := canManageCourse(c, db, course)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                want := false
+                for _, m := range tc.manage {
+                    want = want || m == name
+                }
+                if ok != want {
+                    t.Errorf("canManageCourse(%s) = %v, want %v", name, ok, want)
+                }
+            }
+        })
+    }
+}
+
+func TestCanManageClass(t *testing.T) {
+    db := newScopeDB(t)
+    a := newSchoolFixture(t, db, testSchool, "a")
+    b := newSchoolFixture(t, db, otherSchool, "b")
+
+    for _, tc := range []struct {
+        name       string
+        user, role string
+        school     string
+        class      string
+        want       bool
+    }{
+        {"admin", "", models.RoleAdmin, a.school, a.class, true},
+        {"admin of another school", "", models.RoleAdmin, b.school, a.class, false},
+        {"district admin in all schools", "", models.RoleDistrictAdmin, "", b.class, true},
+        {"head teacher", a.head, models.RoleTeacher, a.school, a.class, true},
+        {"course teacher", a.teacher, models.RoleTeacher, a.school, a.class, false},
+        {"student", a.student, models.RoleStudent, a.school, a.class, false},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            ok, err := canManageClass(testContext(tc.user, tc.role, tc.school), db, tc.class)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if ok != tc.want {
+                t.Errorf("canManageClass = %v, want %v", ok, tc.want)
+            }
+        })
+    }
+}
+
+func TestSchoolScopeWithoutSchool(t *testing.T) {
+    db := newScopeDB(t)
+    for _, u := range []struct{ name, school string }{{"ana", testSchool}, {"ben", otherSchool}, {"cem", ""}} {
+        createSchoolUser(t, db, u.name, models.RoleStudent, u.school)
+    }
+
+    for _, tc := range []struct {
+        name      string
+        role      string
+        school    string
+        requested string
+        users     []string
+        created   string
+        ok        bool
+    }{
+        {"admin without school", models.RoleAdmin, "", "", nil, "", true},
+        {"admin without school naming one", models.RoleAdmin, "", testSchool, nil, "", false},
+        {"teacher without school", models.RoleTeacher, "", "", nil, "", true},
+        {"admin", models.RoleAdmin, testSchool, "", []string{"ana"}, testSchool, true},
+        {"admin naming another school", models.RoleAdmin, testSchool, otherSchool, []string{"ana"}, testSchool, false},
+        {"district admin in all schools", models.RoleDistrictAdmin, "", otherSchool, []string{"ana", "ben", "cem"}, otherSchool, true},
+        {"district admin in a school", models.RoleDistrictAdmin, otherSchool, "", []string{"ben"}, otherSchool, true},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            c := testContext("", tc.role, tc.school)
+            var users []models.User
+            if err := db.Scopes(schoolScope(c, "school_id")).Order("username").Find(&users).Error; err != nil {
+                t.Fatal(err)
+            }
+            var got []string
+            for _, u := range users {
+                got = append(got, u.Username)
+            }
+            if !reflect.DeepEqual(got, tc.users) {
+                t.Errorf("users %v, want %v", got, tc.users)
+            }
+            if created, ok := requestSchool(c, tc.requested); created != tc.created || ok != tc.ok {
+                t.Errorf("requestSchool = %q, %v; want %q, %v", created, ok, tc.created, tc.ok)
+            }
+        })
+    }
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// revokeSession ends a session: its refresh tokens stop working at once and
+// its access tokens as soon as the denylist has been synced.
+func revokeSession(gdb *gorm.DB, dl *authpkg.Denylist, sessionID, userID string) error {
+    if err := revokeTokenFamily(gdb, sessionID); err != nil {
+        return err
+    }
+    cfg, _ := config.LoadConfig()
+    return dl.RevokeSession(sessionID, userID, cfg.MaxTokenTTL())
+}
+
+// ListSessionsHandler returns the active sessions of the current user, most
+// recently used first. The session of the request is flagged as current.
+func ListSessionsHandler(c *gin.Context) {
+    db, _ := c.Get("db")
+    gdb := db.(*gorm.DB)
+
+    var list []models.Session
+    err := gdb.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", c.GetString("user_id"), time.Now()).
+        Order("last_seen_at DESC").Find(&list).Error
+    if err != nil {
+        response.Error(c, http.StatusInternalServerError, "list failed", err.Error())
+        return
+    }
+
+    current := c.GetString("session_id")
+    items := make([]gin.H, 0, len(list))
+    for _, s := range list {
+        items = append(items, gin.H{
+            "id":           s.ID,
+            "user_agent":   s.UserAgent,
+            "ip":           s.IP,
+            "created_at":   s.CreatedAt,
+            "last_seen_at": s.LastSeenAt,
+            "expires_at":   s.ExpiresAt,
+            "current":      s.ID == current,
+        })
+    }
+    response.Success(c, items)
+}
+
+// RevokeSessionHandler signs one of the current user's devices out.
+func RevokeSessionHandler(dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        uid := c.GetString("user_id")
+
+        var s models.Session
+        if err := gdb.First(&s, "id = ? AND user_id = ?", c.Param("id"), uid).Error; err != nil {
+            response.Error(c, http.StatusNotFound, "session not found", nil)
+            return
+        }
+        if err := revokeSession(gdb, dl, s.ID, uid); err != nil {
+            response.Error(c, http.StatusInternalServerError, "revoke failed", err.Error())
+            return
+        }
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// RevokeOtherSessionsHandler signs the current user out on every device but
+// the one making the request.
+func RevokeOtherSessionsHandler(dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        uid := c.GetString("user_id")
+
+        q := gdb.Model(&models.Session{}).
+            Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", uid, time.Now())
+        if current := c.GetString("session_id"); current != "" {
+            q = q.Where("id <> ?", current)
+        }
+        var ids []string
+        err := q.Pluck("id", &ids).Error
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "revoke failed", err.Error())
+            return
+        }
+        for _, id := range ids {
+            if err := revokeSession(gdb, dl, id, uid); err != nil {
+                response.Error(c, http.StatusInternalServerError, "revoke failed", err.Error())
+                return
+            }
+        }
+        response.Success(c, gin.H{"sessions_revoked": len(ids)})
+    }
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+)
+
+// inSession marks every request as made with an access token of session sid.
+func inSession(sid string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Set("session_id", sid)
+        c.Next()
+    }
+}
+
+func TestListSessions(t *testing.T) {
+    db := newTokenDB(t)
+    ks := newTestKeySet(t)
+    ana := createUser(t, db, &models.User{Username: "ana", Email: "ana@example.org", Role: models.RoleTeacher})
+    ben := createUser(t, db, &models.User{Username: "ben", Email: "ben@example.org", Role: models.RoleTeacher})
+    _, current := signIn(t, db, ks, ana)
+    _, other := signIn(t, db, ks, ana)
+    _, revoked := signIn(t, db, ks, ana)
+    signIn(t, db, ks, ben)
+    if err := revokeTokenFamily(db, revoked); err != nil {
+        t.Fatal(err)
+    }
+
+    r := newTestRouter(db, asUser(ana.ID, models.RoleTeacher, ""), inSession(current))
+    r.GET("/sessions", ListSessionsHandler)
+    w := doJSON(t, r, "GET", "/sessions", nil)
+    if w.Code != http.StatusOK {
+        t.Fatalf("status %d: %s", w.Code, w.Body)
+    }
+    var body struct {
+        Data []struct {
+            ID      string `json:"id"`
+            Current bool   `json:"current"`
+        } `json:"data"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+
+    got := map[string]bool{}
+    for _, s := range body.Data {
+        got[s.ID] = s.Current
+    }
+    want := map[string]bool{current: true, other: false}
+    if len(got) != len(want) {
+        t.Fatalf("sessions %v, want %v", got, want)
+    }
+    for id, cur := range want {
+        if c, ok := got[id]; !ok || c != cur {
+            t.Errorf("session %s: listed %v, current %v; want listed, current %v", id, ok, c, cur)
+        }
+    }
+}
+
+func TestRevokeSessions(t *testing.T) {
+    db := newTokenDB(t)
+    ks := newTestKeySet(t)
+    dl := authpkg.NewDenylist(db, time.Hour)
+    ana := createUser(t, db, &models.User{Username: "ana", Email: "ana@example.org", Role: models.RoleTeacher})
+    ben := createUser(t, db, &models.User{Username: "ben", Email: "ben@example.org", Role: models.RoleTeacher})
+    _, current := signIn(t, db, ks, ana)
+    _, laptop := signIn(t, db, ks, ana)
+    _, phone := signIn(t, db, ks, ana)
+    _, bens := signIn(t, db, ks, ben)
+
+    r := newTestRouter(db, asUser(ana.ID, models.RoleTeacher, ""), inSession(current))
+    r.DELETE("/sessions", RevokeOtherSessionsHandler(dl))
+    r.DELETE("/sessions/:id", RevokeSessionHandler(dl))
+
+    steps := []struct {
+        name string
+        path string
+        want int
+    }{
+        {"session of another user", "/sessions/" + bens, http.StatusNotFound},
+        {"one device", "/sessions/" + laptop, http.StatusNoContent},
+        {"every other device", "/sessions", http.StatusOK},
+    }
+    for _, st := range steps {
+        if w := doJSON(t, r, "DELETE", st.path, nil); w.Code != st.want {
+            t.Fatalf("%s: status %d, want %d: %s", st.name, w.Code, st.want, w.Body)
+        }
+    }
+
+    for sid, want := range map[string]bool{current: false, laptop: true, phone: true, bens: false} {
+        var s models.Session
+        db.First(&s, "id = ?", sid)
+        var active int64
+        db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", sid).Count(&active)
+        if got := s.RevokedAt != nil; got != want || (active == 0) != want {
+            t.Errorf("session %s: revoked %v with %d active refresh tokens, want revoked %v", sid, got, active, want)
+        }
+        if got := dl.IsRevoked("", sid, ana.ID, time.Now()); got != want {
+            t.Errorf("access tokens of session %s revoked = %v, want %v", sid, got, want)
+        }
+    }
+}
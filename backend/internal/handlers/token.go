@@ -0,0 +1,211 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/casbin/casbin/v2"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+type refreshRequest struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// maxUserAgentLength matches the size of sessions.user_agent.
+const maxUserAgentLength = 512
+
+// issueTokens signs an access token and persists a new refresh token for a
+// session. An empty sessionID starts a new session (i.e. a fresh login) for
+// the device making the request; the session id doubles as the family id of
+// its refresh tokens. New sessions act in the user's default school, existing
+// ones keep their school as long as the user still has a role there.
+func issueTokens(c *gin.Context, gdb *gorm.DB, ks *authpkg.KeySet, e *casbin.SyncedEnforcer, cfg *config.Config, user *models.User, sessionID string) (gin.H, error) {
+    now := time.Now()
+    expiresAt := now.Add(cfg.JWT.RefreshTTL)
+    m := authpkg.DefaultMembership(e, user)
+    if sessionID == "" {
+        ua := c.Request.UserAgent()
+        if len(ua) > maxUserAgentLength {
+            ua = ua[:maxUserAgentLength]
+        }
+        s := &models.Session{
+            ID:         utils.NewUUID(),
+            UserID:     user.ID,
+            UserAgent:  ua,
+            IP:         c.ClientIP(),
+            SchoolID:   optionalID(m.SchoolID),
+            LastSeenAt: now,
+            ExpiresAt:  expiresAt,
+        }
+        if err := gdb.Create(s).Error; err != nil {
+            return nil, err
+        }
+        sessionID = s.ID
+    } else {
+        // sessions from before session tracking have no row; nothing to update then
+        var s models.Session
+        if gdb.Select("school_id").First(&s, "id = ?", sessionID).Error == nil {
+            school := ""
+            if s.SchoolID != nil {
+                school = *s.SchoolID
+            }
+            if role := authpkg.RoleInSchool(e, user, school); role != "" {
+                m = authpkg.Membership{SchoolID: school, Role: role}
+            }
+        }
+        err := gdb.Model(&models.Session{}).Where("id = ?", sessionID).
+            Updates(map[string]interface{}{"last_seen_at": now, "expires_at": expiresAt, "school_id": optionalID(m.SchoolID)}).Error
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    access, err := authpkg.GenerateAccessToken(ks, user, m, sessionID, cfg.JWT.AccessTTL)
+    if err != nil {
+        return nil, err
+    }
+
+    refresh, hash, err := authpkg.GenerateOpaqueToken()
+    if err != nil {
+        return nil, err
+    }
+    rt := &models.RefreshToken{
+        UserID:    user.ID,
+        FamilyID:  sessionID,
+        TokenHash: hash,
+        ExpiresAt: expiresAt,
+    }
+    if err := gdb.Create(rt).Error; err != nil {
+        return nil, err
+    }
+
+    return gin.H{
+        "token":         access,
+        "token_type":    "Bearer",
+        "expires_in":    int(cfg.JWT.AccessTTL.Seconds()),
+        "refresh_token": refresh,
+        "school_id":     m.SchoolID,
+        "role":          m.Role,
+    }, nil
+}
+
+// optionalID maps "" to NULL for nullable uuid columns.
+func optionalID(id string) *string {
+    if id == "" {
+        return nil
+    }
+    return &id
+}
+
+// revokeTokenFamily revokes every still-active refresh token of a family and
+// marks the session it belongs to as revoked.
+func revokeTokenFamily(gdb *gorm.DB, familyID string) error {
+    now := time.Now()
+    err := gdb.Model(&models.RefreshToken{}).
+        Where("family_id = ? AND revoked_at IS NULL", familyID).
+        Update("revoked_at", now).Error
+    if err != nil {
+        return err
+    }
+    return gdb.Model(&models.Session{}).
+        Where("id = ? AND revoked_at IS NULL", familyID).
+        Update("revoked_at", now).Error
+}
+
+// RefreshHandler exchanges a refresh token for a new access/refresh token pair.
+// Each refresh token can be used exactly once; presenting a token that has
+// already been rotated revokes its whole session.
+func RefreshHandler(ks *authpkg.KeySet, e *casbin.SyncedEnforcer, dl *authpkg.Denylist) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req refreshRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+
+        db, ok := c.Get("db")
+        if !ok {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "database not configured"})
+            return
+        }
+        gdb := db.(*gorm.DB)
+        cfg, _ := config.LoadConfig()
+
+        var tokens gin.H
+        var status string
+        err := gdb.Transaction(func(tx *gorm.DB) error {
+            var rt models.RefreshToken
+            if err := tx.Where("token_hash = ?", authpkg.HashToken(req.RefreshToken)).First(&rt).Error; err != nil {
+                return err
+            }
+            if rt.UsedAt != nil || rt.RevokedAt != nil {
+                return errRefreshTokenReused
+            }
+            if time.Now().After(rt.ExpiresAt) {
+                return gorm.ErrRecordNotFound
+            }
+
+            // mark as used; the guard on used_at makes concurrent refreshes of the
+            // same token count as reuse instead of forking the family
+            res := tx.Model(&models.RefreshToken{}).
+                Where("id = ? AND used_at IS NULL", rt.ID).
+                Update("used_at", time.Now())
+            if res.Error != nil {
+                return res.Error
+            }
+            if res.RowsAffected == 0 {
+                return errRefreshTokenReused
+            }
+
+            var user models.User
+            if err := tx.First(&user, "id = ?", rt.UserID).Error; err != nil {
+                return err
+            }
+            if user.Status != models.StatusActive {
+                status = user.Status
+                return errAccountNotActive
+            }
+            var err error
+            tokens, err = issueTokens(c, tx, ks, e, cfg, &user, rt.FamilyID)
+            return err
+        })
+
+        switch {
+        case err == nil:
+            response.Success(c, tokens)
+        case errors.Is(err, errRefreshTokenReused):
+            // revoke outside the transaction so the revocation survives the rollback
+            var rt models.RefreshToken
+            if gdb.Where("token_hash = ?", authpkg.HashToken(req.RefreshToken)).First(&rt).Error == nil {
+                _ = revokeSession(gdb, dl, rt.FamilyID, rt.UserID)
+            }
+            response.Error(c, http.StatusUnauthorized, "invalid refresh token", err.Error())
+        case errors.Is(err, gorm.ErrRecordNotFound):
+            response.Error(c, http.StatusUnauthorized, "invalid refresh token", nil)
+        case errors.Is(err, errAccountNotActive):
+            respondAccountStatus(c, status)
+        default:
+            response.Error(c, http.StatusInternalServerError, "token refresh failed", err.Error())
+        }
+    }
+}
+
+// JWKSHandler publishes the public signing keys so that other services can
+// verify our tokens without sharing a secret.
+func JWKSHandler(ks *authpkg.KeySet) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Header("Cache-Control", "public, max-age=300")
+        c.JSON(http.StatusOK, gin.H{"keys": ks.JWKS()})
+    }
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    authpkg "github.com/C14147/SmartCampus-Workbench/internal/auth"
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+func newTokenDB(t *testing.T) *gorm.DB {
+    return testutil.NewDB(t, &models.User{}, &models.Session{}, &models.RefreshToken{}, &models.TokenRevocation{})
+}
+
+// signIn issues the tokens of a new session of user, as a login does.
+func signIn(t *testing.T, db *gorm.DB, ks *authpkg.KeySet, user *models.User) (refresh, session string) {
+    t.Helper()
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = httptest.NewRequest("POST", "/login", nil)
+    cfg, _ := config.LoadConfig()
+    tokens, err := issueTokens(c, db, ks, newTestEnforcer(), cfg, user, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    claims, err := authpkg.ParseAccessToken(ks, tokens["token"].(string))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return tokens["refresh_token"].(string), claims["sid"].(string)
+}
+
+func TestRefreshRotationAndReuse(t *testing.T) {
+    db := newTokenDB(t)
+    ks := newTestKeySet(t)
+    dl := authpkg.NewDenylist(db, time.Hour)
+    user := createUser(t, db, &models.User{Username: "ana", Email: "ana@example.org", Role: models.RoleTeacher})
+    r := newTestRouter(db)
+    r.POST("/refresh", RefreshHandler(ks, newTestEnforcer(), dl))
+    refresh := func(token string) (int, string) {
+        w := doJSON(t, r, "POST", "/refresh", map[string]string{"refresh_token": token})
+        if w.Code != http.StatusOK {
+            return w.Code, ""
+        }
+        next, _ := decodeData(t, w)["refresh_token"].(string)
+        return w.Code, next
+    }
+
+    first, sid := signIn(t, db, ks, user)
+    _, otherSID := signIn(t, db, ks, user)
+
+    code, second := refresh(first)
+    if code != http.StatusOK || second == "" || second == first {
+        t.Fatalf("first refresh: status %d, token rotated %v", code, second != first)
+    }
+    code, third := refresh(second)
+    if code != http.StatusOK || third == "" {
+        t.Fatalf("second refresh: status %d", code)
+    }
+
+    // presenting a rotated token again revokes the session
+    for i, tc := range []struct {
+        token string
+        want  int
+    }{
+        {first, http.StatusUnauthorized},
+        // the newest token of the family is revoked with it
+        {third, http.StatusUnauthorized},
+        {"not-a-token", http.StatusUnauthorized},
+    } {
+        if code, _ := refresh(tc.token); code != tc.want {
+            t.Errorf("%d: status %d, want %d", i, code, tc.want)
+        }
+    }
+
+    var s models.Session
+    db.First(&s, "id = ?", sid)
+    if s.RevokedAt == nil {
+        t.Error("session of the reused token not revoked")
+    }
+    if !dl.IsRevoked("", sid, user.ID, time.Now()) {
+        t.Error("access tokens of the reused session not revoked")
+    }
+    if dl.IsRevoked("", otherSID, user.ID, time.Now()) {
+        t.Error("another session of the user was revoked")
+    }
+    var active int64
+    db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL AND used_at IS NULL", sid).Count(&active)
+    if active != 0 {
+        t.Errorf("%d usable refresh tokens left in the revoked family", active)
+    }
+}
+
+func TestRefreshRefusesDisabledAccount(t *testing.T) {
+    db := newTokenDB(t)
+    ks := newTestKeySet(t)
+    user := createUser(t, db, &models.User{Username: "ana", Email: "ana@example.org", Role: models.RoleTeacher})
+    token, _ := signIn(t, db, ks, user)
+    db.Model(user).Update("status", models.StatusSuspended)
+
+    r := newTestRouter(db)
+    r.POST("/refresh", RefreshHandler(ks, newTestEnforcer(), authpkg.NewDenylist(db, time.Hour)))
+    w := doJSON(t, r, "POST", "/refresh", map[string]string{"refresh_token": token})
+    if w.Code != http.StatusForbidden {
+        t.Errorf("status %d, want 403: %s", w.Code, w.Body)
+    }
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+    "bytes"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-playground/validator/v10"
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/password"
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+    "github.com/C14147/SmartCampus-Workbench/pkg/response"
+)
+
+// CodeImportInvalid is returned when an import is committed with errors or conflicts.
+const CodeImportInvalid = "IMPORT_INVALID"
+
+const (
+    maxImportSize = 5 << 20
+    maxImportRows = 5000
+)
+
+// importColumns are the accepted CSV header names; username, email and role are required.
+var importColumns = map[string]bool{"username": true, "email": true, "role": true, "class": true, "number": true}
+
+// importRow is one CSV line. Number is the student number of students and
+// the teacher number of teachers; Class (an ID or a class name of the
+// school) enrolls a student.
+type importRow struct {
+    Line     int    `json:"line"`
+    Username string `json:"username" validate:"required,min=3,max=50"`
+    Email    string `json:"email" validate:"required,email,max=100"`
+    Role     string `json:"role" validate:"required,oneof=teacher student"`
+    Class    string `json:"class" validate:"max=100"`
+    Number   string `json:"number" validate:"max=50"`
+
+    classID string
+}
+
+// importIssue is a problem with one line (0 for the file as a whole).
+type importIssue struct {
+    Line    int    `json:"line"`
+    Field   string `json:"field,omitempty"`
+    Message string `json:"message"`
+}
+
+type importedUser struct {
+    Line            int    `json:"line"`
+    ID              string `json:"id"`
+    Username        string `json:"username"`
+    Email           string `json:"email"`
+    Role            string `json:"role"`
+    InitialPassword string `json:"initial_password"`
+}
+
+type importReport struct {
+    DryRun bool `json:"dry_run"`
+    Total  int  `json:"total"`
+    Valid  int  `json:"valid"`
+    // rows that are malformed
+    Errors []importIssue `json:"errors"`
+    // rows that clash with each other or with existing users and records
+    Conflicts []importIssue  `json:"conflicts"`
+    Created   []importedUser `json:"created,omitempty"`
+}
+
+func (r *importReport) ok() bool { return len(r.Errors) == 0 && len(r.Conflicts) == 0 }
+
+// ImportUsers creates students and teachers from a CSV upload (form field
+// "file", or the raw body as text/csv) with the columns username, email,
+// role and optionally class and number (admin only). By default it only
+// checks the file and reports errors and conflicts; with ?commit=true it
+// creates all users in one transaction, or none if any row is rejected, and
+// returns their generated initial passwords. The users join the school the
+// admin acts in; district admins acting in all schools pick it with
+// ?school_id=, which is needed to refer to classes by name.
+func ImportUsers(policy *password.Policy) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        schoolID := c.Query("school_id")
+        if schoolID != "" {
+            if err := utils.Validate.Var(schoolID, "uuid"); err != nil {
+                response.Error(c, http.StatusBadRequest, "invalid school_id", nil)
+                return
+            }
+        }
+        schoolID, ok := requestSchool(c, schoolID)
+        if !ok {
+            response.Error(c, http.StatusForbidden, "you can only import into your own school", nil)
+            return
+        }
+        data, err := readImportFile(c)
+        if err != nil {
+            response.Error(c, http.StatusBadRequest, "invalid request", err.Error())
+            return
+        }
+
+        report := &importReport{DryRun: c.Query("commit") != "true", Errors: []importIssue{}, Conflicts: []importIssue{}}
+        rows := parseImportCSV(data, report)
+        if len(rows) > maxImportRows {
+            response.Error(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d rows per import", maxImportRows), nil)
+            return
+        }
+        report.Total = len(rows)
+
+        db, _ := c.Get("db")
+        gdb := db.(*gorm.DB)
+        if schoolID != "" {
+            var school models.School
+            if err := gdb.First(&school, "id = ?", schoolID).Error; err != nil {
+                response.Error(c, http.StatusBadRequest, "school not found", nil)
+                return
+            }
+        }
+        valid, err := checkImportRows(gdb, schoolID, rows, report)
+        if err != nil {
+            response.Error(c, http.StatusInternalServerError, "import failed", err.Error())
+            return
+        }
+        report.Valid = len(valid)
+
+        if report.DryRun {
+            response.Success(c, report)
+            return
+        }
+        if !report.ok() || len(rows) == 0 {
+            response.ErrorWithCode(c, http.StatusUnprocessableEntity, CodeImportInvalid, "nothing was imported; fix the reported rows first", report)
+            return
+        }
+        if report.Created, err = createImportedUsers(gdb, policy, schoolID, valid); err != nil {
+            response.Error(c, http.StatusInternalServerError, "import failed", err.Error())
+            return
+        }
+        response.Success(c, report)
+    }
+}
+
+func readImportFile(c *gin.Context) ([]byte, error) {
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+    var r io.Reader = c.Request.Body
+    if strings.HasPrefix(c.ContentType(), "multipart/") {
+        fh, err := c.FormFile("file")
+        if err != nil {
+            return nil, err
+        }
+        f, err := fh.Open()
+        if err != nil {
+            return nil, err
+        }
+        defer f.Close()
+        r = f
+    }
+    return io.ReadAll(r)
+}
+
+// parseImportCSV reads the rows of data; malformed lines are reported and skipped.
+func parseImportCSV(data []byte, report *importReport) []*importRow {
+    // spreadsheet programs like to start UTF-8 files with a BOM
+    cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+    cr.FieldsPerRecord = -1
+    header, err := cr.Read()
+    if err != nil {
+        report.Errors = append(report.Errors, importIssue{Line: 1, Message: "missing header row"})
+        return nil
+    }
+    index := map[string]int{}
+    for i, name := range header {
+        name = strings.ToLower(strings.TrimSpace(name))
+        if _, known := importColumns[name]; !known {
+            report.Errors = append(report.Errors, importIssue{Line: 1, Field: name, Message: "unknown column"})
+            continue
+        }
+        index[name] = i
+    }
+    for _, name := range []string{"username", "email", "role"} {
+        if _, ok := index[name]; !ok {
+            report.Errors = append(report.Errors, importIssue{Line: 1, Field: name, Message: "missing column"})
+        }
+    }
+    if len(report.Errors) > 0 {
+        return nil
+    }
+
+    var rows []*importRow
+    for {
+        rec, err := cr.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            var pe *csv.ParseError
+            if !errors.As(err, &pe) {
+                report.Errors = append(report.Errors, importIssue{Message: err.Error()})
+                break
+            }
+            report.Errors = append(report.Errors, importIssue{Line: pe.Line, Message: pe.Err.Error()})
+            continue
+        }
+        line, _ := cr.FieldPos(0)
+        field := func(name string) string {
+            if i, ok := index[name]; ok && i < len(rec) {
+                return strings.TrimSpace(rec[i])
+            }
+            return ""
+        }
+        row := &importRow{
+            Line:     line,
+            Username: field("username"),
+            Email:    strings.ToLower(field("email")),
+            Role:     strings.ToLower(field("role")),
+            Class:    field("class"),
+            Number:   field("number"),
+        }
+        if row.Username == "" && row.Email == "" && row.Role == "" && row.Class == "" && row.Number == "" {
+            // blank line at the end of a spreadsheet export
+            continue
+        }
+        rows = append(rows, row)
+    }
+    return rows
+}
+
+// checkImportRows validates the rows and looks for clashes within the file
+// and with existing data. It returns the rows without problems.
+func checkImportRows(gdb *gorm.DB, schoolID string, rows []*importRow, report *importReport) ([]*importRow, error) {
+    bad := map[int]bool{}
+    reject := func(list *[]importIssue, row *importRow, field, msg string) {
+        *list = append(*list, importIssue{Line: row.Line, Field: field, Message: msg})
+        bad[row.Line] = true
+    }
+
+    for _, row := range rows {
+        if err := utils.ValidateStruct(row); err != nil {
+            var ve validator.ValidationErrors
+            if !errors.As(err, &ve) {
+                return nil, err
+            }
+            for _, fe := range ve {
+                reject(&report.Errors, row, strings.ToLower(fe.Field()), fmt.Sprintf("failed %s validation", fe.Tag()))
+            }
+        }
+        if row.Class != "" && row.Role != models.RoleStudent {
+            reject(&report.Errors, row, "class", "only students can be enrolled in a class")
+        }
+    }
+
+    // duplicates within the file
+    seen := map[string]int{}
+    for _, row := range rows {
+        // student and teacher numbers are separate series
+        for _, f := range [][2]string{{"username", row.Username}, {"email", row.Email}, {"number", row.Number}} {
+            field, value := f[0], f[1]
+            if value == "" {
+                continue
+            }
+            key := field + "\x00" + value
+            if field == "number" {
+                key = row.Role + "\x00" + key
+            }
+            if first, dup := seen[key]; dup {
+                reject(&report.Conflicts, row, field, fmt.Sprintf("%q is also used on line %d", value, first))
+                continue
+            }
+            seen[key] = row.Line
+        }
+    }
+
+    // existing users, including deleted ones that still hold their username and email
+    var usernames, emails, numbers []string
+    for _, row := range rows {
+        usernames = append(usernames, row.Username)
+        emails = append(emails, row.Email)
+        if row.Number != "" {
+            numbers = append(numbers, row.Number)
+        }
+    }
+    if len(rows) > 0 {
+        var existing []models.User
+        if err := gdb.Unscoped().Select("username", "email").
+            Where("username IN ? OR LOWER(email) IN ?", usernames, emails).Find(&existing).Error; err != nil {
+            return nil, err
+        }
+        taken := map[string]bool{}
+        for _, u := range existing {
+            taken["username\x00"+u.Username] = true
+            taken["email\x00"+strings.ToLower(u.Email)] = true
+        }
+        for _, row := range rows {
+            if taken["username\x00"+row.Username] {
+                reject(&report.Conflicts, row, "username", "a user with this username already exists")
+            }
+            if taken["email\x00"+row.Email] {
+                reject(&report.Conflicts, row, "email", "a user with this email already exists")
+            }
+        }
+    }
+    if len(numbers) > 0 {
+        var profiles []models.UserProfile
+        if err := gdb.Where("student_id IN ? OR teacher_id IN ?", numbers, numbers).Find(&profiles).Error; err != nil {
+            return nil, err
+        }
+        taken := map[string]bool{}
+        for _, p := range profiles {
+            if p.StudentID != nil {
+                taken[models.RoleStudent+"\x00"+*p.StudentID] = true
+            }
+            if p.TeacherID != nil {
+                taken[models.RoleTeacher+"\x00"+*p.TeacherID] = true
+            }
+        }
+        for _, row := range rows {
+            if row.Number != "" && taken[row.Role+"\x00"+row.Number] {
+                reject(&report.Conflicts, row, "number", fmt.Sprintf("%s number already assigned", row.Role))
+            }
+        }
+    }
+
+    if err := resolveImportClasses(gdb, schoolID, rows, func(row *importRow, msg string) {
+        reject(&report.Errors, row, "class", msg)
+    }); err != nil {
+        return nil, err
+    }
+
+    var valid []*importRow
+    for _, row := range rows {
+        if !bad[row.Line] {
+            valid = append(valid, row)
+        }
+    }
+    return valid, nil
+}
+
+// resolveImportClasses sets the class ID of rows with a class column, which
+// holds either a class ID or the name of a class in the school.
+func resolveImportClasses(gdb *gorm.DB, schoolID string, rows []*importRow, reject func(*importRow, string)) error {
+    var ids []string
+    needed := false
+    for _, row := range rows {
+        needed = needed || row.Class != ""
+        if utils.Validate.Var(row.Class, "uuid") == nil {
+            ids = append(ids, strings.ToLower(row.Class))
+        }
+    }
+    if !needed {
+        return nil
+    }
+    var classes []models.Class
+    q := gdb.Model(&models.Class{})
+    switch {
+    case schoolID != "":
+        q = q.Where("school_id = ?", schoolID)
+    case len(ids) > 0:
+        q = q.Where("id IN ?", ids)
+    default:
+        q = q.Where("1 = 0")
+    }
+    if err := q.Find(&classes).Error; err != nil {
+        return err
+    }
+    byID := map[string]string{}
+    byName := map[string][]string{}
+    for _, cl := range classes {
+        byID[cl.ID] = cl.ID
+        if schoolID != "" {
+            byName[strings.ToLower(cl.Name)] = append(byName[strings.ToLower(cl.Name)], cl.ID)
+        }
+    }
+    for _, row := range rows {
+        if row.Class == "" {
+            continue
+        }
+        if id, ok := byID[strings.ToLower(row.Class)]; ok {
+            row.classID = id
+            continue
+        }
+        switch ids := byName[strings.ToLower(row.Class)]; {
+        case len(ids) == 1:
+            row.classID = ids[0]
+        case len(ids) > 1:
+            reject(row, "class name is ambiguous; use the class ID")
+        case schoolID == "":
+            reject(row, "class not found; class names need ?school_id=")
+        default:
+            reject(row, "class not found in this school")
+        }
+    }
+    return nil
+}
+
+// createImportedUsers creates the rows with generated passwords in one transaction.
+func createImportedUsers(gdb *gorm.DB, policy *password.Policy, schoolID string, rows []*importRow) ([]importedUser, error) {
+    cfg, _ := config.LoadConfig()
+    length := cfg.Password.MinLength
+    if length < 14 {
+        length = 14
+    }
+    h, err := password.NewHasher(cfg.Password.Hash)
+    if err != nil {
+        return nil, err
+    }
+
+    created := make([]importedUser, 0, len(rows))
+    now := time.Now()
+    err = gdb.Transaction(func(tx *gorm.DB) error {
+        for _, row := range rows {
+            pw, err := generateInitialPassword(policy, length, row)
+            if err != nil {
+                return err
+            }
+            hash, err := h.Hash(pw)
+            if err != nil {
+                return err
+            }
+            user := &models.User{
+                Username:        row.Username,
+                Email:           row.Email,
+                PasswordHash:    hash,
+                Role:            row.Role,
+                Status:          models.StatusActive,
+                EmailVerifiedAt: &now,
+            }
+            if schoolID != "" {
+                user.SchoolID = &schoolID
+            }
+            if err := tx.Create(user).Error; err != nil {
+                return fmt.Errorf("line %d: %w", row.Line, err)
+            }
+            if row.Number != "" {
+                profile := &models.UserProfile{UserID: user.ID}
+                if row.Role == models.RoleStudent {
+                    profile.StudentID = &row.Number
+                } else {
+                    profile.TeacherID = &row.Number
+                }
+                if err := tx.Create(profile).Error; err != nil {
+                    return fmt.Errorf("line %d: %w", row.Line, err)
+                }
+            }
+            if row.classID != "" {
+                if err := tx.Create(&models.ClassStudent{ClassID: row.classID, StudentID: user.ID}).Error; err != nil {
+                    return fmt.Errorf("line %d: %w", row.Line, err)
+                }
+            }
+            created = append(created, importedUser{
+                Line: row.Line, ID: user.ID, Username: user.Username, Email: user.Email, Role: user.Role, InitialPassword: pw,
+            })
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return created, nil
+}
+
+// generateInitialPassword returns a random password that passes the policy.
+func generateInitialPassword(policy *password.Policy, length int, row *importRow) (string, error) {
+    for i := 0; i < 10; i++ {
+        pw, err := password.Generate(length)
+        if err != nil {
+            return "", err
+        }
+        if policy.Validate(pw, row.Username, row.Email) == nil {
+            return pw, nil
+        }
+    }
+    return "", errors.New("cannot generate a password that meets the password policy")
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+
+    "gorm.io/gorm"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+    "github.com/C14147/SmartCampus-Workbench/internal/models"
+    "github.com/C14147/SmartCampus-Workbench/internal/password"
+    "github.com/C14147/SmartCampus-Workbench/internal/testutil"
+)
+
+// importFixture is a school with class 1A, a student "taken" with student
+// number S-1, and a router whose admin imports into the school.
+func importFixture(t *testing.T) (*gorm.DB, http.Handler) {
+    t.Helper()
+    db := testutil.NewDB(t, &models.School{}, &models.User{}, &models.UserProfile{}, &models.Class{}, &models.ClassStudent{})
+    school := models.School{Name: "North", Code: "N"}
+    if err := db.Create(&school).Error; err != nil {
+        t.Fatal(err)
+    }
+    if err := db.Create(&models.Class{SchoolID: school.ID, Name: "1A"}).Error; err != nil {
+        t.Fatal(err)
+    }
+    taken := createUser(t, db, &models.User{Username: "taken", Email: "taken@example.org", Role: models.RoleStudent})
+    number := "S-1"
+    if err := db.Create(&models.UserProfile{UserID: taken.ID, StudentID: &number}).Error; err != nil {
+        t.Fatal(err)
+    }
+    policy, err := password.NewPolicy(config.PasswordConfig{MinLength: 12})
+    if err != nil {
+        t.Fatal(err)
+    }
+    r := newTestRouter(db, asUser("", models.RoleAdmin, school.ID))
+    r.POST("/import", ImportUsers(policy))
+    return db, r
+}
+
+func postCSV(t *testing.T, h http.Handler, query, csv string) (int, importReport) {
+    t.Helper()
+    req := httptest.NewRequest("POST", "/import"+query, strings.NewReader(csv))
+    req.Header.Set("Content-Type", "text/csv")
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, req)
+    var body struct {
+        Data    importReport `json:"data"`
+        Details importReport `json:"details"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decode %s: %v", w.Body, err)
+    }
+    if w.Code != http.StatusOK {
+        return w.Code, body.Details
+    }
+    return w.Code, body.Data
+}
+
+const importCSV = "\xef\xbb\xbfUsername,Email,Role,Class,Number\n" +
+    "ana,Ana@Example.org,student,1a,S-2\n" +
+    "ana,other@example.org,student,,\n" +
+    "taken,new@example.org,teacher,,\n" +
+    "ben,not-an-email,student,,\n" +
+    "carl,carl@example.org,teacher,1A,\n" +
+    "dora,dora@example.org,student,,S-1\n" +
+    "emil,emil@example.org,student,2B,\n" +
+    "fay,fay@example.org,teacher,,S-2\n" +
+    ",,,,\n"
+
+func TestImportUsersDryRun(t *testing.T) {
+    db, r := importFixture(t)
+    var before int64
+    db.Model(&models.User{}).Count(&before)
+
+    code, report := postCSV(t, r, "", importCSV)
+    if code != http.StatusOK {
+        t.Fatalf("status %d", code)
+    }
+    if !report.DryRun || report.Total != 8 || report.Valid != 2 {
+        t.Errorf("dry_run %v, total %d, valid %d; want true, 8, 2", report.DryRun, report.Total, report.Valid)
+    }
+    wantErrors := []importIssue{
+        {Line: 5, Field: "email", Message: "failed email validation"},
+        {Line: 6, Field: "class", Message: "only students can be enrolled in a class"},
+        {Line: 8, Field: "class", Message: "class not found in this school"},
+    }
+    wantConflicts := []importIssue{
+        {Line: 3, Field: "username", Message: `"ana" is also used on line 2`},
+        {Line: 4, Field: "username", Message: "a user with this username already exists"},
+        // student and teacher numbers are separate series, so fay's S-2 is fine
+        {Line: 7, Field: "number", Message: "student number already assigned"},
+    }
+    if !reflect.DeepEqual(report.Errors, wantErrors) {
+        t.Errorf("errors %+v\nwant %+v", report.Errors, wantErrors)
+    }
+    if !reflect.DeepEqual(report.Conflicts, wantConflicts) {
+        t.Errorf("conflicts %+v\nwant %+v", report.Conflicts, wantConflicts)
+    }
+
+    // committing a file with problems creates nobody either
+    if code, _ := postCSV(t, r, "?commit=true", importCSV); code != http.StatusUnprocessableEntity {
+        t.Errorf("commit with problems: status %d, want 422", code)
+    }
+    var after int64
+    db.Model(&models.User{}).Count(&after)
+    if after != before {
+        t.Errorf("%d users created", after-before)
+    }
+}
+
+func TestImportUsersHeader(t *testing.T) {
+    _, r := importFixture(t)
+    for _, tc := range []struct {
+        name string
+        csv  string
+        want []importIssue
+    }{
+        {"empty", "", []importIssue{{Line: 1, Message: "missing header row"}}},
+        {"missing column", "username,email\nana,ana@example.org\n", []importIssue{{Line: 1, Field: "role", Message: "missing column"}}},
+        {"unknown column", "username,email,role,phone\n", []importIssue{{Line: 1, Field: "phone", Message: "unknown column"}}},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            code, report := postCSV(t, r, "", tc.csv)
+            if code != http.StatusOK || !reflect.DeepEqual(report.Errors, tc.want) || report.Total != 0 {
+                t.Errorf("status %d, errors %+v, total %d; want 200, %+v, 0", code, report.Errors, report.Total, tc.want)
+            }
+        })
+    }
+}
+
+func TestImportUsersCommit(t *testing.T) {
+    db, r := importFixture(t)
+    code, report := postCSV(t, r, "?commit=true", "username,email,role,class,number\nana,Ana@Example.org,student,1A,S-2\nfay,fay@example.org,teacher,,S-2\n")
+    if code != http.StatusOK || report.DryRun || len(report.Created) != 2 {
+        t.Fatalf("status %d, dry_run %v, created %d", code, report.DryRun, len(report.Created))
+    }
+    var ana models.User
+    if err := db.First(&ana, "username = ?", "ana").Error; err != nil {
+        t.Fatal(err)
+    }
+    if ana.Email != "ana@example.org" || ana.SchoolID == nil || !password.Verify(report.Created[0].InitialPassword, ana.PasswordHash) {
+        t.Errorf("imported user %+v does not match the report", ana)
+    }
+    var enrolled int64
+    db.Model(&models.ClassStudent{}).Where("student_id = ?", ana.ID).Count(&enrolled)
+    if enrolled != 1 {
+        t.Error("student not enrolled in class 1A")
+    }
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/utils"
+)
+
+// FileMailer writes every message as an .eml file into a directory, which is
+// handy for local development without an SMTP server.
+type FileMailer struct {
+    from string
+    dir  string
+}
+
+func NewFileMailer(from, dir string) (*FileMailer, error) {
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return nil, fmt.Errorf("mail directory: %w", err)
+    }
+    return &FileMailer{from: from, dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), utils.NewUUID()[:8])
+    return os.WriteFile(filepath.Join(m.dir, name), render(m.from, msg), 0o600)
+}
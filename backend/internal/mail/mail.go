@@ -0,0 +1,49 @@
+package mail
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+)
+
+// Message is a plain text email.
+type Message struct {
+    To      string
+    Subject string
+    Body    string
+}
+
+// Mailer delivers outgoing email (password resets, verification links, ...).
+type Mailer interface {
+    Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer selected by cfg.Driver: "smtp", "file" or "memory".
+func New(cfg config.MailConfig) (Mailer, error) {
+    switch cfg.Driver {
+    case "smtp":
+        return NewSMTPMailer(cfg), nil
+    case "file":
+        return NewFileMailer(cfg.From, cfg.Dir)
+    case "memory":
+        return NewMemoryMailer(), nil
+    }
+    return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+// render formats msg as an RFC 5322 message.
+func render(from string, msg Message) []byte {
+    var b strings.Builder
+    fmt.Fprintf(&b, "From: %s\r\n", from)
+    fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+    fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+    fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    b.WriteString("MIME-Version: 1.0\r\n")
+    b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+    b.WriteString("\r\n")
+    b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+    return []byte(b.String())
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+    "context"
+    "sync"
+)
+
+// MemoryMailer keeps sent messages in memory; meant for tests and local runs.
+type MemoryMailer struct {
+    mu   sync.Mutex
+    sent []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+    return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    m.mu.Lock()
+    m.sent = append(m.sent, msg)
+    m.mu.Unlock()
+    return nil
+}
+
+// Messages returns a copy of everything sent so far.
+func (m *MemoryMailer) Messages() []Message {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    out := make([]Message, len(m.sent))
+    copy(out, m.sent)
+    return out
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+    "context"
+    "net"
+    "net/smtp"
+    "strconv"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+)
+
+// SMTPMailer sends mail through an SMTP relay, using STARTTLS when offered.
+type SMTPMailer struct {
+    from string
+    addr string
+    auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg config.MailConfig) *SMTPMailer {
+    m := &SMTPMailer{
+        from: cfg.From,
+        addr: net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+    }
+    if cfg.SMTP.Username != "" {
+        m.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+    }
+    return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, render(m.from, msg))
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+    "strings"
+    "time"
+)
+
+// APIToken is a personal access token for scripts and integrations. It acts
+// as its owner (a user or a service account) but only within its scopes.
+// Only the hash of the token is stored; Prefix is kept so that users can tell
+// their tokens apart.
+type APIToken struct {
+    ID         string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    UserID     string     `gorm:"type:uuid;not null;index" json:"user_id"`
+    Name       string     `gorm:"size:100;not null" json:"name"`
+    Prefix     string     `gorm:"size:16;not null" json:"prefix"`
+    TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+    // space separated, e.g. "schools:read users:write"
+    Scopes     string     `gorm:"size:500;not null" json:"-"`
+    ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+    LastUsedAt *time.Time `json:"last_used_at"`
+    RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+    CreatedBy  string     `gorm:"type:uuid" json:"created_by"`
+    CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList returns the scopes of the token.
+func (t *APIToken) ScopeList() []string {
+    return strings.Fields(t.Scopes)
+}
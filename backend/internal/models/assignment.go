@@ -8,7 +8,7 @@ import (
 
 type Assignment struct {
     ID          string         `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-    CourseID    string         `gorm:"type:uuid;not null" json:"course_id"`
+    CourseID    string         `gorm:"type:uuid;not null" json:"course_id" validate:"required,uuid"`
     Title       string         `gorm:"size:200;not null" json:"title"`
     Description string         `json:"description"`
     AssignmentType string      `gorm:"size:50;default:'homework'" json:"assignment_type"`
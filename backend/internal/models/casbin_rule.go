@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// CasbinRule is one policy ("p") or grouping ("g") rule of the Casbin
+// enforcer, in the table layout of the common Casbin GORM adapters.
+type CasbinRule struct {
+    ID    uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+    Ptype string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"ptype"`
+    V0    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v0"`
+    V1    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v1"`
+    V2    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v2"`
+    V3    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v3"`
+    V4    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v4"`
+    V5    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v5"`
+}
+
+func (CasbinRule) TableName() string { return "casbin_rule" }
+
+// LegacyCasbinRule is a path policy (p, sub, path, methods) of the former
+// policy format that migration 023 could not convert into permissions
+// without granting more or less than before. The policy check reports these
+// until they are replaced by permission policies and deleted.
+type LegacyCasbinRule struct {
+    ID      uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+    Ptype   string    `gorm:"size:100" json:"ptype"`
+    V0      string    `gorm:"size:100" json:"v0"`
+    V1      string    `gorm:"size:100" json:"v1"`
+    V2      string    `gorm:"size:100" json:"v2"`
+    V3      string    `gorm:"size:100" json:"v3"`
+    V4      string    `gorm:"size:100" json:"v4"`
+    V5      string    `gorm:"size:100" json:"v5"`
+    MovedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"moved_at"`
+}
+
+func (LegacyCasbinRule) TableName() string { return "casbin_rule_legacy" }
+
+// CasbinRuleRevision is a single row counting the changes of casbin_rule.
+// Every write of the policy adapter bumps it in the same transaction, so
+// instances reload their policies only when it moves.
+type CasbinRuleRevision struct {
+    ID        uint      `gorm:"primaryKey" json:"-"`
+    Revision  int64     `gorm:"not null;default:0" json:"revision"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (CasbinRuleRevision) TableName() string { return "casbin_rule_revision" }
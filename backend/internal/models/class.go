@@ -13,7 +13,7 @@ type Class struct {
     Grade       string         `gorm:"size:50" json:"grade"`
     Classroom   string         `gorm:"size:50" json:"classroom"`
     Capacity    int            `gorm:"default:40" json:"capacity"`
-    HeadTeacher string         `gorm:"type:uuid" json:"head_teacher_id"`
+    HeadTeacher string         `gorm:"column:head_teacher_id;type:uuid" json:"head_teacher_id"`
     Status      string         `gorm:"size:20;default:'active'" json:"status"`
     CreatedAt   time.Time      `json:"created_at"`
     UpdatedAt   time.Time      `json:"updated_at"`
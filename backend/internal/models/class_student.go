@@ -0,0 +1,15 @@
+package models
+
+import (
+    "time"
+)
+
+// ClassStudent enrolls a student in a class.
+type ClassStudent struct {
+    ID             string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    ClassID        string    `gorm:"type:uuid;not null;uniqueIndex:idx_class_students_class_student" json:"class_id"`
+    StudentID      string    `gorm:"type:uuid;not null;uniqueIndex:idx_class_students_class_student;index" json:"student_id"`
+    SeatNumber     int       `json:"seat_number"`
+    EnrollmentDate time.Time `gorm:"type:date;default:CURRENT_DATE" json:"enrollment_date"`
+    Status         string    `gorm:"size:20;default:'active'" json:"status"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+    "time"
+)
+
+// EmailVerificationToken confirms that a user owns their email address; only
+// its hash is stored.
+type EmailVerificationToken struct {
+    ID        string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    UserID    string     `gorm:"type:uuid;not null;index" json:"user_id"`
+    TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+    ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+    UsedAt    *time.Time `json:"used_at"`
+    CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+    "time"
+)
+
+// Guardian link statuses.
+const (
+    GuardianLinkPending  = "pending"
+    GuardianLinkVerified = "verified"
+    GuardianLinkRejected = "rejected"
+)
+
+// GuardianLink connects a guardian to a student. Guardians request links
+// themselves; only verified links (checked by an admin) give access to the
+// student's assignments, grades and notifications.
+type GuardianLink struct {
+    ID           string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    GuardianID   string     `gorm:"type:uuid;not null;uniqueIndex:idx_guardian_links_guardian_student" json:"guardian_id"`
+    StudentID    string     `gorm:"type:uuid;not null;uniqueIndex:idx_guardian_links_guardian_student;index" json:"student_id"`
+    // e.g. mother, father, grandparent
+    Relationship string     `gorm:"size:50" json:"relationship"`
+    Status       string     `gorm:"size:20;not null;default:'pending'" json:"status"`
+    VerifiedBy   *string    `gorm:"type:uuid" json:"verified_by"`
+    VerifiedAt   *time.Time `json:"verified_at"`
+    CreatedAt    time.Time  `json:"created_at"`
+    UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+    "time"
+)
+
+// Kinds of impersonation log entries.
+const (
+    ImpersonationStart   = "start"
+    ImpersonationRequest = "request"
+)
+
+// ImpersonationLog is the audit trail of admins acting as other users: one
+// entry when the impersonation starts and one for every request made with
+// the impersonation token.
+type ImpersonationLog struct {
+    ID             string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    ImpersonatorID string    `gorm:"type:uuid;not null;index" json:"impersonator_id"`
+    UserID         string    `gorm:"type:uuid;not null;index" json:"user_id"`
+    Kind           string    `gorm:"size:20;not null" json:"kind"`
+    Reason         string    `gorm:"size:500" json:"reason,omitempty"`
+    Method         string    `gorm:"size:10" json:"method"`
+    Path           string    `gorm:"size:500" json:"path"`
+    Status         int       `json:"status"`
+    IP             string    `gorm:"column:ip;size:64" json:"ip"`
+    TokenJTI       string    `gorm:"column:token_jti;size:64;index" json:"token_jti"`
+    CreatedAt      time.Time `gorm:"index" json:"created_at"`
+}
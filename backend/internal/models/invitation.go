@@ -0,0 +1,24 @@
+package models
+
+import (
+    "time"
+)
+
+// Invitation lets people register with a preset role, school and optionally
+// class. A class-join code is an invitation with a class and many uses. Only
+// the hash of the code is stored; Hint shows its first characters.
+type Invitation struct {
+    ID        string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    CodeHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+    Hint      string     `gorm:"size:16;not null" json:"hint"`
+    Role      string     `gorm:"size:20;not null" json:"role"`
+    SchoolID  string     `gorm:"type:uuid;not null;index" json:"school_id"`
+    ClassID   *string    `gorm:"type:uuid" json:"class_id"`
+    // 0 means unlimited
+    MaxUses   int        `gorm:"not null;default:1" json:"max_uses"`
+    Uses      int        `gorm:"not null;default:0" json:"uses"`
+    ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+    RevokedAt *time.Time `json:"revoked_at,omitempty"`
+    CreatedBy string     `gorm:"type:uuid;not null;index" json:"created_by"`
+    CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+    "time"
+)
+
+// LoginThrottle counts failed logins for one key, either "user:<username>" or
+// "ip:<address>", and records a temporary lockout.
+type LoginThrottle struct {
+    Key           string     `gorm:"size:150;primaryKey" json:"key"`
+    Failures      int        `gorm:"not null;default:0" json:"failures"`
+    LastFailureAt time.Time  `json:"last_failure_at"`
+    LockedUntil   *time.Time `json:"locked_until"`
+    UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+    "time"
+)
+
+// UserMFA holds the TOTP secret of a user. The secret is pending until the
+// user proves possession with a first code, which sets EnabledAt.
+type UserMFA struct {
+    UserID       string     `gorm:"type:uuid;primaryKey" json:"user_id"`
+    Secret       string     `gorm:"size:64;not null" json:"-"`
+    EnabledAt    *time.Time `json:"enabled_at"`
+    LastUsedStep int64      `gorm:"not null;default:0" json:"-"`
+    CreatedAt    time.Time  `json:"created_at"`
+    UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName keeps the table name readable (GORM would use "user_mf_as").
+func (UserMFA) TableName() string {
+    return "user_mfa"
+}
+
+// MFARecoveryCode is a one-time code that replaces a TOTP code, e.g. after
+// losing the phone. Only the hash is stored.
+type MFARecoveryCode struct {
+    ID        string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    UserID    string     `gorm:"type:uuid;not null;index" json:"user_id"`
+    CodeHash  string     `gorm:"size:64;not null" json:"-"`
+    UsedAt    *time.Time `json:"used_at"`
+    CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName keeps the table name readable (GORM would use "mfa_recovery_codes").
+func (MFARecoveryCode) TableName() string {
+    return "mfa_recovery_codes"
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+    "time"
+)
+
+// Notification audiences.
+const (
+    AudienceAll      = "all"
+    AudienceTeachers = "teachers"
+    AudienceStudents = "students"
+    AudienceClass    = "class"
+)
+
+// Notification is an announcement to everyone, a group or one class (TargetID).
+type Notification struct {
+    ID               string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    Title            string     `gorm:"size:200;not null" json:"title"`
+    Content          string     `gorm:"type:text;not null" json:"content"`
+    NotificationType string     `gorm:"size:50;not null" json:"notification_type"`
+    TargetAudience   string     `gorm:"size:20" json:"target_audience"`
+    TargetID         *string    `gorm:"type:uuid" json:"target_id"`
+    Priority         string     `gorm:"size:20;default:'normal'" json:"priority"`
+    ExpiresAt        *time.Time `json:"expires_at"`
+    CreatedBy        *string    `gorm:"type:uuid" json:"created_by"`
+    CreatedAt        time.Time  `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+    "time"
+)
+
+// PasswordResetToken is a single-use password reset token; only its hash is stored.
+type PasswordResetToken struct {
+    ID        string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    UserID    string     `gorm:"type:uuid;not null;index" json:"user_id"`
+    TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+    ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+    UsedAt    *time.Time `json:"used_at"`
+    CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+    "time"
+)
+
+// RefreshToken is a single link in a rotating refresh token chain. Every token
+// issued from the same login shares a FamilyID so that reuse of an already
+// rotated token can revoke the whole chain.
+type RefreshToken struct {
+    ID        string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    UserID    string     `gorm:"type:uuid;not null;index" json:"user_id"`
+    FamilyID  string     `gorm:"type:uuid;not null;index" json:"family_id"`
+    TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+    ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+    UsedAt    *time.Time `json:"used_at"`
+    RevokedAt *time.Time `json:"revoked_at"`
+    CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+    "time"
+)
+
+// Session is a signed-in device. Its ID is the family id of the refresh
+// tokens issued for the login and the sid claim of its access tokens.
+type Session struct {
+    ID         string     `gorm:"type:uuid;primaryKey" json:"id"`
+    UserID     string     `gorm:"type:uuid;not null;index" json:"user_id"`
+    UserAgent  string     `gorm:"size:512" json:"user_agent"`
+    IP         string     `gorm:"column:ip;size:64" json:"ip"`
+    // school the session acts in; nil for none (or all, for district admins)
+    SchoolID   *string    `gorm:"type:uuid" json:"school_id"`
+    CreatedAt  time.Time  `json:"created_at"`
+    LastSeenAt time.Time  `gorm:"not null" json:"last_seen_at"`
+    // expiry of the newest refresh token; the session ends with it
+    ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+    RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+    "time"
+)
+
+// SigningKey is an asymmetric JWT signing key shared by all API instances.
+// The newest key signs new tokens; older keys stay published in the JWKS
+// until ExpiresAt so that tokens they signed can still be verified.
+type SigningKey struct {
+    Kid        string    `gorm:"size:64;primaryKey" json:"kid"`
+    Algorithm  string    `gorm:"size:20;not null" json:"algorithm"`
+    PrivateKey string    `gorm:"type:text;not null" json:"-"`
+    ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`
+    CreatedAt  time.Time `json:"created_at"`
+}
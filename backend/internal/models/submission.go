@@ -0,0 +1,28 @@
+package models
+
+import (
+    "time"
+)
+
+// AssignmentSubmission is a student's answer to an assignment.
+type AssignmentSubmission struct {
+    ID           string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    AssignmentID string    `gorm:"type:uuid;not null;uniqueIndex:idx_submissions_assignment_student" json:"assignment_id"`
+    StudentID    string    `gorm:"type:uuid;not null;uniqueIndex:idx_submissions_assignment_student;index" json:"student_id"`
+    Content      string    `gorm:"type:text" json:"content"`
+    Attachments  string    `gorm:"type:jsonb;default:'[]'" json:"attachments"`
+    SubmittedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"submitted_at"`
+    Status       string    `gorm:"size:20;default:'submitted'" json:"status"`
+}
+
+// Grade is the teacher's score and feedback for a submission.
+type Grade struct {
+    ID           string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    SubmissionID string     `gorm:"type:uuid;not null;index" json:"submission_id"`
+    Score        *float64   `gorm:"type:decimal(5,2)" json:"score"`
+    Feedback     string     `gorm:"type:text" json:"feedback"`
+    GradedBy     *string    `gorm:"type:uuid" json:"graded_by"`
+    GradedAt     *time.Time `json:"graded_at"`
+    CreatedAt    time.Time  `json:"created_at"`
+    UpdatedAt    time.Time  `json:"updated_at"`
+}
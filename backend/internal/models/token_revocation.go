@@ -0,0 +1,20 @@
+package models
+
+import (
+    "time"
+)
+
+// TokenRevocation is an entry of the access token denylist. When JTI is set it
+// revokes that single token, when SessionID is set every token of that
+// session, and when both are empty every token of UserID issued before
+// RevokedAt. A jti is listed at most once, which makes single-use tokens
+// (Denylist.ConsumeToken) work across instances. Rows can be purged once
+// ExpiresAt passes.
+type TokenRevocation struct {
+    ID        string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    JTI       string    `gorm:"column:jti;size:64;uniqueIndex:idx_token_revocations_jti,where:jti <> ''" json:"jti"`
+    SessionID string    `gorm:"size:64;index" json:"session_id"`
+    UserID    string    `gorm:"type:uuid;not null;index" json:"user_id"`
+    RevokedAt time.Time `gorm:"not null" json:"revoked_at"`
+    ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
@@ -6,13 +6,42 @@ import (
     "gorm.io/gorm"
 )
 
+// User roles.
+const (
+    RoleAdmin    = "admin"
+    RoleTeacher  = "teacher"
+    RoleStudent  = "student"
+    // parents and other guardians, with read access to their linked students
+    RoleGuardian = "guardian"
+    // district staff, admin of every school
+    RoleDistrictAdmin = "district_admin"
+)
+
+// Account statuses.
+const (
+    StatusActive    = "active"
+    StatusInactive  = "inactive"
+    StatusSuspended = "suspended"
+)
+
+// Account kinds. Service accounts are for automation: they cannot sign in
+// with a password and authenticate with API tokens only.
+const (
+    KindHuman   = "human"
+    KindService = "service"
+)
+
 type User struct {
-    ID           string         `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-    Username     string         `gorm:"uniqueIndex;size:50;not null" json:"username"`
-    Email        string         `gorm:"uniqueIndex;size:100" json:"email"`
-    PasswordHash string         `gorm:"size:255;not null" json:"-"`
-    Role         string         `gorm:"size:20;not null;default:'student'" json:"role"`
-    CreatedAt    time.Time      `json:"created_at"`
-    UpdatedAt    time.Time      `json:"updated_at"`
-    DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+    ID              string         `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    Username        string         `gorm:"uniqueIndex;size:50;not null" json:"username"`
+    Email           string         `gorm:"uniqueIndex;size:100" json:"email"`
+    PasswordHash    string         `gorm:"size:255;not null" json:"-"`
+    Role            string         `gorm:"size:20;not null;default:'student'" json:"role"`
+    Status          string         `gorm:"size:20;not null;default:'active'" json:"status"`
+    Kind            string         `gorm:"size:20;not null;default:'human'" json:"kind"`
+    SchoolID        *string        `gorm:"type:uuid;index" json:"school_id"`
+    EmailVerifiedAt *time.Time     `json:"email_verified_at"`
+    CreatedAt       time.Time      `json:"created_at"`
+    UpdatedAt       time.Time      `json:"updated_at"`
+    DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import (
+    "time"
+)
+
+// UserIdentity links a user to an account at an external identity provider,
+// identified by the provider's issuer and its subject for the user.
+type UserIdentity struct {
+    ID          string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    UserID      string     `gorm:"type:uuid;not null;index" json:"user_id"`
+    Issuer      string     `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject" json:"issuer"`
+    Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject" json:"subject"`
+    Email       string     `gorm:"size:100" json:"email"`
+    LastLoginAt *time.Time `json:"last_login_at"`
+    CreatedAt   time.Time  `json:"created_at"`
+}
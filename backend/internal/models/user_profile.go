@@ -0,0 +1,55 @@
+package models
+
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "time"
+)
+
+// UserProfile holds school records of a user that are not needed to sign in.
+type UserProfile struct {
+    UserID string `gorm:"type:uuid;primaryKey" json:"user_id"`
+    // student number
+    StudentID *string `gorm:"size:50;uniqueIndex" json:"student_id"`
+    // teacher (staff) number
+    TeacherID         *string           `gorm:"size:50;uniqueIndex" json:"teacher_id"`
+    Department        string            `gorm:"size:100" json:"department"`
+    Grade             string            `gorm:"size:50" json:"grade"`
+    BirthDate         *time.Time        `gorm:"type:date" json:"birth_date"`
+    Address           string            `gorm:"type:text" json:"address"`
+    EmergencyContacts EmergencyContacts `gorm:"column:emergency_contact;type:jsonb" json:"emergency_contacts"`
+    CreatedAt         time.Time         `json:"created_at"`
+    UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// EmergencyContact is a person to call about a user, e.g. a parent.
+type EmergencyContact struct {
+    Name         string `json:"name" validate:"required,max=100"`
+    Relationship string `json:"relationship" validate:"max=50"`
+    Phone        string `json:"phone" validate:"required,max=30"`
+}
+
+// EmergencyContacts is stored as a JSON array.
+type EmergencyContacts []EmergencyContact
+
+func (e EmergencyContacts) Value() (driver.Value, error) {
+    if e == nil {
+        return "[]", nil
+    }
+    b, err := json.Marshal(e)
+    return string(b), err
+}
+
+func (e *EmergencyContacts) Scan(src interface{}) error {
+    switch v := src.(type) {
+    case nil:
+        *e = nil
+        return nil
+    case []byte:
+        return json.Unmarshal(v, e)
+    case string:
+        return json.Unmarshal([]byte(v), e)
+    }
+    return errors.New("emergency contacts: unsupported column type")
+}
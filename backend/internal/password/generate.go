@@ -0,0 +1,52 @@
+package password
+
+import (
+    "crypto/rand"
+    "math/big"
+)
+
+const (
+    upperChars  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+    lowerChars  = "abcdefghijkmnopqrstuvwxyz"
+    digitChars  = "23456789"
+    symbolChars = "!#$%*+-=?@_"
+)
+
+// Generate returns a random password of length n (at least 4) with upper and
+// lower case letters, digits and symbols, leaving out look-alike characters.
+func Generate(n int) (string, error) {
+    if n < 4 {
+        n = 4
+    }
+    all := upperChars + lowerChars + digitChars + symbolChars
+    // one of each class, the rest from all of them
+    sets := []string{upperChars, lowerChars, digitChars, symbolChars}
+    for len(sets) < n {
+        sets = append(sets, all)
+    }
+    out := make([]byte, n)
+    for i, set := range sets {
+        c, err := randIndex(len(set))
+        if err != nil {
+            return "", err
+        }
+        out[i] = set[c]
+    }
+    // shuffle so the guaranteed classes are not always in front
+    for i := n - 1; i > 0; i-- {
+        j, err := randIndex(i + 1)
+        if err != nil {
+            return "", err
+        }
+        out[i], out[j] = out[j], out[i]
+    }
+    return string(out), nil
+}
+
+func randIndex(n int) (int, error) {
+    v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+    if err != nil {
+        return 0, err
+    }
+    return int(v.Int64()), nil
+}
@@ -0,0 +1,133 @@
+package password
+
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "fmt"
+    "strings"
+
+    "golang.org/x/crypto/argon2"
+    "golang.org/x/crypto/bcrypt"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+)
+
+// Hash algorithms.
+const (
+    Argon2id = "argon2id"
+    Bcrypt   = "bcrypt"
+)
+
+// Hasher makes password hashes in PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>. bcrypt hashes keep their
+// usual $2a$/$2b$ form.
+type Hasher struct {
+    cfg config.PasswordHashConfig
+}
+
+// NewHasher checks cfg and returns a hasher for it.
+func NewHasher(cfg config.PasswordHashConfig) (*Hasher, error) {
+    switch cfg.Algorithm {
+    case Argon2id:
+        a := cfg.Argon2
+        if a.Memory < 8*uint32(a.Parallelism) || a.Iterations < 1 || a.Parallelism < 1 || a.SaltLength < 8 || a.KeyLength < 16 {
+            return nil, fmt.Errorf("password hash: invalid argon2 parameters")
+        }
+    case Bcrypt:
+        if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+            return nil, fmt.Errorf("password hash: bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+        }
+    default:
+        return nil, fmt.Errorf("password hash: unknown algorithm %q", cfg.Algorithm)
+    }
+    return &Hasher{cfg: cfg}, nil
+}
+
+// Hash returns a new hash of pw with the configured algorithm and parameters.
+func (h *Hasher) Hash(pw string) (string, error) {
+    if h.cfg.Algorithm == Bcrypt {
+        hash, err := bcrypt.GenerateFromPassword([]byte(pw), h.cfg.BcryptCost)
+        return string(hash), err
+    }
+    a := h.cfg.Argon2
+    salt := make([]byte, a.SaltLength)
+    if _, err := rand.Read(salt); err != nil {
+        return "", err
+    }
+    key := argon2.IDKey([]byte(pw), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+    return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+        base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or other
+// parameters than the configured ones. Unrecognised hashes never need it.
+func (h *Hasher) NeedsRehash(hash string) bool {
+    if isBcrypt(hash) {
+        if h.cfg.Algorithm != Bcrypt {
+            return true
+        }
+        cost, err := bcrypt.Cost([]byte(hash))
+        return err == nil && cost != h.cfg.BcryptCost
+    }
+    p, err := parseArgon2id(hash)
+    if err != nil {
+        return false
+    }
+    a := h.cfg.Argon2
+    return h.cfg.Algorithm != Argon2id || p.version != argon2.Version ||
+        p.memory != a.Memory || p.iterations != a.Iterations || p.parallelism != a.Parallelism ||
+        uint32(len(p.salt)) != a.SaltLength || uint32(len(p.key)) != a.KeyLength
+}
+
+// Verify reports whether pw matches hash, whichever supported algorithm and
+// parameters made it. Malformed or unknown hashes never match.
+func Verify(pw, hash string) bool {
+    if isBcrypt(hash) {
+        return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil
+    }
+    p, err := parseArgon2id(hash)
+    if err != nil || p.version != argon2.Version {
+        return false
+    }
+    key := argon2.IDKey([]byte(pw), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+    return subtle.ConstantTimeCompare(key, p.key) == 1
+}
+
+func isBcrypt(hash string) bool {
+    return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2Params struct {
+    version     int
+    memory      uint32
+    iterations  uint32
+    parallelism uint8
+    salt, key   []byte
+}
+
+func parseArgon2id(hash string) (*argon2Params, error) {
+    // "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+    parts := strings.Split(hash, "$")
+    if len(parts) != 6 || parts[1] != Argon2id {
+        return nil, fmt.Errorf("not an argon2id hash")
+    }
+    var p argon2Params
+    if _, err := fmt.Sscanf(parts[2], "v=%d", &p.version); err != nil {
+        return nil, err
+    }
+    if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+        return nil, err
+    }
+    var err error
+    if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+        return nil, err
+    }
+    if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+        return nil, err
+    }
+    if len(p.key) == 0 || p.iterations == 0 || p.parallelism == 0 {
+        return nil, fmt.Errorf("invalid argon2id parameters")
+    }
+    return &p, nil
+}
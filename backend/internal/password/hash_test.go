@@ -0,0 +1,152 @@
+package password
+
+import (
+    "strings"
+    "testing"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+)
+
+// cheap parameters keep the tests fast
+var testArgon2 = config.Argon2Config{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestHasher(t *testing.T, cfg config.PasswordHashConfig) *Hasher {
+    t.Helper()
+    h, err := NewHasher(cfg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return h
+}
+
+func mustHash(t *testing.T, h *Hasher, pw string) string {
+    t.Helper()
+    hash, err := h.Hash(pw)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return hash
+}
+
+func TestNewHasher(t *testing.T) {
+    for _, tc := range []struct {
+        name string
+        cfg  config.PasswordHashConfig
+        ok   bool
+    }{
+        {"argon2id", config.PasswordHashConfig{Algorithm: Argon2id, Argon2: testArgon2}, true},
+        {"bcrypt", config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}, true},
+        {"bcrypt cost too high", config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MaxCost + 1}, false},
+        {"argon2 without iterations", config.PasswordHashConfig{Algorithm: Argon2id, Argon2: config.Argon2Config{Memory: 64, Parallelism: 1, SaltLength: 16, KeyLength: 32}}, false},
+        {"argon2 short salt", config.PasswordHashConfig{Algorithm: Argon2id, Argon2: config.Argon2Config{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 4, KeyLength: 32}}, false},
+        {"unknown", config.PasswordHashConfig{Algorithm: "md5"}, false},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            if _, err := NewHasher(tc.cfg); (err == nil) != tc.ok {
+                t.Errorf("NewHasher: %v, want ok %v", err, tc.ok)
+            }
+        })
+    }
+}
+
+func TestVerify(t *testing.T) {
+    argon := newTestHasher(t, config.PasswordHashConfig{Algorithm: Argon2id, Argon2: testArgon2})
+    bc := newTestHasher(t, config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+    argonHash := mustHash(t, argon, "correct horse")
+    bcryptHash := mustHash(t, bc, "correct horse")
+    if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=64,t=1,p=1$") {
+        t.Fatalf("unexpected argon2id hash %q", argonHash)
+    }
+    if mustHash(t, argon, "correct horse") == argonHash {
+        t.Error("two hashes of the same password share a salt")
+    }
+
+    for _, tc := range []struct {
+        name string
+        pw   string
+        hash string
+        want bool
+    }{
+        {"argon2id", "correct horse", argonHash, true},
+        {"argon2id wrong password", "correct horse!", argonHash, false},
+        {"bcrypt", "correct horse", bcryptHash, true},
+        {"bcrypt wrong password", "Correct horse", bcryptHash, false},
+        {"argon2id other version", "correct horse", strings.Replace(argonHash, "v=19", "v=16", 1), false},
+        {"argon2id truncated", "correct horse", argonHash[:len(argonHash)-10], false},
+        {"unusable", "!", "!", false},
+        {"empty", "", "", false},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := Verify(tc.pw, tc.hash); got != tc.want {
+                t.Errorf("Verify = %v, want %v", got, tc.want)
+            }
+        })
+    }
+}
+
+func TestNeedsRehash(t *testing.T) {
+    argonCfg := config.PasswordHashConfig{Algorithm: Argon2id, Argon2: testArgon2}
+    argon := newTestHasher(t, argonCfg)
+    stronger := argonCfg
+    stronger.Argon2.Iterations = 2
+    bc := newTestHasher(t, config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+    argonHash := mustHash(t, argon, "correct horse")
+    bcryptHash := mustHash(t, bc, "correct horse")
+
+    for _, tc := range []struct {
+        name string
+        h    *Hasher
+        hash string
+        want bool
+    }{
+        {"current argon2id", argon, argonHash, false},
+        {"argon2id with fewer iterations", newTestHasher(t, stronger), argonHash, true},
+        {"bcrypt when argon2id is configured", argon, bcryptHash, true},
+        {"current bcrypt", bc, bcryptHash, false},
+        {"bcrypt with another cost", newTestHasher(t, config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}), bcryptHash, true},
+        {"argon2id when bcrypt is configured", bc, argonHash, true},
+        {"unrecognised", argon, "!", false},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := tc.h.NeedsRehash(tc.hash); got != tc.want {
+                t.Errorf("NeedsRehash = %v, want %v", got, tc.want)
+            }
+        })
+    }
+}
+
+func TestParseArgon2id(t *testing.T) {
+    for _, tc := range []struct {
+        name string
+        hash string
+        want *argon2Params
+    }{
+        {"valid", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$a2V5a2V5a2V5",
+            &argon2Params{version: 19, memory: 65536, iterations: 3, parallelism: 2, salt: []byte("saltsalt"), key: []byte("keykeykey")}},
+        {"argon2i", "$argon2i$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$a2V5a2V5a2V5", nil},
+        {"missing field", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ", nil},
+        {"bad parameters", "$argon2id$v=19$m=65536;t=3;p=2$c2FsdHNhbHQ$a2V5a2V5a2V5", nil},
+        {"zero iterations", "$argon2id$v=19$m=65536,t=0,p=2$c2FsdHNhbHQ$a2V5a2V5a2V5", nil},
+        {"padded base64", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ=$a2V5a2V5a2V5", nil},
+        {"empty key", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$", nil},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            got, err := parseArgon2id(tc.hash)
+            if tc.want == nil {
+                if err == nil {
+                    t.Errorf("parsed %+v, want an error", got)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got.version != tc.want.version || got.memory != tc.want.memory || got.iterations != tc.want.iterations ||
+                got.parallelism != tc.want.parallelism || string(got.salt) != string(tc.want.salt) || string(got.key) != string(tc.want.key) {
+                t.Errorf("parsed %+v, want %+v", got, tc.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,122 @@
+package password
+
+import (
+    "bufio"
+    "bytes"
+    _ "embed"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+)
+
+//go:embed common_passwords.txt
+var bundledBlocklist []byte
+
+// PolicyError lists every rule a candidate password breaks.
+type PolicyError struct {
+    Violations []string
+}
+
+func (e *PolicyError) Error() string {
+    return "password does not meet the policy: " + strings.Join(e.Violations, "; ")
+}
+
+// Policy validates new passwords against the configured rules and a list of
+// known compromised passwords.
+type Policy struct {
+    cfg       config.PasswordConfig
+    blocklist map[string]struct{}
+}
+
+// NewPolicy builds a policy from cfg, loading the bundled blocklist plus the
+// optional cfg.BlocklistFile.
+func NewPolicy(cfg config.PasswordConfig) (*Policy, error) {
+    p := &Policy{cfg: cfg, blocklist: map[string]struct{}{}}
+    if err := p.loadBlocklist(bytes.NewReader(bundledBlocklist)); err != nil {
+        return nil, err
+    }
+    if cfg.BlocklistFile != "" {
+        f, err := os.Open(cfg.BlocklistFile)
+        if err != nil {
+            return nil, fmt.Errorf("password blocklist: %w", err)
+        }
+        defer f.Close()
+        if err := p.loadBlocklist(f); err != nil {
+            return nil, fmt.Errorf("password blocklist: %w", err)
+        }
+    }
+    return p, nil
+}
+
+func (p *Policy) loadBlocklist(r io.Reader) error {
+    sc := bufio.NewScanner(r)
+    for sc.Scan() {
+        line := strings.TrimSpace(sc.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        p.blocklist[strings.ToLower(line)] = struct{}{}
+    }
+    return sc.Err()
+}
+
+// Validate checks password for the account identified by username and email.
+// It returns a *PolicyError describing every violation, or nil.
+func (p *Policy) Validate(password, username, email string) error {
+    var v []string
+    if n := utf8.RuneCountInString(password); n < p.cfg.MinLength {
+        v = append(v, fmt.Sprintf("must be at least %d characters long", p.cfg.MinLength))
+    }
+    if p.cfg.MaxLength > 0 && utf8.RuneCountInString(password) > p.cfg.MaxLength {
+        v = append(v, fmt.Sprintf("must be at most %d characters long", p.cfg.MaxLength))
+    }
+
+    var upper, lower, digit, symbol bool
+    for _, r := range password {
+        switch {
+        case unicode.IsUpper(r):
+            upper = true
+        case unicode.IsLower(r):
+            lower = true
+        case unicode.IsDigit(r):
+            digit = true
+        case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+            symbol = true
+        }
+    }
+    if p.cfg.RequireUpper && !upper {
+        v = append(v, "must contain an upper case letter")
+    }
+    if p.cfg.RequireLower && !lower {
+        v = append(v, "must contain a lower case letter")
+    }
+    if p.cfg.RequireDigit && !digit {
+        v = append(v, "must contain a digit")
+    }
+    if p.cfg.RequireSymbol && !symbol {
+        v = append(v, "must contain a symbol")
+    }
+
+    lowered := strings.ToLower(password)
+    if p.cfg.ForbidUsername {
+        if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+            v = append(v, "must not contain the username")
+        }
+        if local, _, ok := strings.Cut(email, "@"); ok && len(local) >= 3 && strings.Contains(lowered, strings.ToLower(local)) {
+            v = append(v, "must not contain the email address")
+        }
+    }
+    if _, ok := p.blocklist[lowered]; ok {
+        v = append(v, "is a commonly used or compromised password")
+    }
+
+    if len(v) > 0 {
+        return &PolicyError{Violations: v}
+    }
+    return nil
+}
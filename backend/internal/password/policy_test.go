@@ -0,0 +1,83 @@
+package password
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+
+    "github.com/C14147/SmartCampus-Workbench/internal/config"
+)
+
+func TestPolicyValidate(t *testing.T) {
+    strict := config.PasswordConfig{
+        MinLength: 10, MaxLength: 20, RequireUpper: true, RequireLower: true,
+        RequireDigit: true, RequireSymbol: true, ForbidUsername: true,
+    }
+    p, err := NewPolicy(strict)
+    if err != nil {
+        t.Fatal(err)
+    }
+    lenient, err := NewPolicy(config.PasswordConfig{MinLength: 8})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for _, tc := range []struct {
+        name       string
+        p          *Policy
+        password   string
+        violations []string
+    }{
+        {"valid", p, "Tr0ub4dor&3x", nil},
+        {"counts runes, not bytes", p, "Ünïcödé-Päß1", nil},
+        {"too short", p, "Ab1!", []string{"must be at least 10 characters long"}},
+        {"too long", p, "Abcdefghij1!abcdefghij", []string{"must be at most 20 characters long"}},
+        {"missing classes", p, "abcdefghijkl", []string{
+            "must contain an upper case letter", "must contain a digit", "must contain a symbol",
+        }},
+        {"a space is a symbol", p, "Tr0ub4dor 3x", nil},
+        {"username", p, "Xx-Ana.Smith-1", []string{"must not contain the username"}},
+        {"email local part", p, "Xx-Smith_Ana-1", []string{"must not contain the email address"}},
+        {"blocklisted", lenient, "Password1", []string{"is a commonly used or compromised password"}},
+        {"username allowed", lenient, "ana.smith99", nil},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            err := tc.p.Validate(tc.password, "ana.smith", "smith_ana@example.org")
+            var got []string
+            if pe, ok := err.(*PolicyError); ok {
+                got = pe.Violations
+            } else if err != nil {
+                t.Fatalf("unexpected error %v", err)
+            }
+            if !reflect.DeepEqual(got, tc.violations) {
+                t.Errorf("violations %q, want %q", got, tc.violations)
+            }
+        })
+    }
+}
+
+func TestPolicyBlocklistFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "blocklist.txt")
+    if err := os.WriteFile(path, []byte("# local additions\n\nSmartCampus2024\n"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    p, err := NewPolicy(config.PasswordConfig{BlocklistFile: path})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for pw, blocked := range map[string]bool{
+        "smartcampus2024":   true,
+        "qwerty123":         true,
+        "# local additions": false,
+        "smartcampus2025":   false,
+    } {
+        if got := p.Validate(pw, "", "") != nil; got != blocked {
+            t.Errorf("Validate(%q) blocked = %v, want %v", pw, got, blocked)
+        }
+    }
+
+    if _, err := NewPolicy(config.PasswordConfig{BlocklistFile: filepath.Join(t.TempDir(), "missing.txt")}); err == nil {
+        t.Error("missing blocklist file accepted")
+    }
+}
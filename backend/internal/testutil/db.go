@@ -0,0 +1,54 @@
+// Package testutil holds helpers shared by the tests of other packages.
+package testutil
+
+import (
+    "fmt"
+    "sync/atomic"
+    "testing"
+
+    "github.com/glebarez/sqlite"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+)
+
+// uuidExpr generates random UUID-formatted ids in SQLite, standing in for
+// Postgres' gen_random_uuid() column defaults.
+const uuidExpr = "(lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || " +
+    "substr(lower(hex(randomblob(2))), 2) || '-8' || substr(lower(hex(randomblob(2))), 2) || '-' || " +
+    "lower(hex(randomblob(6))))"
+
+var dbCount atomic.Int64
+
+// NewDB returns an empty in-memory SQLite database with the tables of
+// models, in place of Postgres. It is closed when the test ends.
+func NewDB(t testing.TB, models ...interface{}) *gorm.DB {
+    t.Helper()
+    dsn := fmt.Sprintf("file:testdb%d?mode=memory&cache=shared&_pragma=busy_timeout(5000)", dbCount.Add(1))
+    db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+    if err != nil {
+        t.Fatalf("open test db: %v", err)
+    }
+    sqlDB, err := db.DB()
+    if err != nil {
+        t.Fatalf("open test db: %v", err)
+    }
+    // one connection keeps the in-memory database alive and writes serial
+    sqlDB.SetMaxOpenConns(1)
+    t.Cleanup(func() { _ = sqlDB.Close() })
+
+    for _, m := range models {
+        stmt := &gorm.Statement{DB: db}
+        if err := stmt.Parse(m); err != nil {
+            t.Fatalf("parse %T: %v", m, err)
+        }
+        for _, f := range stmt.Schema.Fields {
+            if f.DefaultValue == "gen_random_uuid()" {
+                f.DefaultValue = uuidExpr
+            }
+        }
+    }
+    if err := db.AutoMigrate(models...); err != nil {
+        t.Fatalf("migrate test db: %v", err)
+    }
+    return db
+}
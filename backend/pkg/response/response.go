@@ -9,3 +9,9 @@ func Success(c *gin.Context, data interface{}) {
 func Error(c *gin.Context, code int, msg string, details interface{}) {
     c.JSON(code, gin.H{"success": false, "error": msg, "details": details})
 }
+
+// ErrorWithCode is like Error but adds a stable, machine readable error code
+// that clients can branch on (e.g. "ACCOUNT_LOCKED").
+func ErrorWithCode(c *gin.Context, status int, code string, msg string, details interface{}) {
+    c.JSON(status, gin.H{"success": false, "error": msg, "code": code, "details": details})
+}
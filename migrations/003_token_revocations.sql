@@ -0,0 +1,13 @@
+-- access token denylist: a row with jti revokes one token, a row without jti
+-- revokes every token of user_id issued before revoked_at
+CREATE TABLE IF NOT EXISTS token_revocations (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  jti VARCHAR(64),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  revoked_at TIMESTAMPTZ NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_revocations_jti ON token_revocations(jti);
+CREATE INDEX IF NOT EXISTS idx_token_revocations_user_id ON token_revocations(user_id);
+CREATE INDEX IF NOT EXISTS idx_token_revocations_expires_at ON token_revocations(expires_at);
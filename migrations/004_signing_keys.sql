@@ -0,0 +1,10 @@
+-- asymmetric JWT signing keys (PKCS#8 PEM), rotated by the API instances
+CREATE TABLE IF NOT EXISTS signing_keys (
+  kid VARCHAR(64) PRIMARY KEY,
+  algorithm VARCHAR(20) NOT NULL,
+  private_key TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_signing_keys_expires_at ON signing_keys(expires_at);
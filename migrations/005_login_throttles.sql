@@ -0,0 +1,8 @@
+-- failed login counters and lockouts, keyed by "user:<username>" or "ip:<address>"
+CREATE TABLE IF NOT EXISTS login_throttles (
+  key VARCHAR(150) PRIMARY KEY,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMPTZ,
+  locked_until TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
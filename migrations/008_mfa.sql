@@ -0,0 +1,20 @@
+-- TOTP two-factor authentication
+CREATE TABLE IF NOT EXISTS user_mfa (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  secret VARCHAR(64) NOT NULL,
+  enabled_at TIMESTAMPTZ,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- one-time recovery codes; only the SHA-256 of each code is stored
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
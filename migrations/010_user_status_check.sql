@@ -0,0 +1,8 @@
+-- only the statuses understood by login and AuthMiddleware are allowed
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_status_check') THEN
+        ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'inactive', 'suspended'));
+    END IF;
+END
+$$;
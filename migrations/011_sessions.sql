@@ -0,0 +1,17 @@
+-- one row per signed-in device; the id is the family id of its refresh tokens
+CREATE TABLE IF NOT EXISTS sessions (
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  user_agent VARCHAR(512),
+  ip VARCHAR(64),
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  last_seen_at TIMESTAMPTZ NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- a denylist row with session_id revokes every access token of that session
+ALTER TABLE token_revocations ADD COLUMN IF NOT EXISTS session_id VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_token_revocations_session_id ON token_revocations(session_id);
@@ -0,0 +1,19 @@
+-- service accounts authenticate with API tokens only
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'human';
+
+-- personal access tokens; only the SHA-256 of each token is stored
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  token_hash VARCHAR(64) UNIQUE NOT NULL,
+  scopes VARCHAR(500) NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  created_by UUID,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
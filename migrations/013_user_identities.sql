@@ -0,0 +1,13 @@
+-- accounts at external identity providers (OIDC single sign-on)
+CREATE TABLE IF NOT EXISTS user_identities (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  issuer VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(100),
+  last_login_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_issuer_subject ON user_identities(issuer, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
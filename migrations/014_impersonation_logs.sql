@@ -0,0 +1,19 @@
+-- audit trail of admins acting as other users
+CREATE TABLE IF NOT EXISTS impersonation_logs (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  impersonator_id UUID NOT NULL REFERENCES users(id),
+  user_id UUID NOT NULL REFERENCES users(id),
+  kind VARCHAR(20) NOT NULL,
+  reason VARCHAR(500),
+  method VARCHAR(10),
+  path VARCHAR(500),
+  status INTEGER,
+  ip VARCHAR(64),
+  token_jti VARCHAR(64),
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_logs_impersonator_id ON impersonation_logs(impersonator_id);
+CREATE INDEX IF NOT EXISTS idx_impersonation_logs_user_id ON impersonation_logs(user_id);
+CREATE INDEX IF NOT EXISTS idx_impersonation_logs_token_jti ON impersonation_logs(token_jti);
+CREATE INDEX IF NOT EXISTS idx_impersonation_logs_created_at ON impersonation_logs(created_at);
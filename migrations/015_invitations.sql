@@ -0,0 +1,48 @@
+-- school a user belongs to; set by invitations or by an admin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS school_id UUID REFERENCES schools(id);
+CREATE INDEX IF NOT EXISTS idx_users_school_id ON users(school_id);
+
+CREATE TABLE IF NOT EXISTS classes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  grade VARCHAR(50),
+  classroom VARCHAR(50),
+  capacity INTEGER DEFAULT 40,
+  head_teacher_id UUID REFERENCES users(id),
+  status VARCHAR(20) DEFAULT 'active',
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS class_students (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  class_id UUID NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+  student_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  seat_number INTEGER,
+  enrollment_date DATE DEFAULT CURRENT_DATE,
+  status VARCHAR(20) DEFAULT 'active',
+  UNIQUE(class_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_class_students_student_id ON class_students(student_id);
+
+-- registration invitations and class-join codes; only the SHA-256 of each code is stored
+CREATE TABLE IF NOT EXISTS invitations (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  code_hash VARCHAR(64) UNIQUE NOT NULL,
+  hint VARCHAR(16) NOT NULL,
+  role VARCHAR(20) NOT NULL,
+  school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+  class_id UUID REFERENCES classes(id) ON DELETE CASCADE,
+  max_uses INTEGER NOT NULL DEFAULT 1,
+  uses INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ,
+  created_by UUID NOT NULL REFERENCES users(id),
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_school_id ON invitations(school_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_created_by ON invitations(created_by);
@@ -0,0 +1,8 @@
+-- school records of a user, starting with student and teacher numbers
+CREATE TABLE IF NOT EXISTS user_profiles (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  student_id VARCHAR(50) UNIQUE,
+  teacher_id VARCHAR(50) UNIQUE,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
@@ -0,0 +1,6 @@
+-- remaining profile fields of backend_plan.md
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS department VARCHAR(100);
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS grade VARCHAR(50);
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS birth_date DATE;
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS address TEXT;
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS emergency_contact JSONB;
@@ -0,0 +1,16 @@
+-- guardians (parents) linked to students
+
+CREATE TABLE IF NOT EXISTS guardian_links (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  guardian_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  student_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  relationship VARCHAR(50),
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  verified_by UUID REFERENCES users(id),
+  verified_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW(),
+  UNIQUE(guardian_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_guardian_links_student_id ON guardian_links(student_id);
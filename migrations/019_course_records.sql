@@ -0,0 +1,65 @@
+-- courses and the assignment, submission, grade and notification records that
+-- guardians read for their students
+
+CREATE TABLE IF NOT EXISTS courses (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name VARCHAR(200) NOT NULL,
+  code VARCHAR(50) UNIQUE NOT NULL,
+  description TEXT,
+  credit INTEGER DEFAULT 1,
+  teacher_id UUID REFERENCES users(id),
+  class_id UUID REFERENCES classes(id) ON DELETE CASCADE,
+  schedule JSONB,
+  room VARCHAR(50),
+  status VARCHAR(20) DEFAULT 'active',
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ
+);
+
+-- assignments as in the model
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS assignment_type VARCHAR(50) DEFAULT 'homework';
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS max_score DECIMAL(5,2) DEFAULT 100.00;
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS attachments JSONB DEFAULT '[]';
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS status VARCHAR(20) DEFAULT 'published';
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT NOW();
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS assignment_submissions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  assignment_id UUID NOT NULL REFERENCES assignments(id) ON DELETE CASCADE,
+  student_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  content TEXT,
+  attachments JSONB DEFAULT '[]',
+  submitted_at TIMESTAMPTZ DEFAULT NOW(),
+  status VARCHAR(20) DEFAULT 'submitted',
+  UNIQUE(assignment_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignment_submissions_student_id ON assignment_submissions(student_id);
+
+CREATE TABLE IF NOT EXISTS grades (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  submission_id UUID NOT NULL REFERENCES assignment_submissions(id) ON DELETE CASCADE,
+  score DECIMAL(5,2),
+  feedback TEXT,
+  graded_by UUID REFERENCES users(id),
+  graded_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_grades_submission_id ON grades(submission_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  title VARCHAR(200) NOT NULL,
+  content TEXT NOT NULL,
+  notification_type VARCHAR(50) NOT NULL,
+  target_audience VARCHAR(20) CHECK (target_audience IN ('all', 'teachers', 'students', 'class')),
+  target_id UUID,
+  priority VARCHAR(20) DEFAULT 'normal',
+  expires_at TIMESTAMPTZ,
+  created_by UUID REFERENCES users(id),
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
@@ -0,0 +1,13 @@
+-- Casbin policies and role assignments; seeded from config/rbac_policy.csv on first start
+CREATE TABLE IF NOT EXISTS casbin_rule (
+  id BIGSERIAL PRIMARY KEY,
+  ptype VARCHAR(100),
+  v0 VARCHAR(100),
+  v1 VARCHAR(100),
+  v2 VARCHAR(100),
+  v3 VARCHAR(100),
+  v4 VARCHAR(100),
+  v5 VARCHAR(100)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_casbin_rule ON casbin_rule(ptype, v0, v1, v2, v3, v4, v5);
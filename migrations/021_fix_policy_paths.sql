@@ -0,0 +1,3 @@
+-- the first policies named /schools and /assignments, which match no route
+UPDATE casbin_rule SET v1 = '/api/v1/schools*' WHERE ptype = 'p' AND v1 = '/schools';
+UPDATE casbin_rule SET v1 = '/api/v1/assignments*' WHERE ptype = 'p' AND v1 = '/assignments';
@@ -0,0 +1,25 @@
+-- per-school roles: sessions act in a school, role groupings carry one (v2)
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS school_id UUID REFERENCES schools(id) ON DELETE SET NULL;
+
+-- groupings without a school applied everywhere
+UPDATE casbin_rule SET v2 = '*' WHERE ptype = 'g' AND (v2 IS NULL OR v2 = '');
+
+-- admins of no school administered every school; they become district admins
+UPDATE users SET role = 'district_admin' WHERE role = 'admin' AND school_id IS NULL;
+
+-- school admins no longer create or delete schools, nor edit the shared policy
+UPDATE casbin_rule SET v2 = '(GET|PUT)' WHERE ptype = 'p' AND v0 = 'admin' AND v1 = '/api/v1/schools*';
+DELETE FROM casbin_rule WHERE ptype = 'p' AND v0 = 'admin' AND v1 = '/api/v1/admin/*';
+-- only into policies already seeded; an empty table is seeded from the file
+INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5)
+SELECT r.* FROM (VALUES
+  ('p', 'district_admin', '/api/v1/schools*', '(POST|DELETE)', '', '', ''),
+  ('p', 'admin', '/api/v1/admin/users*', '(GET|POST|PUT|DELETE)', '', '', ''),
+  ('p', 'admin', '/api/v1/admin/impersonation-logs', 'GET', '', '', ''),
+  ('p', 'admin', '/api/v1/admin/service-accounts*', '(GET|POST|DELETE)', '', '', ''),
+  ('p', 'admin', '/api/v1/admin/guardian-links*', '(GET|POST|DELETE)', '', '', ''),
+  ('p', 'district_admin', '/api/v1/admin/policies*', '(GET|POST|DELETE)', '', '', ''),
+  ('g', 'district_admin', 'admin', '*', '', '', '')
+) AS r(ptype, v0, v1, v2, v3, v4, v5)
+WHERE EXISTS (SELECT 1 FROM casbin_rule)
+ON CONFLICT DO NOTHING;
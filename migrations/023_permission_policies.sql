@@ -0,0 +1,117 @@
+-- policies name permissions (p, sub, permission) instead of route paths and
+-- methods (p, sub, path, methods). Path policies are converted: a subject
+-- gets a permission when its path policies together cover every route that
+-- needs it. Path policies that cover routes of a permission only in part, or
+-- no route at all, cannot be converted without granting more or less than
+-- before; they are moved to casbin_rule_legacy, which check-policies reports
+-- until an operator has replaced them and deleted the rows.
+CREATE TABLE IF NOT EXISTS casbin_rule_legacy (
+  id BIGSERIAL PRIMARY KEY,
+  ptype VARCHAR(100),
+  v0 VARCHAR(100),
+  v1 VARCHAR(100),
+  v2 VARCHAR(100),
+  v3 VARCHAR(100),
+  v4 VARCHAR(100),
+  v5 VARCHAR(100),
+  moved_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- the protected routes and the permission each needs, as registered in cmd/api
+CREATE TEMP TABLE route_permissions (method, path, permission) AS VALUES
+  ('GET', '/api/v1/users/profile', 'profile:manage'),
+  ('PUT', '/api/v1/users/profile', 'profile:manage'),
+  ('GET', '/api/v1/schools', 'school:view'),
+  ('GET', '/api/v1/schools/:id', 'school:view'),
+  ('PUT', '/api/v1/schools/:id', 'school:manage'),
+  ('POST', '/api/v1/schools', 'district:manage'),
+  ('DELETE', '/api/v1/schools/:id', 'district:manage'),
+  ('GET', '/api/v1/assignments', 'assignment:view'),
+  ('GET', '/api/v1/assignments/:id', 'assignment:view'),
+  ('POST', '/api/v1/assignments', 'assignment:manage'),
+  ('DELETE', '/api/v1/assignments/:id', 'assignment:manage'),
+  ('PUT', '/api/v1/assignments/:id', 'assignment:manage'),
+  ('GET', '/api/v1/admin/users', 'user:view'),
+  ('GET', '/api/v1/admin/users/:id', 'user:view'),
+  ('GET', '/api/v1/admin/users/:id/profile', 'user:view'),
+  ('GET', '/api/v1/admin/users/:id/roles', 'user:view'),
+  ('POST', '/api/v1/admin/users', 'user:manage'),
+  ('DELETE', '/api/v1/admin/users/:id', 'user:manage'),
+  ('PUT', '/api/v1/admin/users/:id', 'user:manage'),
+  ('POST', '/api/v1/admin/users/:id/password-reset', 'user:manage'),
+  ('PUT', '/api/v1/admin/users/:id/profile', 'user:manage'),
+  ('POST', '/api/v1/admin/users/:id/revoke-sessions', 'user:manage'),
+  ('PUT', '/api/v1/admin/users/:id/role', 'user:manage'),
+  ('DELETE', '/api/v1/admin/users/:id/roles', 'user:manage'),
+  ('POST', '/api/v1/admin/users/:id/roles', 'user:manage'),
+  ('PUT', '/api/v1/admin/users/:id/status', 'user:manage'),
+  ('POST', '/api/v1/admin/users/:id/unlock', 'user:manage'),
+  ('POST', '/api/v1/admin/users/import', 'user:manage'),
+  ('GET', '/api/v1/admin/impersonation-logs', 'user:impersonate'),
+  ('POST', '/api/v1/admin/users/:id/impersonate', 'user:impersonate'),
+  ('GET', '/api/v1/admin/service-accounts', 'service_account:manage'),
+  ('POST', '/api/v1/admin/service-accounts', 'service_account:manage'),
+  ('GET', '/api/v1/admin/service-accounts/:id/tokens', 'service_account:manage'),
+  ('POST', '/api/v1/admin/service-accounts/:id/tokens', 'service_account:manage'),
+  ('DELETE', '/api/v1/admin/service-accounts/:id/tokens/:tokenId', 'service_account:manage'),
+  ('DELETE', '/api/v1/admin/policies', 'system:manage'),
+  ('GET', '/api/v1/admin/policies', 'system:manage'),
+  ('POST', '/api/v1/admin/policies', 'system:manage'),
+  ('DELETE', '/api/v1/admin/policies/groupings', 'system:manage'),
+  ('POST', '/api/v1/admin/policies/groupings', 'system:manage'),
+  ('GET', '/api/v1/admin/guardian-links', 'guardian_link:manage'),
+  ('POST', '/api/v1/admin/guardian-links', 'guardian_link:manage'),
+  ('DELETE', '/api/v1/admin/guardian-links/:id', 'guardian_link:manage'),
+  ('POST', '/api/v1/admin/guardian-links/:id/reject', 'guardian_link:manage'),
+  ('POST', '/api/v1/admin/guardian-links/:id/verify', 'guardian_link:manage'),
+  ('POST', '/api/v1/guardian/links', 'guardian_link:request'),
+  ('GET', '/api/v1/guardian/students', 'guardian:view'),
+  ('GET', '/api/v1/guardian/students/:id/assignments', 'guardian:view'),
+  ('GET', '/api/v1/guardian/students/:id/grades', 'guardian:view'),
+  ('GET', '/api/v1/guardian/students/:id/notifications', 'guardian:view'),
+  ('GET', '/api/v1/invitations', 'invitation:manage'),
+  ('POST', '/api/v1/invitations', 'invitation:manage'),
+  ('DELETE', '/api/v1/invitations/:id', 'invitation:manage');
+
+-- the routes each path policy allowed, matched like the former matcher
+-- (keyMatch on the path, regexMatch on the method)
+CREATE TEMP TABLE path_policy_routes AS
+SELECT p.id, p.v0 AS sub, r.method, r.path, r.permission
+FROM casbin_rule p
+JOIN route_permissions r ON r.path LIKE replace(p.v1, '*', '%') AND r.method ~ p.v2
+WHERE p.ptype = 'p' AND p.v1 LIKE '/%';
+
+-- permissions whose every route some path policy of the subject allowed
+CREATE TEMP TABLE path_policy_grants AS
+SELECT DISTINCT m.sub, m.permission
+FROM path_policy_routes m
+WHERE NOT EXISTS (
+  SELECT 1 FROM route_permissions r
+  WHERE r.permission = m.permission
+    AND NOT EXISTS (
+      SELECT 1 FROM path_policy_routes o
+      WHERE o.sub = m.sub AND o.method = r.method AND o.path = r.path
+    )
+);
+
+INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5)
+SELECT 'p', sub, permission, '', '', '', '' FROM path_policy_grants
+ON CONFLICT DO NOTHING;
+
+INSERT INTO casbin_rule_legacy (ptype, v0, v1, v2, v3, v4, v5)
+SELECT p.ptype, p.v0, p.v1, p.v2, p.v3, p.v4, p.v5
+FROM casbin_rule p
+WHERE p.ptype = 'p' AND p.v1 LIKE '/%' AND (
+  NOT EXISTS (SELECT 1 FROM path_policy_routes m WHERE m.id = p.id)
+  OR EXISTS (
+    SELECT 1 FROM path_policy_routes m
+    WHERE m.id = p.id
+      AND NOT EXISTS (SELECT 1 FROM path_policy_grants g WHERE g.sub = m.sub AND g.permission = m.permission)
+  )
+);
+
+DELETE FROM casbin_rule WHERE ptype = 'p' AND v1 LIKE '/%';
+
+DROP TABLE path_policy_grants;
+DROP TABLE path_policy_routes;
+DROP TABLE route_permissions;
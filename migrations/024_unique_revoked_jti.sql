@@ -0,0 +1,8 @@
+-- a jti is revoked at most once, so that consuming a single-use token (the
+-- MFA challenge) is atomic across instances
+DELETE FROM token_revocations a
+USING token_revocations b
+WHERE a.jti <> '' AND a.jti = b.jti AND a.id > b.id;
+
+DROP INDEX IF EXISTS idx_token_revocations_jti;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_token_revocations_jti ON token_revocations(jti) WHERE jti <> '';
@@ -0,0 +1,23 @@
+-- change counter of casbin_rule; instances reload their policies when it
+-- moves instead of reading the whole table on every sync
+CREATE TABLE IF NOT EXISTS casbin_rule_revision (
+  id INTEGER PRIMARY KEY,
+  revision BIGINT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+INSERT INTO casbin_rule_revision (id, revision) VALUES (1, 0) ON CONFLICT (id) DO NOTHING;
+
+-- the API bumps the counter itself; the trigger also catches rules changed
+-- by migrations or by hand
+CREATE OR REPLACE FUNCTION bump_casbin_rule_revision() RETURNS trigger AS $$
+BEGIN
+  UPDATE casbin_rule_revision SET revision = revision + 1, updated_at = NOW() WHERE id = 1;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS casbin_rule_changed ON casbin_rule;
+CREATE TRIGGER casbin_rule_changed
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON casbin_rule
+  FOR EACH STATEMENT EXECUTE FUNCTION bump_casbin_rule_revision();